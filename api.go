@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- REST-API v1 ---
+
+// Alle Antworten sind JSON. Fehler haben die Form {"error": "..."}.
+//
+//	GET    /api/v1/series                                 Liste (?sort=&order=&favorite=1&min_rating=7&tag=&list=)
+//	POST   /api/v1/series                                 {"identifier": "tt0903747"}
+//	GET    /api/v1/series/{id}                            einzelne Serie
+//	PATCH  /api/v1/series/{id}                            {"episodes_watched": 5, "status": "On Hold"}
+//	                                                      {"rating": 8, "notes": "...", "favorite": true, "tags": ["anime"]}
+//	DELETE /api/v1/series/{id}
+//	PUT    /api/v1/series/{id}/seasons/{s}                {"watched": true}
+//	PUT    /api/v1/series/{id}/seasons/{s}/episodes/{e}   {"watched": true}
+//	GET    /api/v1/search?q=...
+//	GET    /api/v1/stats                                  Statistik wie unter /stats
+
+const apiMaxBodySize = 1 << 20
+
+// apiHandlerFunc bekommt den bereits geprüften Nutzer übergeben.
+type apiHandlerFunc func(w http.ResponseWriter, r *http.Request, user string)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type apiCreateRequest struct {
+	Identifier string `json:"identifier"`
+}
+
+type apiPatchRequest struct {
+	EpisodesWatched *int      `json:"episodes_watched"`
+	Status          *string   `json:"status"`
+	Rating          *int      `json:"rating"` // 0 entfernt die Bewertung
+	Notes           *string   `json:"notes"`
+	Favorite        *bool     `json:"favorite"`
+	Tags            *[]string `json:"tags"`
+}
+
+type apiWatchedRequest struct {
+	Watched *bool `json:"watched"`
+}
+
+var errInvalidBody = errors.New("invalid request body")
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("api: failed to write response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// writeStoreError übersetzt Fehler aus den Serien-Hilfsfunktionen in
+// passende Statuscodes.
+func writeStoreError(w http.ResponseWriter, user string, err error) {
+	switch err {
+	case errSeriesNotFound, errSeasonNotFound, errEpisodeNotFound:
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errSeriesExists:
+		writeAPIError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("api: request for %s failed: %v", user, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to save changes")
+	}
+}
+
+// writeMetadataError meldet "nicht gefunden" als 404 und Ausfälle der
+// Anbieter als 502.
+func writeMetadataError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, errMetadataNotFound):
+		writeAPIError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errNoMetadataProvider):
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		log.Printf("api: %s failed: %v", action, err)
+		writeAPIError(w, http.StatusBadGateway, fmt.Sprintf("%s failed: %v", action, err))
+	}
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, apiMaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%v: %v", errInvalidBody, err)
+	}
+	return nil
+}
+
+// apiAuth akzeptiert ein API-Token als Bearer-Header oder die Sitzung des
+// Browsers und liefert 401 statt einer Weiterleitung auf die Login-Seite.
+// Ist ein Bearer-Header gesetzt, zählt nur dieser.
+func apiAuth(next apiHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			user, t, ok := lookupAPIToken(token)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeAPIError(w, http.StatusUnauthorized, "invalid api token")
+				return
+			}
+			if t.Scope != scopeWrite && !isSafeMethod(r.Method) {
+				writeAPIError(w, http.StatusForbidden, "token is read-only")
+				return
+			}
+			touchAPIToken(user, t)
+			next(w, r, user)
+			return
+		}
+
+		user, ok := getCurrentUser(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r, user)
+	}
+}
+
+// apiV1Handler verteilt die Anfragen unter /api/v1/ anhand des Pfads.
+func apiV1Handler(w http.ResponseWriter, r *http.Request, user string) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1"), "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "search":
+		apiSearch(w, r)
+		return
+	case len(parts) == 1 && parts[0] == "series":
+		apiSeriesCollection(w, r, user)
+		return
+	case len(parts) == 1 && parts[0] == "stats":
+		apiStats(w, r, user)
+		return
+	case len(parts) < 2 || parts[0] != "series":
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	rest := parts[2:]
+
+	switch {
+	case len(rest) == 0:
+		apiSeriesItem(w, r, user, id)
+	case len(rest) == 2 && rest[0] == "seasons":
+		season, err := strconv.Atoi(rest[1])
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid season")
+			return
+		}
+		apiMarkWatched(w, r, user, id, func(s *Series, watched bool) error {
+			return setSeasonWatched(s, season, watched)
+		})
+	case len(rest) == 4 && rest[0] == "seasons" && rest[2] == "episodes":
+		season, err1 := strconv.Atoi(rest[1])
+		episode, err2 := strconv.Atoi(rest[3])
+		if err1 != nil || err2 != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid season or episode")
+			return
+		}
+		apiMarkWatched(w, r, user, id, func(s *Series, watched bool) error {
+			return setEpisodeWatched(s, season, episode, watched)
+		})
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func apiSeriesCollection(w http.ResponseWriter, r *http.Request, user string) {
+	switch r.Method {
+	case "GET":
+		series, err := store.LoadSeries(user)
+		if err != nil {
+			log.Printf("api: failed to load series for %s: %v", user, err)
+			writeAPIError(w, http.StatusInternalServerError, "failed to load series")
+			return
+		}
+		filter := parseSeriesFilter(r.URL.Query())
+		if err := filter.loadList(user); err != nil {
+			if err == errListNotFound {
+				writeAPIError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			log.Printf("api: failed to load lists for %s: %v", user, err)
+			writeAPIError(w, http.StatusInternalServerError, "failed to load lists")
+			return
+		}
+		series = filterSeries(series, filter)
+		sortBy := r.URL.Query().Get("sort")
+		order := r.URL.Query().Get("order")
+		if sortBy == "list" && filter.List() != nil {
+			sortByList(series, *filter.List())
+		} else if sortBy != "" {
+			sortSeries(series, sortBy, order)
+		}
+		writeJSON(w, http.StatusOK, series)
+
+	case "POST":
+		var req apiCreateRequest
+		if err := decodeBody(r, &req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		identifier := strings.TrimSpace(req.Identifier)
+		if identifier == "" {
+			writeAPIError(w, http.StatusBadRequest, "identifier required")
+			return
+		}
+		seriesData, err := metadata.Lookup(identifier)
+		if err != nil {
+			writeMetadataError(w, "lookup", err)
+			return
+		}
+		added, err := insertSeries(user, seriesData, fetchInitialSeasons(seriesData))
+		if err != nil {
+			writeStoreError(w, user, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/series/%d", added.ID))
+		writeJSON(w, http.StatusCreated, added)
+
+	default:
+		methodNotAllowed(w, "GET", "POST")
+	}
+}
+
+func apiSeriesItem(w http.ResponseWriter, r *http.Request, user string, id int) {
+	switch r.Method {
+	case "GET":
+		series, err := store.LoadSeries(user)
+		if err != nil {
+			log.Printf("api: failed to load series for %s: %v", user, err)
+			writeAPIError(w, http.StatusInternalServerError, "failed to load series")
+			return
+		}
+		for _, s := range series {
+			if s.ID == id {
+				writeJSON(w, http.StatusOK, s)
+				return
+			}
+		}
+		writeAPIError(w, http.StatusNotFound, errSeriesNotFound.Error())
+
+	case "PATCH":
+		var req apiPatchRequest
+		if err := decodeBody(r, &req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.EpisodesWatched != nil && *req.EpisodesWatched < 0 {
+			writeAPIError(w, http.StatusBadRequest, "episodes_watched must not be negative")
+			return
+		}
+		if req.Status != nil && *req.Status != "auto" && !isValidStatus(*req.Status) {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid status %q", *req.Status))
+			return
+		}
+		if req.Rating != nil {
+			if err := validateRating(*req.Rating); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if req.Notes != nil {
+			notes, err := normalizeNotes(*req.Notes)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			req.Notes = &notes
+		}
+		if req.Tags != nil {
+			tags, err := normalizeTags(*req.Tags)
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			req.Tags = &tags
+		}
+		var updated Series
+		err := updateOneSeries(user, id, sourceAPI, func(s *Series) error {
+			if req.EpisodesWatched != nil {
+				setWatchedCount(s, *req.EpisodesWatched)
+			}
+			if req.Status != nil {
+				if err := setStatus(s, *req.Status); err != nil {
+					return err
+				}
+			}
+			if req.Rating != nil {
+				s.Rating = *req.Rating
+			}
+			if req.Notes != nil {
+				s.Notes = *req.Notes
+			}
+			if req.Favorite != nil {
+				s.Favorite = *req.Favorite
+			}
+			if req.Tags != nil {
+				s.Tags = *req.Tags
+			}
+			updated = *s
+			return nil
+		})
+		if err != nil {
+			writeStoreError(w, user, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+
+	case "DELETE":
+		if _, err := trashSeries(user, id); err != nil {
+			writeStoreError(w, user, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, "GET", "PATCH", "DELETE")
+	}
+}
+
+// apiMarkWatched liest {"watched": bool} und wendet mark auf die Serie an.
+func apiMarkWatched(w http.ResponseWriter, r *http.Request, user string, id int, mark func(s *Series, watched bool) error) {
+	if r.Method != "PUT" {
+		methodNotAllowed(w, "PUT")
+		return
+	}
+	var req apiWatchedRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Watched == nil {
+		writeAPIError(w, http.StatusBadRequest, "watched required")
+		return
+	}
+	var updated Series
+	err := updateOneSeries(user, id, sourceAPI, func(s *Series) error {
+		if err := mark(s, *req.Watched); err != nil {
+			return err
+		}
+		updated = *s
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, user, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func apiSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeAPIError(w, http.StatusBadRequest, "query parameter q required")
+		return
+	}
+	items, err := metadata.Search(query)
+	if err != nil {
+		writeMetadataError(w, "search", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
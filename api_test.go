@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useMetadata ersetzt die Anbieter für den Test.
+func useMetadata(t *testing.T, chain providerChain) {
+	t.Helper()
+	previous := metadata
+	metadata = chain
+	t.Cleanup(func() { metadata = previous })
+}
+
+func TestAPICreateSeriesStatus(t *testing.T) {
+	useTestData(t)
+	tests := []struct {
+		name  string
+		chain providerChain
+		want  int
+	}{
+		{"not found", providerChain{fakeProvider{name: "omdb", err: errMetadataNotFound}, fakeProvider{name: "tvmaze", err: errMetadataNotFound}}, http.StatusNotFound},
+		{"provider down", providerChain{fakeProvider{name: "omdb", err: errMetadataNotFound}, fakeProvider{name: "tvmaze", err: errors.New("network error: timeout")}}, http.StatusBadGateway},
+		{"no provider", providerChain{}, http.StatusServiceUnavailable},
+		{"found", providerChain{fakeProvider{name: "tvmaze", info: &SeriesInfo{Title: "Dark", IMDBID: "tt5753856"}}}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		useMetadata(t, tt.chain)
+		r := httptest.NewRequest("POST", "/api/v1/series", strings.NewReader(`{"identifier": "tt5753856"}`))
+		w := httptest.NewRecorder()
+		apiSeriesCollection(w, r, "anna")
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestAPISearchStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain providerChain
+		want  int
+	}{
+		{"no hits", providerChain{fakeProvider{name: "omdb", err: errMetadataNotFound}}, http.StatusOK},
+		{"provider down", providerChain{fakeProvider{name: "omdb", err: errors.New("api responded with status: 500")}}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		useMetadata(t, tt.chain)
+		w := httptest.NewRecorder()
+		apiSearch(w, httptest.NewRequest("GET", "/api/v1/search?q=xyz", nil))
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,977 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- SICHERUNG & WIEDERHERSTELLUNG ---
+
+// Eine Sicherung ist ein ZIP mit allen Nutzern, Serienlisten, Verläufen,
+// eigenen Listen, Papierkörben, Einstellungen und Postern. Sie wird über die
+// Store-Schnittstelle gelesen und geschrieben und passt daher zu beiden
+// Backends. Sitzungen und der Metadaten-Cache gehören nicht dazu, ebenso
+// wenig die internen Einstellungen des Backends (backupSkipSettings).
+//
+//	manifest.json            Format, Schema-Version, Zeitpunkt und Inhalt
+//	users.json               wie data/users.json
+//	settings.json            Einstellungen aus dem Speicher
+//	series/<nutzer>.json     wie data/<nutzer>.json
+//	history/<nutzer>.jsonl   wie data/history/<nutzer>.jsonl
+//	lists/<nutzer>.json      wie data/lists/<nutzer>.json
+//	trash/<nutzer>.json      wie data/trash/<nutzer>.json
+//	covers/<id>.jpg          Original-Poster aus data/covers
+//
+// Auf dem Server liegen Sicherungen in data/backups als
+// <art>-<zeitstempel>.zip, bei mehreren in derselben Sekunde mit -2, -3 …
+// angehängt; automatische werden nach BACKUP_KEEP gelöscht.
+
+const (
+	backupsSubdir       = "backups"
+	backupFormat        = "serien-tracker-backup"
+	backupFormatVersion = 1
+	backupManifestFile  = "manifest.json"
+	backupUsersFile     = "users.json"
+	backupSettingsFile  = "settings.json"
+	backupMaxBytes      = 128 << 20
+	backupMaxUnpacked   = 512 << 20
+	backupTimeLayout    = "20060102-150405"
+	backupRetryAfter    = time.Hour
+
+	backupKindAuto    = "auto"
+	backupKindManual  = "manual"
+	backupKindUpload  = "upload"
+	backupKindRestore = "pre-restore"
+)
+
+var (
+	backupsDir = filepath.Join(dataDir, backupsSubdir)
+
+	// Ohne BACKUP_INTERVAL gibt es keine automatischen Sicherungen.
+	backupInterval = envDuration("BACKUP_INTERVAL", 0)
+	backupKeep     = envInt("BACKUP_KEEP", 7)
+
+	// backupMu sorgt dafür, dass Sicherungen und Wiederherstellungen
+	// nacheinander laufen.
+	backupMu sync.Mutex
+
+	// Diese Einstellungen verwaltet das Backend selbst; sie beschreiben den
+	// Zustand der Datenbank, nicht den der Sicherung.
+	backupSkipSettings = map[string]bool{"schema_version": true, "json_imported": true}
+
+	validBackupName = regexp.MustCompile(`^([a-z-]+)-(\d{8}-\d{6})(?:-(\d+))?\.zip$`)
+
+	errBackupNotFound = errors.New("backup not found")
+	errBackupLockout  = errors.New("the backup does not contain your account as admin, restoring it would lock you out")
+)
+
+// BackupManifest steht als manifest.json in jeder Sicherung.
+type BackupManifest struct {
+	Format        string       `json:"format"`
+	Version       int          `json:"version"`
+	SchemaVersion int          `json:"schema_version"`
+	Created       time.Time    `json:"created"`
+	Users         []BackupUser `json:"users"`
+	Settings      int          `json:"settings"`
+	Covers        int          `json:"covers"`
+}
+
+// BackupUser beschreibt den Inhalt einer Sicherung für einen Nutzer.
+type BackupUser struct {
+	Username string `json:"username"`
+	Series   int    `json:"series"`
+	History  int    `json:"history"`
+	Lists    int    `json:"lists"`
+	Trash    int    `json:"trash"`
+}
+
+// backupArchive ist der entpackte und geprüfte Inhalt einer Sicherung.
+type backupArchive struct {
+	Manifest BackupManifest
+	Users    map[string]User
+	Settings map[string]string // nil bei Sicherungen ohne settings.json
+	Series   map[string][]Series
+	History  map[string][]byte
+	Lists    map[string][]byte
+	Trash    map[string][]byte
+	Covers   map[string][]byte
+}
+
+// BackupFile ist eine Sicherung in data/backups.
+type BackupFile struct {
+	Name    string
+	Kind    string
+	Created time.Time
+	Seq     int // Zähler für Sicherungen derselben Sekunde, sonst 1
+	Size    int64
+}
+
+func (f BackupFile) SizeKB() int64 {
+	return (f.Size + 1023) / 1024
+}
+
+// KindLabel beschreibt, wie die Sicherung entstanden ist.
+func (f BackupFile) KindLabel() string {
+	switch f.Kind {
+	case backupKindAuto:
+		return "automatisch"
+	case backupKindManual:
+		return "manuell"
+	case backupKindUpload:
+		return "hochgeladen"
+	case backupKindRestore:
+		return "vor Wiederherstellung"
+	}
+	return f.Kind
+}
+
+// BackupOverview ist die Karte "Sicherung" im Admin-Panel.
+type BackupOverview struct {
+	Files    []BackupFile
+	Interval time.Duration
+	Keep     int
+	Preview  *BackupPreview
+}
+
+// IntervalLabel liefert z. B. "24h" statt "24h0m0s".
+func (o BackupOverview) IntervalLabel() string {
+	label := o.Interval.String()
+	if strings.HasSuffix(label, "m0s") {
+		label = strings.TrimSuffix(label, "0s")
+	}
+	if strings.HasSuffix(label, "h0m") {
+		label = strings.TrimSuffix(label, "0m")
+	}
+	return label
+}
+
+// BackupPreview zeigt vor dem Wiederherstellen, was sich ändert.
+type BackupPreview struct {
+	File          string
+	Created       time.Time
+	SchemaVersion int
+	Users         []BackupPreviewUser
+	Removed       []UserEntry // Nutzer, die es danach nicht mehr gibt
+	Settings      int
+	HasSettings   bool
+	Covers        int
+}
+
+type BackupPreviewUser struct {
+	Username      string
+	DisplayName   string
+	IsAdmin       bool
+	New           bool
+	Series        int
+	CurrentSeries int
+	History       int
+	Lists         int
+}
+
+// --- SICHERN ---
+
+// writeBackup schreibt eine Sicherung des aktuellen Stands nach w.
+// Aufrufer halten backupMu.
+func writeBackup(w io.Writer) (BackupManifest, error) {
+	manifest := BackupManifest{
+		Format:        backupFormat,
+		Version:       backupFormatVersion,
+		SchemaVersion: currentSchemaVersion,
+		Created:       time.Now(),
+	}
+	allUsers, err := store.LoadUsers()
+	if err != nil {
+		return manifest, fmt.Errorf("failed to load users: %v", err)
+	}
+	names := make([]string, 0, len(allUsers))
+	for name := range allUsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type entry struct {
+		name string
+		data []byte
+	}
+	var entries []entry
+	add := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %v", name, err)
+		}
+		entries = append(entries, entry{name, data})
+		return nil
+	}
+
+	if err := add(backupUsersFile, usersFile{SchemaVersion: currentSchemaVersion, Users: allUsers}); err != nil {
+		return manifest, err
+	}
+	settings, err := backupSettings()
+	if err != nil {
+		return manifest, fmt.Errorf("failed to load settings: %v", err)
+	}
+	manifest.Settings = len(settings)
+	if err := add(backupSettingsFile, settings); err != nil {
+		return manifest, err
+	}
+	for _, name := range names {
+		info := BackupUser{Username: name}
+		series, err := store.LoadSeries(name)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to load series of %s: %v", name, err)
+		}
+		info.Series = len(series)
+		if err := add("series/"+name+".json", seriesFile{SchemaVersion: currentSchemaVersion, Series: series}); err != nil {
+			return manifest, err
+		}
+
+		history, err := readHistoryFile(name)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to read history of %s: %v", name, err)
+		}
+		if len(history) > 0 {
+			info.History = countLines(history)
+			entries = append(entries, entry{"history/" + name + historyFileSuffix, history})
+		}
+
+		lists, err := readListsFile(name)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to read lists of %s: %v", name, err)
+		}
+		if len(lists) > 0 {
+			var parsed []CustomList
+			json.Unmarshal(lists, &parsed)
+			info.Lists = len(parsed)
+			entries = append(entries, entry{"lists/" + name + ".json", lists})
+		}
+
+		trash, err := readTrashFile(name)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to read trash of %s: %v", name, err)
+		}
+		if len(trash) > 0 {
+			var parsed []TrashedSeries
+			json.Unmarshal(trash, &parsed)
+			info.Trash = len(parsed)
+			entries = append(entries, entry{"trash/" + name + ".json", trash})
+		}
+		manifest.Users = append(manifest.Users, info)
+	}
+
+	covers, err := readCoverFiles()
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read covers: %v", err)
+	}
+	coverNames := make([]string, 0, len(covers))
+	for name := range covers {
+		coverNames = append(coverNames, name)
+	}
+	sort.Strings(coverNames)
+	manifest.Covers = len(coverNames)
+
+	archive := zip.NewWriter(w)
+	write := func(name string, data []byte, method uint16) error {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: manifest.Created})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := write(backupManifestFile, data, zip.Deflate); err != nil {
+		return manifest, err
+	}
+	for _, e := range entries {
+		if err := write(e.name, e.data, zip.Deflate); err != nil {
+			return manifest, err
+		}
+	}
+	// Bilder sind schon komprimiert.
+	for _, name := range coverNames {
+		if err := write("covers/"+name, covers[name], zip.Store); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, archive.Close()
+}
+
+// backupSettings liefert die Einstellungen ohne die des Backends.
+func backupSettings() (map[string]string, error) {
+	all, err := store.LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]string{}
+	for key, value := range all {
+		if !backupSkipSettings[key] {
+			settings[key] = value
+		}
+	}
+	return settings, nil
+}
+
+func countLines(data []byte) int {
+	n := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// saveBackup legt eine Sicherung in data/backups ab.
+func saveBackup(kind string) (BackupFile, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	return saveBackupLocked(kind)
+}
+
+func saveBackupLocked(kind string) (BackupFile, error) {
+	var buf bytes.Buffer
+	manifest, err := writeBackup(&buf)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	return storeBackupFile(kind, manifest.Created, buf.Bytes())
+}
+
+// storeBackupFile schreibt data als <kind>-<zeitstempel>.zip. Gibt es den
+// Namen schon, wird ein Zähler angehängt, statt die Datei zu überschreiben.
+// Aufrufer halten backupMu.
+func storeBackupFile(kind string, created time.Time, data []byte) (BackupFile, error) {
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		return BackupFile{}, err
+	}
+	base := kind + "-" + created.Format(backupTimeLayout)
+	name, seq := base+".zip", 1
+	for {
+		_, err := os.Stat(filepath.Join(backupsDir, name))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return BackupFile{}, err
+		}
+		seq++
+		name = fmt.Sprintf("%s-%d.zip", base, seq)
+	}
+	if err := writeFileAtomic(filepath.Join(backupsDir, name), data); err != nil {
+		return BackupFile{}, err
+	}
+	return BackupFile{Name: name, Kind: kind, Created: created, Seq: seq, Size: int64(len(data))}, nil
+}
+
+// listBackups liefert die Sicherungen in data/backups, die neueste zuerst.
+func listBackups() ([]BackupFile, error) {
+	entries, err := os.ReadDir(backupsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []BackupFile
+	for _, entry := range entries {
+		m := validBackupName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		created, err := time.ParseInLocation(backupTimeLayout, m[2], time.Local)
+		if err != nil {
+			continue
+		}
+		seq := 1
+		if m[3] != "" {
+			if seq, err = strconv.Atoi(m[3]); err != nil {
+				continue
+			}
+		}
+		files = append(files, BackupFile{Name: entry.Name(), Kind: m[1], Created: created, Seq: seq, Size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].Created.Equal(files[j].Created) {
+			return files[i].Created.After(files[j].Created)
+		}
+		return files[i].Seq > files[j].Seq
+	})
+	return files, nil
+}
+
+// backupPath prüft den Namen einer Sicherung und liefert ihren Pfad.
+func backupPath(name string) (string, error) {
+	if !validBackupName.MatchString(name) {
+		return "", errBackupNotFound
+	}
+	file := filepath.Join(backupsDir, name)
+	if _, err := os.Stat(file); err != nil {
+		return "", errBackupNotFound
+	}
+	return file, nil
+}
+
+func deleteBackup(name string) error {
+	file, err := backupPath(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// pruneBackups behält die neuesten keep Sicherungen einer Art.
+func pruneBackups(kind string, keep int) (int, error) {
+	files, err := listBackups()
+	if err != nil {
+		return 0, err
+	}
+	removed, kept := 0, 0
+	for _, f := range files {
+		if f.Kind != kind {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		if err := os.Remove(filepath.Join(backupsDir, f.Name)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// runBackupScheduler legt alle BACKUP_INTERVAL eine Sicherung an. Nach
+// einem Neustart zählt die Wartezeit ab der letzten automatischen Sicherung.
+func runBackupScheduler() {
+	for {
+		wait := time.Duration(0)
+		if files, err := listBackups(); err == nil {
+			for _, f := range files {
+				if f.Kind == backupKindAuto {
+					wait = time.Until(f.Created.Add(backupInterval))
+					break
+				}
+			}
+		}
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		file, err := saveBackup(backupKindAuto)
+		if err != nil {
+			log.Printf("backup: scheduled backup failed: %v", err)
+			if backupInterval < backupRetryAfter {
+				time.Sleep(backupInterval)
+			} else {
+				time.Sleep(backupRetryAfter)
+			}
+			continue
+		}
+		log.Printf("backup: saved %s (%d KB)", file.Name, file.SizeKB())
+		if removed, err := pruneBackups(backupKindAuto, backupKeep); err != nil {
+			log.Printf("backup: failed to remove old backups: %v", err)
+		} else if removed > 0 {
+			log.Printf("backup: removed %d old backups", removed)
+		}
+	}
+}
+
+// --- WIEDERHERSTELLEN ---
+
+// readBackup entpackt und prüft eine Sicherung vollständig, bevor irgendetwas
+// geschrieben wird. Ältere Schema-Versionen werden dabei migriert.
+func readBackup(data []byte) (*backupArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file: %v", err)
+	}
+	files := map[string][]byte{}
+	var total int64
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip file: %v", err)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, backupMaxUnpacked-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip file: %v", err)
+		}
+		if total += int64(len(content)); total > backupMaxUnpacked {
+			return nil, fmt.Errorf("backup is larger than %d MB when unpacked", backupMaxUnpacked>>20)
+		}
+		files[f.Name] = content
+	}
+
+	archive := &backupArchive{
+		Series:  map[string][]Series{},
+		History: map[string][]byte{},
+		Lists:   map[string][]byte{},
+		Trash:   map[string][]byte{},
+		Covers:  map[string][]byte{},
+	}
+	raw, ok := files[backupManifestFile]
+	if !ok {
+		return nil, errors.New("not a backup: manifest.json is missing")
+	}
+	if err := json.Unmarshal(raw, &archive.Manifest); err != nil || archive.Manifest.Format != backupFormat {
+		return nil, errors.New("not a backup: invalid manifest.json")
+	}
+	if archive.Manifest.Version > backupFormatVersion {
+		return nil, fmt.Errorf("backup format %d is newer than this build supports (%d)", archive.Manifest.Version, backupFormatVersion)
+	}
+	if archive.Manifest.SchemaVersion > currentSchemaVersion {
+		return nil, fmt.Errorf("backup has schema version %d, this build only supports up to %d", archive.Manifest.SchemaVersion, currentSchemaVersion)
+	}
+
+	raw, ok = files[backupUsersFile]
+	if !ok {
+		return nil, errors.New("backup contains no users.json")
+	}
+	if archive.Users, err = decodeBackupUsers(raw); err != nil {
+		return nil, fmt.Errorf("users.json: %v", err)
+	}
+
+	if raw, ok := files[backupSettingsFile]; ok {
+		if err := json.Unmarshal(raw, &archive.Settings); err != nil {
+			return nil, fmt.Errorf("settings.json: %v", err)
+		}
+		if archive.Settings == nil {
+			archive.Settings = map[string]string{}
+		}
+		for key := range backupSkipSettings {
+			delete(archive.Settings, key)
+		}
+	}
+
+	for name, content := range files {
+		if name == backupManifestFile || name == backupUsersFile || name == backupSettingsFile {
+			continue
+		}
+		dir, base := path.Split(name)
+		switch dir {
+		case "series/":
+			username := strings.TrimSuffix(base, ".json")
+			if _, ok := archive.Users[username]; !ok || !strings.HasSuffix(base, ".json") {
+				return nil, fmt.Errorf("%s: unknown user", name)
+			}
+			series, err := decodeBackupSeries(username, content)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			archive.Series[username] = series
+		case "history/":
+			username := strings.TrimSuffix(base, historyFileSuffix)
+			if _, ok := archive.Users[username]; !ok || !strings.HasSuffix(base, historyFileSuffix) {
+				return nil, fmt.Errorf("%s: unknown user", name)
+			}
+			for i, line := range bytes.Split(content, []byte("\n")) {
+				if len(bytes.TrimSpace(line)) == 0 {
+					continue
+				}
+				var event WatchEvent
+				if err := json.Unmarshal(line, &event); err != nil {
+					return nil, fmt.Errorf("%s line %d: %v", name, i+1, err)
+				}
+			}
+			archive.History[username] = content
+		case "lists/":
+			username := strings.TrimSuffix(base, ".json")
+			if _, ok := archive.Users[username]; !ok || !strings.HasSuffix(base, ".json") {
+				return nil, fmt.Errorf("%s: unknown user", name)
+			}
+			var lists []CustomList
+			if err := json.Unmarshal(content, &lists); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			archive.Lists[username] = content
+		case "trash/":
+			username := strings.TrimSuffix(base, ".json")
+			if _, ok := archive.Users[username]; !ok || !strings.HasSuffix(base, ".json") {
+				return nil, fmt.Errorf("%s: unknown user", name)
+			}
+			var trash []TrashedSeries
+			if err := json.Unmarshal(content, &trash); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			archive.Trash[username] = content
+		case "covers/":
+			if !coverOriginalName.MatchString(base) {
+				return nil, fmt.Errorf("%s: invalid cover file name", name)
+			}
+			archive.Covers[base] = content
+		default:
+			return nil, fmt.Errorf("unexpected file %s in backup", name)
+		}
+	}
+	return archive, nil
+}
+
+// decodeBackupUsers liest users.json einer Sicherung und prüft die Namen.
+func decodeBackupUsers(data []byte) (map[string]User, error) {
+	version, payload, err := decodeVersioned(data, "users")
+	if err != nil {
+		return nil, err
+	}
+	if version > currentSchemaVersion {
+		return nil, fmt.Errorf("schema version %d is not supported", version)
+	}
+	if version < currentSchemaVersion {
+		var docs map[string]rawDoc
+		if err := json.Unmarshal(payload, &docs); err != nil {
+			return nil, err
+		}
+		if err := migrateUserDocs(docs, version, nil); err != nil {
+			return nil, err
+		}
+		if payload, err = json.Marshal(docs); err != nil {
+			return nil, err
+		}
+	}
+	var result map[string]User
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return nil, err
+	}
+	admins := 0
+	for name, u := range result {
+		if err := checkUsername(name); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if u.IsAdmin {
+			admins++
+		}
+	}
+	if admins == 0 {
+		return nil, errLastAdmin
+	}
+	return result, nil
+}
+
+// decodeBackupSeries liest eine Serienliste einer Sicherung.
+func decodeBackupSeries(username string, data []byte) ([]Series, error) {
+	version, payload, err := decodeVersioned(data, "series")
+	if err != nil {
+		return nil, err
+	}
+	if version > currentSchemaVersion {
+		return nil, fmt.Errorf("schema version %d is not supported", version)
+	}
+	if len(payload) == 0 || string(payload) == "null" {
+		return nil, nil
+	}
+	if version < currentSchemaVersion {
+		var docs []rawDoc
+		if err := json.Unmarshal(payload, &docs); err != nil {
+			return nil, err
+		}
+		if docs, err = migrateSeriesDocs(username, docs, version, nil); err != nil {
+			return nil, err
+		}
+		if payload, err = json.Marshal(docs); err != nil {
+			return nil, err
+		}
+	}
+	var series []Series
+	if err := json.Unmarshal(payload, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// readBackupFile liest eine Sicherung aus data/backups.
+func readBackupFile(name string) (*backupArchive, error) {
+	file, err := backupPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return readBackup(data)
+}
+
+// previewBackup stellt den Inhalt der Sicherung dem aktuellen Stand gegenüber.
+func previewBackup(name string, archive *backupArchive) *BackupPreview {
+	preview := &BackupPreview{
+		File:          name,
+		Created:       archive.Manifest.Created,
+		SchemaVersion: archive.Manifest.SchemaVersion,
+		Settings:      len(archive.Settings),
+		HasSettings:   archive.Settings != nil,
+		Covers:        len(archive.Covers),
+	}
+	for username, u := range archive.Users {
+		row := BackupPreviewUser{
+			Username:    username,
+			DisplayName: u.DisplayName,
+			IsAdmin:     u.IsAdmin,
+			Series:      len(archive.Series[username]),
+			History:     countLines(archive.History[username]),
+		}
+		if lists := archive.Lists[username]; len(lists) > 0 {
+			var parsed []CustomList
+			json.Unmarshal(lists, &parsed)
+			row.Lists = len(parsed)
+		}
+		if _, exists := getUser(username); exists {
+			row.CurrentSeries = len(loadSeriesForUser(username))
+		} else {
+			row.New = true
+		}
+		preview.Users = append(preview.Users, row)
+	}
+	sort.Slice(preview.Users, func(i, j int) bool {
+		return preview.Users[i].Username < preview.Users[j].Username
+	})
+	for _, entry := range listUsers() {
+		if _, ok := archive.Users[entry.Username]; !ok {
+			preview.Removed = append(preview.Removed, entry)
+		}
+	}
+	return preview
+}
+
+// checkBackupAdmin verhindert, dass sich der Admin durch die
+// Wiederherstellung selbst aussperrt.
+func checkBackupAdmin(archive *backupArchive, admin string) error {
+	if u, ok := archive.Users[admin]; !ok || !u.IsAdmin {
+		return errBackupLockout
+	}
+	return nil
+}
+
+// restoreBackup ersetzt alle Nutzer und ihre Daten durch die der Sicherung.
+// Vorher wird der aktuelle Stand als pre-restore-<zeitstempel>.zip
+// gesichert. Alle Sitzungen außer keepSession werden beendet, da sich
+// Passwörter und Nutzer geändert haben können.
+func restoreBackup(archive *backupArchive, keepSession string) (BackupFile, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	before, err := saveBackupLocked(backupKindRestore)
+	if err != nil {
+		return before, fmt.Errorf("failed to back up current data: %v", err)
+	}
+	previous := listUsers()
+
+	for name := range archive.Users {
+		if series := archive.Series[name]; len(series) > 0 {
+			err = store.SaveSeries(name, series)
+		} else {
+			err = store.DeleteSeries(name)
+		}
+		if err != nil {
+			return before, fmt.Errorf("failed to restore series of %s: %v", name, err)
+		}
+	}
+	err = updateUsers(func(all map[string]User) error {
+		for name := range all {
+			delete(all, name)
+		}
+		for name, u := range archive.Users {
+			all[name] = u
+		}
+		return nil
+	})
+	if err != nil {
+		return before, fmt.Errorf("failed to restore users: %v", err)
+	}
+
+	for _, entry := range previous {
+		if _, ok := archive.Users[entry.Username]; ok {
+			continue
+		}
+		if err := store.DeleteSeries(entry.Username); err != nil {
+			return before, fmt.Errorf("failed to delete series of %s: %v", entry.Username, err)
+		}
+		if err := deleteHistory(entry.Username); err != nil {
+			return before, fmt.Errorf("failed to delete history of %s: %v", entry.Username, err)
+		}
+		if err := deleteLists(entry.Username); err != nil {
+			return before, fmt.Errorf("failed to delete lists of %s: %v", entry.Username, err)
+		}
+		if err := deleteTrash(entry.Username); err != nil {
+			return before, fmt.Errorf("failed to delete trash of %s: %v", entry.Username, err)
+		}
+	}
+	for name := range archive.Users {
+		if err := replaceHistory(name, archive.History[name]); err != nil {
+			return before, fmt.Errorf("failed to restore history of %s: %v", name, err)
+		}
+		if err := replaceLists(name, archive.Lists[name]); err != nil {
+			return before, fmt.Errorf("failed to restore lists of %s: %v", name, err)
+		}
+		if err := replaceTrash(name, archive.Trash[name]); err != nil {
+			return before, fmt.Errorf("failed to restore trash of %s: %v", name, err)
+		}
+	}
+	// Ältere Sicherungen ohne settings.json lassen die Einstellungen unverändert.
+	for key, value := range archive.Settings {
+		if err := store.SetSetting(key, value); err != nil {
+			return before, fmt.Errorf("failed to restore setting %s: %v", key, err)
+		}
+	}
+	if err := restoreCovers(archive.Covers); err != nil {
+		return before, fmt.Errorf("failed to restore covers: %v", err)
+	}
+
+	for _, entry := range previous {
+		if err := revokeUserSessions(entry.Username, keepSession); err != nil {
+			log.Printf("backup: failed to revoke sessions of %s: %v", entry.Username, err)
+		}
+	}
+	return before, nil
+}
+
+// --- HANDLER ---
+
+func backupOverview() *BackupOverview {
+	files, err := listBackups()
+	if err != nil {
+		log.Printf("backup: failed to list backups: %v", err)
+	}
+	return &BackupOverview{Files: files, Interval: backupInterval, Keep: backupKeep}
+}
+
+// backupAction führt die Sicherungs-Aktionen des Admin-Panels aus. Eine
+// Vorschau wird zurückgegeben, wenn die Aktion eine anzeigen soll.
+func backupAction(r *http.Request, admin, session string) (string, *BackupPreview, error) {
+	name := r.FormValue("file")
+	switch r.FormValue("action") {
+	case "backup_create":
+		file, err := saveBackup(backupKindManual)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("Sicherung %s angelegt (%d KB)", file.Name, file.SizeKB()), nil, nil
+	case "backup_delete":
+		if err := deleteBackup(name); err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("Sicherung %s gelöscht", name), nil, nil
+	case "restore_upload":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return "", nil, errors.New("please choose a backup file")
+		}
+		defer file.Close()
+		if header.Size > backupMaxBytes {
+			return "", nil, fmt.Errorf("backup is larger than %d MB", backupMaxBytes>>20)
+		}
+		data, err := io.ReadAll(io.LimitReader(file, backupMaxBytes))
+		if err != nil {
+			return "", nil, err
+		}
+		archive, err := readBackup(data)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := checkBackupAdmin(archive, admin); err != nil {
+			return "", nil, err
+		}
+		backupMu.Lock()
+		stored, err := storeBackupFile(backupKindUpload, time.Now(), data)
+		backupMu.Unlock()
+		if err != nil {
+			return "", nil, err
+		}
+		return "Sicherung geprüft – bitte die Vorschau kontrollieren", previewBackup(stored.Name, archive), nil
+	case "restore_preview":
+		archive, err := readBackupFile(name)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := checkBackupAdmin(archive, admin); err != nil {
+			return "", nil, err
+		}
+		return "Sicherung geprüft – bitte die Vorschau kontrollieren", previewBackup(name, archive), nil
+	case "restore":
+		archive, err := readBackupFile(name)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := checkBackupAdmin(archive, admin); err != nil {
+			return "", nil, err
+		}
+		before, err := restoreBackup(archive, session)
+		if err != nil {
+			if before.Name != "" {
+				log.Printf("backup: restore of %s failed, previous data is in %s", name, before.Name)
+			}
+			return "", nil, err
+		}
+		return fmt.Sprintf("Sicherung vom %s wiederhergestellt (%d Nutzer), der vorherige Stand liegt in %s",
+			archive.Manifest.Created.Local().Format("02.01.2006 15:04"), len(archive.Users), before.Name), nil, nil
+	}
+	return "", nil, errors.New("unknown action")
+}
+
+// backupDownloadHandler liefert /admin/backup als frische Sicherung oder mit
+// ?file=<name> eine Sicherung aus data/backups.
+func backupDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("file"); name != "" {
+		file, err := backupPath(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, "failed to read backup", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename="+name)
+		http.ServeContent(w, r, name, info.ModTime(), f)
+		return
+	}
+
+	user, _ := getCurrentUser(r)
+	var buf bytes.Buffer
+	backupMu.Lock()
+	manifest, err := writeBackup(&buf)
+	backupMu.Unlock()
+	if err != nil {
+		log.Printf("backup: download by %s failed: %v", user, err)
+		http.Error(w, "failed to create backup", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("backup: downloaded by %s", user)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=serien-tracker-"+manifest.Created.Format(backupTimeLayout)+".zip")
+	w.Write(buf.Bytes())
+}
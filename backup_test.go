@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTestData legt für den Test ein leeres data/ in einem temporären
+// Verzeichnis an und setzt Speicher und Nutzer danach zurück.
+func useTestData(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	previousStore, previousUsers := store, users
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		store = previousStore
+		usersMu.Lock()
+		users = previousUsers
+		usersMu.Unlock()
+	})
+	js, err := newJSONStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = js
+	usersMu.Lock()
+	users = map[string]User{}
+	usersMu.Unlock()
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	useTestData(t)
+	err := updateUsers(func(all map[string]User) error {
+		all["anna"] = User{DisplayName: "Anna", IsAdmin: true}
+		all["ben"] = User{DisplayName: "Ben"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dark := Series{ID: 1, IMDBID: "tt5753856", Title: "Dark", EpisodesWatched: 3, TotalEpisodes: 26, Status: statusWatching}
+	fargo := Series{ID: 2, IMDBID: "tt2802850", Title: "Fargo", Status: statusPlanToWatch}
+	if err := store.SaveSeries("anna", []Series{dark, fargo}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSeries("ben", []Series{{ID: 1, IMDBID: "tt0411008", Title: "Lost"}}); err != nil {
+		t.Fatal(err)
+	}
+	watched := WatchEvent{Action: actionWatched, SeriesID: 1, IMDBID: dark.IMDBID, Season: 1, Episode: 1, WatchedAt: time.Now().Add(-time.Hour)}
+	if err := appendHistory("anna", watched); err != nil {
+		t.Fatal(err)
+	}
+	list, err := createList("anna", "Lieblinge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addToList("anna", list.ID, dark.IMDBID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trashSeries("anna", fargo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetSetting("default_theme", "apple"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetSetting("json_imported", "true"); err != nil {
+		t.Fatal(err)
+	}
+	cover := []byte("not really a jpeg")
+	if err := os.MkdirAll(coversDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(coversDir, "tt5753856.jpg"), cover, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := saveBackup(backupKindManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Danach geht einiges verloren oder ändert sich.
+	err = updateUsers(func(all map[string]User) error {
+		delete(all, "ben")
+		all["carl"] = User{DisplayName: "Carl"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSeries("anna", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteHistory("anna"); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteLists("anna"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := emptyTrash("anna"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetSetting("default_theme", "netflix"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(coversDir, "tt5753856.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := readBackupFile(saved.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBackupAdmin(archive, "anna"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := archive.Settings["json_imported"]; ok {
+		t.Error("backend setting json_imported was backed up")
+	}
+	preview := previewBackup(saved.Name, archive)
+	if len(preview.Removed) != 1 || preview.Removed[0].Username != "carl" {
+		t.Errorf("preview removes %+v, want carl", preview.Removed)
+	}
+	if !preview.HasSettings || preview.Settings != 1 {
+		t.Errorf("preview settings = %d (%v), want 1", preview.Settings, preview.HasSettings)
+	}
+	before, err := restoreBackup(archive, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := getUser("ben"); !ok {
+		t.Error("ben was not restored")
+	}
+	if _, ok := getUser("carl"); ok {
+		t.Error("carl still exists")
+	}
+	if series := loadSeriesForUser("anna"); len(series) != 1 || series[0].Title != "Dark" || series[0].EpisodesWatched != 3 {
+		t.Errorf("anna's series = %+v, want Dark with 3 episodes", series)
+	}
+	if series := loadSeriesForUser("ben"); len(series) != 1 {
+		t.Errorf("ben's series = %+v, want Lost", series)
+	}
+	if events, err := loadHistory("anna"); err != nil || len(events) != 1 || events[0].IMDBID != dark.IMDBID {
+		t.Errorf("history = %+v (%v), want one event", events, err)
+	}
+	if lists, err := loadLists("anna"); err != nil || len(lists) != 1 || !lists[0].Contains(dark.IMDBID) {
+		t.Errorf("lists = %+v (%v), want Lieblinge with Dark", lists, err)
+	}
+	if trash, err := loadTrash("anna"); err != nil || len(trash) != 1 || trash[0].Series.Title != "Fargo" {
+		t.Errorf("trash = %+v (%v), want Fargo", trash, err)
+	}
+	if value, _, _ := store.GetSetting("default_theme"); value != "apple" {
+		t.Errorf("setting default_theme = %q, want apple", value)
+	}
+	if data, err := os.ReadFile(filepath.Join(coversDir, "tt5753856.jpg")); err != nil || !bytes.Equal(data, cover) {
+		t.Errorf("cover was not restored: %v", err)
+	}
+
+	// Der vorherige Stand liegt als eigene Sicherung daneben.
+	if before.Kind != backupKindRestore {
+		t.Errorf("previous state kind = %q, want %q", before.Kind, backupKindRestore)
+	}
+	previous, err := readBackupFile(before.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := previous.Users["carl"]; !ok {
+		t.Error("pre-restore backup does not contain carl")
+	}
+}
+
+func TestRestoreRejectsLockout(t *testing.T) {
+	useTestData(t)
+	err := updateUsers(func(all map[string]User) error {
+		all["anna"] = User{DisplayName: "Anna", IsAdmin: true}
+		all["ben"] = User{DisplayName: "Ben"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := writeBackup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := readBackup(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBackupAdmin(archive, "ben"); err != errBackupLockout {
+		t.Errorf("err = %v, want lockout for a non-admin", err)
+	}
+}
+
+func TestReadBackupRejectsInvalidArchives(t *testing.T) {
+	manifest := `{"format":"serien-tracker-backup","version":1,"schema_version":3}`
+	users := `{"schema_version":3,"users":{"anna":{"display_name":"Anna","is_admin":true}}}`
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no manifest", map[string]string{"users.json": users}},
+		{"foreign manifest", map[string]string{"manifest.json": `{"format":"other"}`, "users.json": users}},
+		{"newer format", map[string]string{"manifest.json": `{"format":"serien-tracker-backup","version":99}`, "users.json": users}},
+		{"no users", map[string]string{"manifest.json": manifest}},
+		{"no admin", map[string]string{"manifest.json": manifest, "users.json": `{"schema_version":3,"users":{"anna":{}}}`}},
+		{"unknown user", map[string]string{"manifest.json": manifest, "users.json": users, "series/ben.json": `[]`}},
+		{"path traversal", map[string]string{"manifest.json": manifest, "users.json": users, "series/../../anna.json": `[]`}},
+		{"invalid cover name", map[string]string{"manifest.json": manifest, "users.json": users, "covers/../x.jpg": "x"}},
+		{"invalid settings", map[string]string{"manifest.json": manifest, "users.json": users, "settings.json": `[1]`}},
+	}
+	for _, tt := range tests {
+		if _, err := readBackup(zipFiles(t, tt.files)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+	if _, err := readBackup([]byte("no zip")); err == nil {
+		t.Error("no zip: no error")
+	}
+}
+
+func TestReadBackupMigratesOldSchema(t *testing.T) {
+	data := zipFiles(t, map[string]string{
+		"manifest.json":    `{"format":"serien-tracker-backup","version":1,"schema_version":1}`,
+		"users.json":       `{"anna":{"display_name":"Anna","is_admin":true}}`,
+		"series/anna.json": `[{"id":1,"title":"Dark","episodes_watched":26,"total_episodes":26,"status":"Watching"}]`,
+	})
+	archive, err := readBackup(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Settings != nil {
+		t.Errorf("settings = %v, want nil for a backup without settings.json", archive.Settings)
+	}
+	series := archive.Series["anna"]
+	if len(series) != 1 || series[0].Status != statusCompleted || series[0].Progress != 100 {
+		t.Errorf("series = %+v, want Dark completed", series)
+	}
+}
+
+func TestStoreBackupFileKeepsSameSecond(t *testing.T) {
+	useTestData(t)
+	created := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	first, err := storeBackupFile(backupKindManual, created, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := storeBackupFile(backupKindManual, created, []byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name == second.Name {
+		t.Fatalf("both backups are named %s", first.Name)
+	}
+	files, err := listBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != second.Name {
+		t.Errorf("backups = %+v, want %s first", files, second.Name)
+	}
+	if _, err := backupPath(second.Name); err != nil {
+		t.Errorf("backupPath(%s): %v", second.Name, err)
+	}
+
+	removed, err := pruneBackups(backupKindManual, 1)
+	if err != nil || removed != 1 {
+		t.Fatalf("pruned %d (%v), want 1", removed, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(backupsDir, second.Name)); err != nil || string(data) != "second" {
+		t.Errorf("the newest backup was not kept: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- METADATEN-CACHE ---
+
+// Antworten der Metadaten-Anbieter werden unter data/cache/metadata/
+// abgelegt, damit nicht jedes Hinzufügen und jede Suche das Tageslimit
+// eines API-Keys belastet.
+// Ist ein Eintrag älter als seine TTL, aber noch innerhalb des
+// Stale-Fensters, wird er sofort ausgeliefert und im Hintergrund erneuert.
+// Schlägt ein Abruf fehl, wird notfalls auch ein abgelaufener Eintrag
+// genutzt.
+
+const (
+	cacheKindTitle  = "title"
+	cacheKindSeason = "season"
+	cacheKindSearch = "search"
+
+	metadataCacheSubdir = "cache/metadata"
+	cacheFileSuffix     = ".json"
+	cacheHashedChars    = 16
+)
+
+var (
+	// Die Laufzeiten gelten für alle Anbieter. Die früheren Namen
+	// OMDB_CACHE_* werden weiterhin gelesen, falls METADATA_CACHE_* fehlt.
+	cacheTTL = map[string]time.Duration{
+		cacheKindTitle:  envDuration("METADATA_CACHE_TTL_TITLE", envDuration("OMDB_CACHE_TTL_TITLE", 7*24*time.Hour)),
+		cacheKindSeason: envDuration("METADATA_CACHE_TTL_SEASON", envDuration("OMDB_CACHE_TTL_SEASON", 24*time.Hour)),
+		cacheKindSearch: envDuration("METADATA_CACHE_TTL_SEARCH", envDuration("OMDB_CACHE_TTL_SEARCH", 24*time.Hour)),
+	}
+	cacheStaleWindow = envDuration("METADATA_CACHE_STALE", envDuration("OMDB_CACHE_STALE", 7*24*time.Hour))
+
+	unsafeCacheChars = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+	metadataCache = &responseCache{
+		dir:        filepath.Join(dataDir, metadataCacheSubdir),
+		refreshing: map[string]bool{},
+		since:      time.Now(),
+	}
+)
+
+type cacheEntry struct {
+	Key     string          `json:"key"`
+	Kind    string          `json:"kind"`
+	Fetched time.Time       `json:"fetched"`
+	Body    json.RawMessage `json:"body"`
+}
+
+type responseCache struct {
+	// Die Zähler stehen vorne, damit sie auch auf 32-Bit-Systemen (z. B.
+	// Raspberry Pi) für sync/atomic korrekt ausgerichtet sind.
+	hits, staleHits, misses, errors int64
+
+	dir   string
+	since time.Time
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+// CacheStats wird im Admin-Panel angezeigt.
+type CacheStats struct {
+	Since     time.Time
+	Hits      int64
+	StaleHits int64
+	Misses    int64
+	Errors    int64
+	Entries   map[string]int
+	Expired   int
+	SizeKB    int64
+}
+
+// HitRate liefert den Anteil der Anfragen, die ohne Abruf beim Anbieter
+// auskamen.
+func (s CacheStats) HitRate() int {
+	total := s.Hits + s.StaleHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return int((s.Hits + s.StaleHits) * 100 / total)
+}
+
+// cacheName baut aus Art und Schlüssel einen Dateinamen. IMDb-IDs bleiben
+// lesbar, damit sich einzelne Serien gezielt entfernen lassen; Suchbegriffe
+// werden gehasht. Andere Anbieter als OMDb stehen als zweiter Teil im Namen,
+// z. B. "season-tvmaze-tt0903747".
+func cacheName(kind string, parts ...string) string {
+	return kind + "-" + strings.Join(parts, "-")
+}
+
+func hashedCacheKey(value string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(sum[:])[:cacheHashedChars]
+}
+
+func safeCacheKey(value string) string {
+	return unsafeCacheChars.ReplaceAllString(value, "")
+}
+
+func (c *responseCache) file(name string) string {
+	return filepath.Join(c.dir, name+cacheFileSuffix)
+}
+
+func (c *responseCache) read(name string) (cacheEntry, bool) {
+	data, err := os.ReadFile(c.file(name))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("cache: ignoring unreadable entry %s: %v", name, err)
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *responseCache) write(name, kind string, body []byte) {
+	if !isCacheable(body) {
+		return
+	}
+	data, err := json.Marshal(cacheEntry{Key: name, Kind: kind, Fetched: time.Now(), Body: body})
+	if err != nil {
+		log.Printf("cache: failed to encode %s: %v", name, err)
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		log.Printf("cache: failed to create %s: %v", c.dir, err)
+		return
+	}
+	if err := writeFileAtomic(c.file(name), data); err != nil {
+		log.Printf("cache: %v", err)
+	}
+}
+
+// isCacheable speichert nur erfolgreiche Antworten; "nicht gefunden" oder
+// ein ungültiger Key sollen beim nächsten Versuch neu geprüft werden. OMDb
+// meldet Fehler mit Status 200 und "Response": "False", die anderen Anbieter
+// über den Statuscode, sodass fetch dann gar keinen Inhalt liefert.
+func isCacheable(body []byte) bool {
+	if !json.Valid(body) {
+		return false
+	}
+	var result struct {
+		Response string `json:"Response"`
+	}
+	if json.Unmarshal(body, &result) != nil {
+		// z. B. ein Array mit Suchergebnissen
+		return true
+	}
+	return result.Response != "False"
+}
+
+// get liefert die Antwort für name aus dem Cache oder ruft sie mit fetch ab.
+func (c *responseCache) get(kind, name string, fetch func() ([]byte, error)) ([]byte, error) {
+	entry, cached := c.read(name)
+	age := time.Since(entry.Fetched)
+	ttl := cacheTTL[kind]
+
+	switch {
+	case cached && age < ttl:
+		atomic.AddInt64(&c.hits, 1)
+		return entry.Body, nil
+	case cached && age < ttl+cacheStaleWindow:
+		atomic.AddInt64(&c.staleHits, 1)
+		c.revalidate(kind, name, fetch)
+		return entry.Body, nil
+	}
+
+	atomic.AddInt64(&c.misses, 1)
+	body, err := fetch()
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+		if cached {
+			log.Printf("cache: fetch failed for %s, using entry from %s: %v", name, entry.Fetched.Format(time.RFC3339), err)
+			return entry.Body, nil
+		}
+		return nil, err
+	}
+	c.write(name, kind, body)
+	return body, nil
+}
+
+// revalidate erneuert einen Eintrag im Hintergrund, höchstens einmal
+// gleichzeitig pro Eintrag.
+func (c *responseCache) revalidate(kind, name string, fetch func() ([]byte, error)) {
+	c.mu.Lock()
+	if c.refreshing[name] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[name] = true
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, name)
+			c.mu.Unlock()
+		}()
+		body, err := fetch()
+		if err != nil {
+			atomic.AddInt64(&c.errors, 1)
+			log.Printf("cache: background refresh of %s failed: %v", name, err)
+			return
+		}
+		c.write(name, kind, body)
+	}()
+}
+
+// remove löscht alle Einträge, für die match true liefert.
+func (c *responseCache) remove(match func(name string, entry cacheEntry) bool) (int, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*"+cacheFileSuffix))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), cacheFileSuffix)
+		entry, _ := c.read(name)
+		if !match(name, entry) {
+			continue
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (c *responseCache) purgeAll() (int, error) {
+	return c.remove(func(string, cacheEntry) bool { return true })
+}
+
+// purgeExpired entfernt Einträge, die auch als veraltete Antwort nicht
+// mehr ausgeliefert würden.
+func (c *responseCache) purgeExpired() (int, error) {
+	return c.remove(func(_ string, entry cacheEntry) bool {
+		return time.Since(entry.Fetched) >= cacheTTL[entry.Kind]+cacheStaleWindow
+	})
+}
+
+// invalidateIMDB entfernt Titel und Staffeln einer Serie bei allen
+// Anbietern, z. B. bevor die Staffeln auf Wunsch neu geladen werden.
+func (c *responseCache) invalidateIMDB(imdbID string) (int, error) {
+	id := safeCacheKey(imdbID)
+	if id == "" {
+		return 0, nil
+	}
+	return c.remove(func(name string, _ cacheEntry) bool {
+		parts := strings.Split(name, "-")
+		if parts[0] != cacheKindTitle && parts[0] != cacheKindSeason {
+			return false
+		}
+		for _, part := range parts[1:] {
+			if part == id {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (c *responseCache) stats() CacheStats {
+	s := CacheStats{
+		Since:     c.since,
+		Hits:      atomic.LoadInt64(&c.hits),
+		StaleHits: atomic.LoadInt64(&c.staleHits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Errors:    atomic.LoadInt64(&c.errors),
+		Entries:   map[string]int{},
+	}
+	files, _ := filepath.Glob(filepath.Join(c.dir, "*"+cacheFileSuffix))
+	var size int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		size += info.Size()
+		name := strings.TrimSuffix(filepath.Base(file), cacheFileSuffix)
+		entry, ok := c.read(name)
+		if !ok {
+			continue
+		}
+		s.Entries[entry.Kind]++
+		if time.Since(entry.Fetched) >= cacheTTL[entry.Kind] {
+			s.Expired++
+		}
+	}
+	s.SizeKB = (size + 1023) / 1024
+	return s
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// --- KALENDER ---
+
+// Die Ausstrahlungsdaten stehen als Released an jeder Episode. Damit neu
+// angekündigte Folgen auftauchen, lädt ein Hintergrund-Job die Staffeln
+// aller Serien mit Status "Watching" regelmäßig neu. /calendar zeigt die
+// nächsten und zuletzt erschienenen Folgen, /calendar.ics liefert sie als
+// abonnierbaren Kalender.
+
+const (
+	calendarDateLayout  = "2006-01-02"
+	calendarTokenPrefix = "cal_"
+
+	calendarPastDays   = 14
+	calendarFutureDays = 60
+	feedPastDays       = 30
+	feedFutureDays     = 365
+)
+
+var (
+	episodeRefreshInterval = envDuration("EPISODE_REFRESH_INTERVAL", 24*time.Hour)
+
+	errNoCalendarToken = errors.New("no calendar feed set up")
+)
+
+// CalendarEntry ist eine Episode mit bekanntem Ausstrahlungsdatum.
+type CalendarEntry struct {
+	SeriesID    int
+	SeriesTitle string
+	IMDBID      string
+	Season      int
+	Episode     int
+	Title       string
+	Date        time.Time
+	Watched     bool
+}
+
+// Code liefert die übliche Schreibweise "S01E02".
+func (e CalendarEntry) Code() string {
+	return fmt.Sprintf("S%02dE%02d", e.Season, e.Episode)
+}
+
+// DaysLabel beschreibt den Abstand zu heute, z. B. "morgen" oder "vor 3 Tagen".
+func (e CalendarEntry) DaysLabel() string {
+	days := int(math.Round(e.Date.Sub(today()).Hours() / 24))
+	switch {
+	case days == 0:
+		return "heute"
+	case days == 1:
+		return "morgen"
+	case days == -1:
+		return "gestern"
+	case days > 1:
+		return fmt.Sprintf("in %d Tagen", days)
+	default:
+		return fmt.Sprintf("vor %d Tagen", -days)
+	}
+}
+
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// calendarEntries sammelt die Episoden laufender Serien, die zwischen from
+// und to (einschließlich) erscheinen, sortiert nach Datum.
+func calendarEntries(series []Series, from, to time.Time) []CalendarEntry {
+	entries := []CalendarEntry{}
+	for _, s := range series {
+		if s.Status != statusWatching {
+			continue
+		}
+		for _, season := range s.Seasons {
+			for _, e := range season.Episodes {
+				date, err := time.ParseInLocation(calendarDateLayout, e.Released, time.Local)
+				if err != nil || date.Before(from) || date.After(to) {
+					continue
+				}
+				entries = append(entries, CalendarEntry{
+					SeriesID:    s.ID,
+					SeriesTitle: s.Title,
+					IMDBID:      s.IMDBID,
+					Season:      season.Number,
+					Episode:     e.Number,
+					Title:       e.Title,
+					Date:        date,
+					Watched:     e.Watched,
+				})
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+		if entries[i].SeriesTitle != entries[j].SeriesTitle {
+			return entries[i].SeriesTitle < entries[j].SeriesTitle
+		}
+		if entries[i].Season != entries[j].Season {
+			return entries[i].Season < entries[j].Season
+		}
+		return entries[i].Episode < entries[j].Episode
+	})
+	return entries
+}
+
+// runEpisodeRefresher lädt die Staffeln laufender Serien in Abständen neu.
+// Die Abfragen gehen über den Metadaten-Cache, sodass mehrere Nutzer mit
+// derselben Serie den Anbieter nur einmal belasten.
+func runEpisodeRefresher() {
+	for {
+		refreshWatchingSeries()
+		time.Sleep(episodeRefreshInterval)
+	}
+}
+
+func refreshWatchingSeries() {
+	if len(metadata) == 0 {
+		return
+	}
+	fetched := map[string][]Season{}
+	infos := map[string]*SeriesInfo{}
+	for _, entry := range listUsers() {
+		for _, s := range loadSeriesForUser(entry.Username) {
+			if s.Status != statusWatching || s.IMDBID == "" {
+				continue
+			}
+			seasons, ok := fetched[s.IMDBID]
+			if !ok {
+				var err error
+				seasons, err = fetchSeriesSeasons(s.IMDBID)
+				if err != nil {
+					log.Printf("calendar: failed to refresh %s: %v", s.IMDBID, err)
+				}
+				fetched[s.IMDBID] = seasons
+			}
+			if len(seasons) == 0 {
+				continue
+			}
+			info, ok := infos[s.IMDBID]
+			if !ok && (s.Runtime == 0 || len(s.Genres) == 0) {
+				// Ältere Einträge bekommen Laufzeit und Genres nachgetragen.
+				info, _ = metadata.Lookup(s.IMDBID)
+				infos[s.IMDBID] = info
+			}
+			err := updateOneSeries(entry.Username, s.ID, "", func(s *Series) error {
+				// mergeSeasons übernimmt den Baum, daher eine eigene Kopie.
+				mergeSeasons(s, copySeasons(seasons))
+				applySeriesInfo(s, info)
+				return nil
+			})
+			if err != nil && err != errSeriesNotFound {
+				log.Printf("calendar: failed to update %s for %s: %v", s.IMDBID, entry.Username, err)
+			}
+		}
+	}
+}
+
+func copySeasons(seasons []Season) []Season {
+	copied := make([]Season, len(seasons))
+	for i, season := range seasons {
+		copied[i] = Season{Number: season.Number, Episodes: append([]Episode(nil), season.Episodes...)}
+	}
+	return copied
+}
+
+// --- FEED-TOKEN ---
+
+// Kalender-Apps können keine Header mitschicken, daher steht das Token in
+// der URL. Es berechtigt nur zum Lesen des Kalenders und wird wie die
+// API-Tokens nur als Hash gespeichert.
+
+func createCalendarToken(username string) (string, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	token := calendarTokenPrefix + secret
+	err = updateUsers(func(all map[string]User) error {
+		u, exists := all[username]
+		if !exists {
+			return errUserNotFound
+		}
+		u.CalendarTokenHash = hashAPIToken(token)
+		all[username] = u
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func revokeCalendarToken(username string) error {
+	return updateUsers(func(all map[string]User) error {
+		u, exists := all[username]
+		if !exists {
+			return errUserNotFound
+		}
+		if u.CalendarTokenHash == "" {
+			return errNoCalendarToken
+		}
+		u.CalendarTokenHash = ""
+		all[username] = u
+		return nil
+	})
+}
+
+func lookupCalendarToken(token string) (string, bool) {
+	if !strings.HasPrefix(token, calendarTokenPrefix) {
+		return "", false
+	}
+	hash := hashAPIToken(token)
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	for name, u := range users {
+		if u.CalendarTokenHash == hash {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// calendarFeedURL baut die Adresse des Feeds für die aktuelle Anfrage.
+func calendarFeedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/calendar.ics?token=" + url.QueryEscape(token)
+}
+
+// --- ICS ---
+
+// icsEscape maskiert Text nach RFC 5545.
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icsLine faltet Zeilen nach 75 Bytes, ohne UTF-8-Zeichen zu zerteilen.
+func icsLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Das Leerzeichen am Anfang der Folgezeile zählt mit.
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func buildICS(name string, entries []CalendarEntry) string {
+	var b strings.Builder
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//series-tracker//Serien Tracker//DE")
+	icsLine(&b, "CALSCALE:GREGORIAN")
+	icsLine(&b, "METHOD:PUBLISH")
+	icsLine(&b, "X-WR-CALNAME:"+icsEscape("Serien – "+name))
+	icsLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT12H")
+	for _, e := range entries {
+		summary := fmt.Sprintf("%s %s", e.SeriesTitle, e.Code())
+		if e.Title != "" {
+			summary += " – " + e.Title
+		}
+		icsLine(&b, "BEGIN:VEVENT")
+		icsLine(&b, fmt.Sprintf("UID:%s-s%de%d@series-tracker", safeCacheKey(e.IMDBID), e.Season, e.Episode))
+		icsLine(&b, "DTSTAMP:"+stamp)
+		icsLine(&b, "DTSTART;VALUE=DATE:"+e.Date.Format("20060102"))
+		icsLine(&b, "DTEND;VALUE=DATE:"+e.Date.AddDate(0, 0, 1).Format("20060102"))
+		icsLine(&b, "SUMMARY:"+icsEscape(summary))
+		icsLine(&b, "TRANSP:TRANSPARENT")
+		icsLine(&b, "END:VEVENT")
+	}
+	icsLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// --- HANDLER ---
+
+func calendarHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+
+	if r.Method == "POST" {
+		var err error
+		switch r.FormValue("action") {
+		case "feed_create":
+			var token string
+			token, err = createCalendarToken(user)
+			if err == nil {
+				log.Printf("calendar: %s created a feed token", user)
+				data.CalendarFeedURL = calendarFeedURL(r, token)
+				data.SuccessMessage = "Kalender-Feed angelegt. Kopiere die Adresse jetzt – sie wird nur einmal angezeigt."
+			}
+		case "feed_revoke":
+			err = revokeCalendarToken(user)
+			if err == nil {
+				log.Printf("calendar: %s revoked the feed token", user)
+				data.SuccessMessage = "Kalender-Feed deaktiviert"
+			}
+		default:
+			err = errors.New("unknown action")
+		}
+		if err != nil {
+			data.ErrorMessage = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	start := today()
+	for _, e := range calendarEntries(loadSeriesForUser(user), start.AddDate(0, 0, -calendarPastDays), start.AddDate(0, 0, calendarFutureDays)) {
+		if e.Date.Before(start) {
+			data.RecentlyAired = append(data.RecentlyAired, e)
+		} else {
+			data.Upcoming = append(data.Upcoming, e)
+		}
+	}
+	// Zuletzt erschienene Folgen stehen oben.
+	sort.SliceStable(data.RecentlyAired, func(i, j int) bool {
+		return data.RecentlyAired[i].Date.After(data.RecentlyAired[j].Date)
+	})
+	u, _ := getUser(user)
+	data.HasCalendarFeed = u.CalendarTokenHash != ""
+	templates.ExecuteTemplate(w, "calendar.html", data)
+}
+
+// calendarFeedHandler liefert /calendar.ics?token=... ohne Sitzung.
+func calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := lookupCalendarToken(r.URL.Query().Get("token"))
+	if !ok {
+		http.Error(w, "invalid calendar token", http.StatusUnauthorized)
+		return
+	}
+	u, _ := getUser(user)
+	start := today()
+	entries := calendarEntries(loadSeriesForUser(user), start.AddDate(0, 0, -feedPastDays), start.AddDate(0, 0, feedFutureDays))
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="serien.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	fmt.Fprint(w, buildICS(u.DisplayName, entries))
+}
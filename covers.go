@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// --- COVER ---
+
+// Poster werden einmalig nach data/covers/ geladen und über /covers/{imdb-id}
+// ausgeliefert, statt sie im Browser direkt beim Anbieter einzubinden. Die
+// Dateien heißen nach der IMDb-ID und werden von allen Nutzern geteilt.
+// Die URL enthält bewusst nicht die Serien-ID des Nutzers: die wird nach
+// dem Löschen oder einer Wiederherstellung neu vergeben, und der Browser
+// würde sonst eine Woche lang das Poster einer anderen Serie zeigen.
+// Verkleinerte Fassungen entstehen bei Bedarf und liegen daneben.
+
+const (
+	coversSubdir       = "covers"
+	coverMaxSize       = 10 << 20
+	coverMaxPixels     = 40 * 1000 * 1000
+	coverRetryAfter    = time.Hour
+	coverDefaultWidth  = 320
+	coverJPEGQuality   = 85
+	coverCacheControl  = "private, max-age=604800"
+	coverFormatJPEG    = "jpeg"
+	coverFormatPNG     = "png"
+	coverDownloadAgent = "series-tracker"
+)
+
+var (
+	// Erlaubte Breiten für ?w=; andere Werte werden aufgerundet, damit nicht
+	// beliebig viele Varianten entstehen.
+	coverWidths = []int{160, 320, 640}
+
+	coversDir = filepath.Join(dataDir, coversSubdir)
+
+	// coversMu schützt coverLocks, coverFailures und das Lesen oder
+	// Zurückschreiben aller Poster. Heruntergeladen und verkleinert wird
+	// unter dem Lock der jeweiligen Datei (coverLock), damit ein langsamer
+	// Anbieter nicht alle anderen Poster blockiert.
+	coversMu      sync.Mutex
+	coverLocks    = map[string]*sync.Mutex{}
+	coverFailures = map[string]time.Time{}
+
+	// Nur Originale gehören in Sicherungen, verkleinerte Fassungen
+	// ("<id>-w320.jpg") entstehen bei Bedarf neu.
+	coverOriginalName = regexp.MustCompile(`^[a-zA-Z0-9]+\.(jpg|png)$`)
+
+	errNoCover = errors.New("no cover available")
+)
+
+// coverKey liefert den Dateinamen (ohne Endung) für eine Serie.
+func coverKey(s Series) string {
+	return safeCacheKey(s.IMDBID)
+}
+
+// coverLock liefert das Lock für eine Poster-Datei und legt es bei Bedarf an.
+func coverLock(name string) *sync.Mutex {
+	coversMu.Lock()
+	defer coversMu.Unlock()
+	l, ok := coverLocks[name]
+	if !ok {
+		l = &sync.Mutex{}
+		coverLocks[name] = l
+	}
+	return l
+}
+
+// coverWidth rundet eine gewünschte Breite auf die nächste erlaubte auf.
+func coverWidth(requested int) int {
+	for _, w := range coverWidths {
+		if requested <= w {
+			return w
+		}
+	}
+	return coverWidths[len(coverWidths)-1]
+}
+
+func coverExt(format string) string {
+	if format == coverFormatPNG {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// findCover sucht eine vorhandene Datei in einem der gespeicherten Formate.
+func findCover(name string) (string, string, bool) {
+	for _, format := range []string{coverFormatJPEG, coverFormatPNG} {
+		file := filepath.Join(coversDir, name+coverExt(format))
+		if _, err := os.Stat(file); err == nil {
+			return file, format, true
+		}
+	}
+	return "", "", false
+}
+
+// downloadCover lädt das Poster und speichert es als JPEG oder PNG. Andere
+// Formate (GIF, WebP) werden als PNG gespeichert, da das PDF sie sonst
+// nicht einbinden kann.
+func downloadCover(key, coverURL string) (string, string, error) {
+	if !strings.HasPrefix(coverURL, "http://") && !strings.HasPrefix(coverURL, "https://") {
+		return "", "", errNoCover
+	}
+	req, err := http.NewRequest("GET", coverURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("User-Agent", coverDownloadAgent)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("network error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", "", fmt.Errorf("cover responded with status: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, coverMaxSize+1))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read cover: %v", err)
+	}
+	if len(data) > coverMaxSize {
+		return "", "", fmt.Errorf("cover larger than %d MB", coverMaxSize>>20)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", "", fmt.Errorf("unsupported cover image: %v", err)
+	}
+	if err := checkCoverPixels(config); err != nil {
+		return "", "", err
+	}
+	if format != coverFormatJPEG && format != coverFormatPNG {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return "", "", fmt.Errorf("unsupported cover image: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return "", "", err
+		}
+		data, format = buf.Bytes(), coverFormatPNG
+	}
+
+	if err := os.MkdirAll(coversDir, 0755); err != nil {
+		return "", "", err
+	}
+	file := filepath.Join(coversDir, key+coverExt(format))
+	if err := writeFileAtomic(file, data); err != nil {
+		return "", "", err
+	}
+	return file, format, nil
+}
+
+// checkCoverPixels lehnt Bilder ab, die entpackt zu groß würden. Geprüft
+// wird vor image.Decode, das sonst den Speicher für alle Pixel anlegt.
+func checkCoverPixels(config image.Config) error {
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > coverMaxPixels {
+		return fmt.Errorf("cover has %dx%d pixels, at most %d megapixels are allowed", config.Width, config.Height, coverMaxPixels/1000/1000)
+	}
+	return nil
+}
+
+// ensureCover liefert die lokale Datei des Posters und lädt sie beim ersten
+// Aufruf herunter. Nach einem Fehler wird erst nach coverRetryAfter erneut
+// versucht, damit kaputte Links nicht bei jedem Seitenaufruf abgefragt werden.
+func ensureCover(s Series) (string, string, error) {
+	key := coverKey(s)
+	if key == "" {
+		return "", "", errNoCover
+	}
+	if file, format, ok := findCover(key); ok {
+		return file, format, nil
+	}
+	if s.CoverURL == "" || s.CoverURL == "N/A" {
+		return "", "", errNoCover
+	}
+
+	l := coverLock(key)
+	l.Lock()
+	defer l.Unlock()
+	if file, format, ok := findCover(key); ok {
+		return file, format, nil
+	}
+	coversMu.Lock()
+	failed, ok := coverFailures[key]
+	coversMu.Unlock()
+	if ok && time.Since(failed) < coverRetryAfter {
+		return "", "", errNoCover
+	}
+	file, format, err := downloadCover(key, s.CoverURL)
+	coversMu.Lock()
+	defer coversMu.Unlock()
+	if err != nil {
+		coverFailures[key] = time.Now()
+		log.Printf("covers: failed to download cover for %s: %v", s.IMDBID, err)
+		return "", "", err
+	}
+	delete(coverFailures, key)
+	return file, format, nil
+}
+
+// resizedCover liefert eine auf width verkleinerte Fassung. Ist das Original
+// schmaler, wird es unverändert genutzt.
+func resizedCover(s Series, width int) (string, string, error) {
+	original, format, err := ensureCover(s)
+	if err != nil {
+		return "", "", err
+	}
+	name := fmt.Sprintf("%s-w%d", coverKey(s), width)
+	if file, format, ok := findCover(name); ok {
+		return file, format, nil
+	}
+	data, err := os.ReadFile(original)
+	if err != nil {
+		return "", "", err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode cover: %v", err)
+	}
+	if config.Width <= width {
+		return original, format, nil
+	}
+	if err := checkCoverPixels(config); err != nil {
+		return "", "", err
+	}
+
+	l := coverLock(name)
+	l.Lock()
+	defer l.Unlock()
+	if file, format, ok := findCover(name); ok {
+		return file, format, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode cover: %v", err)
+	}
+	bounds := src.Bounds()
+
+	height := bounds.Dy() * width / bounds.Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if format == coverFormatPNG {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: coverJPEGQuality})
+	}
+	if err != nil {
+		return "", "", err
+	}
+	file := filepath.Join(coversDir, name+coverExt(format))
+	if err := writeFileAtomic(file, buf.Bytes()); err != nil {
+		return "", "", err
+	}
+	return file, format, nil
+}
+
+// prefetchCover lädt das Poster einer neuen Serie im Hintergrund, damit die
+// Liste es beim nächsten Aufruf schon lokal hat.
+func prefetchCover(s Series) {
+	if s.CoverURL == "" {
+		return
+	}
+	go ensureCover(s)
+}
+
+// readCoverFiles liefert alle Original-Poster nach Dateinamen.
+func readCoverFiles() (map[string][]byte, error) {
+	coversMu.Lock()
+	defer coversMu.Unlock()
+	entries, err := os.ReadDir(coversDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for _, entry := range entries {
+		if entry.IsDir() || !coverOriginalName.MatchString(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(coversDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = data
+	}
+	return files, nil
+}
+
+// restoreCovers schreibt Poster aus einer Sicherung zurück. Verkleinerte
+// Fassungen derselben Serie werden entfernt, damit sie neu entstehen.
+func restoreCovers(files map[string][]byte) error {
+	coversMu.Lock()
+	defer coversMu.Unlock()
+	if err := os.MkdirAll(coversDir, 0755); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if !coverOriginalName.MatchString(name) {
+			continue
+		}
+		key := strings.TrimSuffix(name, filepath.Ext(name))
+		resized, _ := filepath.Glob(filepath.Join(coversDir, key+"-w*"))
+		for _, file := range resized {
+			os.Remove(file)
+		}
+		if err := writeFileAtomic(filepath.Join(coversDir, name), data); err != nil {
+			return err
+		}
+		delete(coverFailures, key)
+	}
+	return nil
+}
+
+// --- HANDLER ---
+
+// coversHandler liefert /covers/{imdb-id}?w=320 für eine Serie des Nutzers.
+func coversHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/covers/")
+	if key == "" || safeCacheKey(key) != key {
+		http.NotFound(w, r)
+		return
+	}
+	width := coverDefaultWidth
+	if v := r.URL.Query().Get("w"); v != "" {
+		requested, err := strconv.Atoi(v)
+		if err != nil || requested <= 0 {
+			http.Error(w, "invalid width", http.StatusBadRequest)
+			return
+		}
+		width = coverWidth(requested)
+	}
+
+	var series *Series
+	for _, s := range loadSeriesForUser(user) {
+		if coverKey(s) == key {
+			s := s
+			series = &s
+			break
+		}
+	}
+	if series == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, format, err := resizedCover(*series, width)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "failed to read cover", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/"+format)
+	w.Header().Set("Cache-Control", coverCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, filepath.Base(file), info.ModTime(), f)
+}
+
+// pdfImageType übersetzt das gespeicherte Format für gofpdf.
+func pdfImageType(format string) string {
+	if format == coverFormatPNG {
+		return "PNG"
+	}
+	return "JPG"
+}
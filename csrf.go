@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// --- CSRF-SCHUTZ ---
+
+// Jede Sitzung hat ein eigenes Token, das in alle Formulare als
+// csrf_token eingefügt wird. Ändernde Anfragen ohne passendes Token
+// werden abgelehnt, damit fremde Seiten keine Formulare im Namen des
+// angemeldeten Nutzers abschicken können.
+
+const csrfField = "csrf_token"
+
+// csrfToken liefert das Token der aktuellen Sitzung. Sitzungen, die vor
+// Einführung der Tokens angelegt wurden, bekommen hier nachträglich eins.
+func csrfToken(r *http.Request) string {
+	id, s, ok := sessionFromRequest(r)
+	if !ok {
+		return ""
+	}
+	if s.CSRFToken != "" {
+		return s.CSRFToken
+	}
+	token, err := randomToken()
+	if err != nil {
+		log.Printf("csrf: failed to create token: %v", err)
+		return ""
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	current, ok := sessions[id]
+	if !ok {
+		return ""
+	}
+	if current.CSRFToken == "" {
+		current.CSRFToken = token
+		sessions[id] = current
+		if err := saveSessionsLocked(); err != nil {
+			log.Printf("csrf: failed to save token: %v", err)
+		}
+	}
+	return current.CSRFToken
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// csrfProtect prüft bei ändernden Anfragen das Token aus dem Formular oder
+// dem Header X-CSRF-Token (für Skripte, die die API mit Cookie nutzen).
+// Ohne Sitzung wird nichts geprüft; dann leitet die nachfolgende
+// authMiddleware bzw. requireAdmin ohnehin zum Login um.
+func csrfProtect(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next(w, r)
+			return
+		}
+		// API-Anfragen mit Bearer-Token nutzen keinen Cookie; den Header
+		// kann eine fremde Seite nicht mitschicken.
+		if _, ok := bearerToken(r); ok && strings.HasPrefix(r.URL.Path, "/api/") {
+			next(w, r)
+			return
+		}
+		_, s, ok := sessionFromRequest(r)
+		if !ok {
+			next(w, r)
+			return
+		}
+		sent := r.Header.Get("X-CSRF-Token")
+		if sent == "" {
+			sent = r.PostFormValue(csrfField)
+		}
+		expected := csrfToken(r)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) != 1 {
+			log.Printf("csrf: rejected %s %s for %s", r.Method, r.URL.Path, s.Username)
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				writeAPIError(w, http.StatusForbidden, "invalid or missing X-CSRF-Token header")
+				return
+			}
+			http.Error(w, "invalid or missing csrf token, please reload the page", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
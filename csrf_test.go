@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestSession legt eine Sitzung an und liefert den Cookie-Wert.
+func useTestSession(t *testing.T, username, csrf string) string {
+	t.Helper()
+	sessionsMu.Lock()
+	previous := sessions
+	now := time.Now()
+	sessions = map[string]Session{
+		hashSessionID("cookie-" + username): {Username: username, Created: now, LastSeen: now, CSRFToken: csrf},
+	}
+	sessionsMu.Unlock()
+	t.Cleanup(func() {
+		sessionsMu.Lock()
+		sessions = previous
+		sessionsMu.Unlock()
+	})
+	return "cookie-" + username
+}
+
+func TestCSRFProtect(t *testing.T) {
+	useTestData(t)
+	cookie := useTestSession(t, "anna", "richtig")
+	handler := csrfProtect(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		cookie  bool
+		form    string
+		header  string
+		bearer  bool
+		allowed bool
+	}{
+		{"read without token", "GET", "/mylist", true, "", "", false, true},
+		{"no session", "POST", "/update", false, "", "", false, true},
+		{"missing token", "POST", "/update", true, "", "", false, false},
+		{"wrong token", "POST", "/update", true, "falsch", "", false, false},
+		{"form token", "POST", "/update", true, "richtig", "", false, true},
+		{"header token", "POST", "/update", true, "", "richtig", false, true},
+		{"wrong header beats form", "POST", "/update", true, "richtig", "falsch", false, false},
+		{"api with bearer", "POST", "/api/v1/series", true, "", "", true, true},
+		{"api with cookie only", "DELETE", "/api/v1/series/1", true, "", "", false, false},
+		{"bearer outside api", "POST", "/update", true, "", "", true, false},
+	}
+	for _, tt := range tests {
+		form := url.Values{}
+		if tt.form != "" {
+			form.Set(csrfField, tt.form)
+		}
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.cookie {
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: cookie})
+		}
+		if tt.header != "" {
+			r.Header.Set("X-CSRF-Token", tt.header)
+		}
+		if tt.bearer {
+			r.Header.Set("Authorization", "Bearer st_test")
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+
+		want := http.StatusForbidden
+		if tt.allowed {
+			want = http.StatusNoContent
+		}
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, want)
+		}
+		if !tt.allowed && strings.HasPrefix(tt.path, "/api/") && !strings.Contains(w.Header().Get("Content-Type"), "json") {
+			t.Errorf("%s: content type %q, want a JSON error", tt.name, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestCSRFTokenForOldSession(t *testing.T) {
+	useTestData(t)
+	cookie := useTestSession(t, "anna", "")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: cookie})
+
+	token := csrfToken(r)
+	if token == "" {
+		t.Fatal("old session got no token")
+	}
+	if again := csrfToken(r); again != token {
+		t.Errorf("token changed from %q to %q", token, again)
+	}
+	saved, err := store.LoadSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := saved[hashSessionID(cookie)]; s.CSRFToken != token {
+		t.Errorf("saved token = %q, want %q", s.CSRFToken, token)
+	}
+
+	if token := csrfToken(httptest.NewRequest("GET", "/", nil)); token != "" {
+		t.Errorf("request without session got token %q", token)
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// --- EPISODEN ---
+
+type Season struct {
+	Number   int       `json:"number"`
+	Episodes []Episode `json:"episodes"`
+}
+
+type Episode struct {
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	IMDBID   string `json:"imdb_id,omitempty"`
+	Released string `json:"released,omitempty"`
+	Runtime  int    `json:"runtime,omitempty"` // Minuten, falls der Anbieter sie kennt
+	Watched  bool   `json:"watched"`
+}
+
+var (
+	errSeasonNotFound  = errors.New("season not found")
+	errEpisodeNotFound = errors.New("episode not found")
+)
+
+// recountEpisodes leitet die Zähler einer Serie aus dem Episodenbaum ab
+// und aktualisiert Fortschritt und Status. Serien ohne Baum (z. B. aus
+// alten Dateien) behalten ihre Zähler.
+func recountEpisodes(s *Series) {
+	previous := s.EpisodesWatched
+	defer updateProgress(s, previous)
+	if len(s.Seasons) == 0 {
+		return
+	}
+	total, watched := 0, 0
+	for _, season := range s.Seasons {
+		for _, e := range season.Episodes {
+			total++
+			if e.Watched {
+				watched++
+			}
+		}
+	}
+	s.TotalEpisodes = total
+	s.EpisodesWatched = watched
+}
+
+func setEpisodeWatched(s *Series, season, episode int, watched bool) error {
+	for i := range s.Seasons {
+		if s.Seasons[i].Number != season {
+			continue
+		}
+		for j := range s.Seasons[i].Episodes {
+			if s.Seasons[i].Episodes[j].Number == episode {
+				s.Seasons[i].Episodes[j].Watched = watched
+				recountEpisodes(s)
+				return nil
+			}
+		}
+		return errEpisodeNotFound
+	}
+	return errSeasonNotFound
+}
+
+func setSeasonWatched(s *Series, season int, watched bool) error {
+	for i := range s.Seasons {
+		if s.Seasons[i].Number == season {
+			for j := range s.Seasons[i].Episodes {
+				s.Seasons[i].Episodes[j].Watched = watched
+			}
+			recountEpisodes(s)
+			return nil
+		}
+	}
+	return errSeasonNotFound
+}
+
+// setWatchedCount markiert die ersten n Episoden in Reihenfolge als gesehen
+// und alle weiteren als ungesehen. So bleibt das alte Zählerfeld in /update
+// nutzbar. n wird auf 0 bis TotalEpisodes begrenzt, sofern die Gesamtzahl
+// bekannt ist.
+func setWatchedCount(s *Series, n int) {
+	if n < 0 {
+		n = 0
+	}
+	if s.TotalEpisodes > 0 && n > s.TotalEpisodes {
+		n = s.TotalEpisodes
+	}
+	if len(s.Seasons) == 0 {
+		previous := s.EpisodesWatched
+		s.EpisodesWatched = n
+		updateProgress(s, previous)
+		return
+	}
+	for i := range s.Seasons {
+		for j := range s.Seasons[i].Episodes {
+			s.Seasons[i].Episodes[j].Watched = n > 0
+			n--
+		}
+	}
+	recountEpisodes(s)
+}
+
+// mergeSeasons übernimmt die Gesehen-Markierungen aus dem alten Baum in
+// frisch geladene Staffeln. Hatte die Serie noch keinen Baum, wird der
+// bisherige Zähler auf die ersten Episoden verteilt.
+func mergeSeasons(s *Series, fresh []Season) {
+	if len(s.Seasons) == 0 {
+		count := s.EpisodesWatched
+		s.Seasons = fresh
+		setWatchedCount(s, count)
+		return
+	}
+	watched := map[[2]int]bool{}
+	for _, season := range s.Seasons {
+		for _, e := range season.Episodes {
+			watched[[2]int{season.Number, e.Number}] = e.Watched
+		}
+	}
+	for i := range fresh {
+		for j := range fresh[i].Episodes {
+			fresh[i].Episodes[j].Watched = watched[[2]int{fresh[i].Number, fresh[i].Episodes[j].Number}]
+		}
+	}
+	s.Seasons = fresh
+	recountEpisodes(s)
+}
+
+// --- HANDLER ---
+
+func seriesDetailHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	series, err := store.LoadSeries(user)
+	if err != nil {
+		log.Printf("failed to load series for %s: %v", user, err)
+		http.Error(w, "failed to load series", http.StatusInternalServerError)
+		return
+	}
+	var detail *Series
+	for i := range series {
+		if series[i].ID == id {
+			detail = &series[i]
+			break
+		}
+	}
+	if detail == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := newPageData(r, user)
+	data.Detail = detail
+	if lists, err := loadLists(user); err == nil {
+		data.Lists = lists
+	} else {
+		log.Printf("failed to load lists for %s: %v", user, err)
+	}
+	data.ErrorMessage = r.URL.Query().Get("error")
+	templates.ExecuteTemplate(w, "series.html", data)
+}
+
+// episodeHandler markiert eine einzelne Episode als gesehen oder ungesehen.
+func episodeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err1 := strconv.Atoi(r.FormValue("id"))
+	season, err2 := strconv.Atoi(r.FormValue("season"))
+	episode, err3 := strconv.Atoi(r.FormValue("episode"))
+	if err1 != nil || err2 != nil || err3 != nil {
+		http.Error(w, "invalid id, season or episode", http.StatusBadRequest)
+		return
+	}
+	watched := r.FormValue("watched") == "1"
+
+	err := updateOneSeries(user, id, sourceWeb, func(s *Series) error {
+		return setEpisodeWatched(s, season, episode, watched)
+	})
+	redirectToSeries(w, r, id, err)
+}
+
+// seasonHandler markiert alle Episoden einer Staffel auf einmal.
+func seasonHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err1 := strconv.Atoi(r.FormValue("id"))
+	season, err2 := strconv.Atoi(r.FormValue("season"))
+	if err1 != nil || err2 != nil {
+		http.Error(w, "invalid id or season", http.StatusBadRequest)
+		return
+	}
+	watched := r.FormValue("watched") == "1"
+
+	err := updateOneSeries(user, id, sourceWeb, func(s *Series) error {
+		return setSeasonWatched(s, season, watched)
+	})
+	redirectToSeries(w, r, id, err)
+}
+
+// refreshHandler lädt die Staffeln einer Serie neu, z. B. wenn neue
+// Episoden erschienen sind oder der erste Abruf fehlgeschlagen ist.
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var imdbID string
+	for _, s := range loadSeriesForUser(user) {
+		if s.ID == id {
+			imdbID = s.IMDBID
+		}
+	}
+	if imdbID == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Wer ausdrücklich aktualisiert, will den aktuellen Stand der Anbieter
+	// und keinen zwischengespeicherten.
+	if _, err := metadataCache.invalidateIMDB(imdbID); err != nil {
+		log.Printf("cache: failed to invalidate %s: %v", imdbID, err)
+	}
+	// Die Abfragen bei den Anbietern laufen außerhalb des Locks, damit andere Änderungen
+	// an der Liste nicht auf das Netzwerk warten müssen.
+	seasons, err := fetchSeriesSeasons(imdbID)
+	if err == nil {
+		// Laufzeit und Genres fehlen bei älteren Einträgen und werden hier
+		// nachgetragen; ein Fehler dabei verhindert das Aktualisieren nicht.
+		info, infoErr := metadata.Lookup(imdbID)
+		if infoErr != nil {
+			log.Printf("failed to look up %s: %v", imdbID, infoErr)
+		}
+		err = updateOneSeries(user, id, "", func(s *Series) error {
+			mergeSeasons(s, seasons)
+			applySeriesInfo(s, info)
+			return nil
+		})
+	}
+	redirectToSeries(w, r, id, err)
+}
+
+// fetchSeriesSeasons lädt alle Staffeln einer bereits gespeicherten Serie.
+func fetchSeriesSeasons(imdbID string) ([]Season, error) {
+	return metadata.Seasons(&SeriesInfo{IMDBID: imdbID})
+}
+
+// applySeriesInfo übernimmt Laufzeit und Genres, sofern der Anbieter sie kennt.
+func applySeriesInfo(s *Series, info *SeriesInfo) {
+	if info == nil {
+		return
+	}
+	if info.Runtime > 0 {
+		s.Runtime = info.Runtime
+	}
+	if len(info.Genres) > 0 {
+		s.Genres = info.Genres
+	}
+}
+
+// updateOneSeries wendet fn auf eine einzelne Serie des Nutzers an. Ist
+// source gesetzt, landen geänderte Gesehen-Markierungen im Verlauf.
+func updateOneSeries(user string, id int, source string, fn func(s *Series) error) error {
+	var events []WatchEvent
+	err := store.UpdateSeries(user, func(seriesDB []Series) ([]Series, error) {
+		for i := range seriesDB {
+			if seriesDB[i].ID == id {
+				before := captureWatched(&seriesDB[i])
+				if err := fn(&seriesDB[i]); err != nil {
+					return nil, err
+				}
+				if source != "" {
+					events = watchedChanges(before, &seriesDB[i], source)
+				}
+				return seriesDB, nil
+			}
+		}
+		return nil, errSeriesNotFound
+	})
+	if err == nil {
+		if err := appendHistory(user, events...); err != nil {
+			log.Printf("history: failed to record changes for %s: %v", user, err)
+		}
+	}
+	return err
+}
+
+func redirectToSeries(w http.ResponseWriter, r *http.Request, id int, err error) {
+	target := fmt.Sprintf("/series?id=%d", id)
+	if err != nil {
+		log.Printf("failed to update series %d: %v", id, err)
+		target += "&error=" + url.QueryEscape(err.Error())
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- API-STATUS ---
+
+// Die Erreichbarkeit der Metadaten-Anbieter wird im Hintergrund geprüft
+// statt bei jedem Seitenaufruf. Es genügt, wenn einer antwortet. Nach
+// Fehlern wächst der Abstand zwischen den Prüfungen, damit ein
+// ausgeschöpftes Tageslimit nicht noch weiter belastet wird.
+
+type HealthStatus struct {
+	Available   bool      `json:"available"`
+	CheckedAt   time.Time `json:"checked_at"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	Providers   []string  `json:"providers"`
+	Failures    int       `json:"consecutive_failures"`
+	NextCheck   time.Time `json:"next_check"`
+}
+
+const (
+	healthBackoffStart = time.Minute
+	healthBackoffMax   = time.Hour
+)
+
+var (
+	healthInterval = envDuration("HEALTH_CHECK_INTERVAL", 15*time.Minute)
+
+	healthMu  sync.RWMutex
+	apiHealth HealthStatus
+)
+
+func currentAPIHealth() HealthStatus {
+	healthMu.RLock()
+	defer healthMu.RUnlock()
+	return apiHealth
+}
+
+// recordHealth übernimmt das Ergebnis einer Prüfung und liefert die
+// Wartezeit bis zur nächsten.
+func recordHealth(err error) time.Duration {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	now := time.Now()
+	wait := healthInterval
+	apiHealth.CheckedAt = now
+	if err == nil {
+		if apiHealth.Failures > 0 {
+			log.Println("health: metadata providers reachable again")
+		}
+		apiHealth.Available = true
+		apiHealth.LastSuccess = now
+		apiHealth.LastError = ""
+		apiHealth.Failures = 0
+	} else {
+		apiHealth.Failures++
+		message := err.Error()
+		if apiHealth.Available || apiHealth.LastError != message {
+			log.Printf("health: metadata providers unavailable: %s", message)
+		}
+		apiHealth.Available = false
+		apiHealth.LastError = message
+
+		// 1, 2, 4, 8 ... Minuten, höchstens eine Stunde.
+		wait = healthBackoffMax
+		if apiHealth.Failures <= 6 {
+			wait = healthBackoffStart << (apiHealth.Failures - 1)
+		}
+	}
+	apiHealth.NextCheck = now.Add(wait)
+	return wait
+}
+
+// runHealthChecker prüft die Anbieter sofort und danach in Abständen.
+func runHealthChecker() {
+	healthMu.Lock()
+	apiHealth.Providers = metadata.names()
+	healthMu.Unlock()
+	if len(metadata) == 0 {
+		recordHealth(errNoMetadataProvider)
+		return
+	}
+	for {
+		time.Sleep(recordHealth(metadata.Check()))
+	}
+}
+
+// --- HANDLER ---
+
+// healthzHandler ist für Docker-Healthchecks und Monitoring gedacht. Ein
+// Ausfall der Anbieter gilt nur als "degraded", da Listen weiter nutzbar sind;
+// ist der Speicher nicht erreichbar, antwortet der Endpunkt mit 503.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	response := struct {
+		Status   string       `json:"status"`
+		Storage  string       `json:"storage"`
+		Metadata HealthStatus `json:"metadata"`
+	}{
+		Status:   "ok",
+		Storage:  "ok",
+		Metadata: currentAPIHealth(),
+	}
+	code := http.StatusOK
+	if _, _, err := store.GetSetting("schema_version"); err != nil {
+		log.Printf("health: storage check failed: %v", err)
+		response.Status = "unavailable"
+		response.Storage = "error"
+		code = http.StatusServiceUnavailable
+	} else if !response.Metadata.Available {
+		response.Status = "degraded"
+	}
+	writeJSON(w, code, response)
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- VERLAUF ---
+
+// Jede Änderung am Gesehen-Stand wird als Zeile an data/history/<nutzer>.jsonl
+// angehängt. Einträge werden nie geändert: Rückgängig machen und
+// Zurückdatieren sind eigene Einträge, die auf den ursprünglichen verweisen
+// und erst beim Lesen angewendet werden.
+
+const (
+	historySubdir     = "history"
+	historyFileSuffix = ".jsonl"
+	historyPageLimit  = 500
+
+	actionWatched   = "watched"
+	actionUnwatched = "unwatched"
+	actionUndo      = "undo"
+	actionBackdate  = "backdate"
+
+	sourceWeb     = "web"
+	sourceAPI     = "api"
+	sourceImport  = "import"
+	historyLayout = "2006-01-02T15:04"
+)
+
+var (
+	historyDir = filepath.Join(dataDir, historySubdir)
+	historyMu  sync.Mutex
+
+	errEventNotFound    = errors.New("history entry not found")
+	errEventUndone      = errors.New("history entry already undone")
+	errEventNotEditable = errors.New("only watched or unwatched entries can be changed")
+	errInvalidTime      = errors.New("invalid time")
+)
+
+// WatchEvent ist eine Zeile im Verlauf. Bei Serien ohne Episodenliste (aus
+// alten Dateien) ist Season 0 und Episode die laufende Nummer.
+type WatchEvent struct {
+	ID        string    `json:"id"`
+	Action    string    `json:"action"`
+	SeriesID  int       `json:"series_id,omitempty"`
+	IMDBID    string    `json:"imdb_id,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Season    int       `json:"season,omitempty"`
+	Episode   int       `json:"episode,omitempty"`
+	WatchedAt time.Time `json:"watched_at"`
+	Recorded  time.Time `json:"recorded"`
+	Source    string    `json:"source,omitempty"`
+	Ref       string    `json:"ref,omitempty"` // Ziel von undo und backdate
+}
+
+// HistoryEntry ist ein Ereignis nach Anwendung von undo und backdate.
+type HistoryEntry struct {
+	WatchEvent
+	Undone    bool
+	Backdated bool
+}
+
+// Code liefert "S01E02" bzw. "Folge 5" bei Serien ohne Episodenliste.
+func (e HistoryEntry) Code() string {
+	if e.Season == 0 {
+		return fmt.Sprintf("Folge %d", e.Episode)
+	}
+	return fmt.Sprintf("S%02dE%02d", e.Season, e.Episode)
+}
+
+// HistoryDay fasst die Einträge eines Tages für die Anzeige zusammen.
+type HistoryDay struct {
+	Date    time.Time
+	Entries []HistoryEntry
+}
+
+var germanWeekdays = [...]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"}
+
+// Label liefert "Heute", "Gestern" oder z. B. "Montag, 02.01.2006".
+func (d HistoryDay) Label() string {
+	switch days := int(math.Round(today().Sub(d.Date).Hours() / 24)); days {
+	case 0:
+		return "Heute"
+	case 1:
+		return "Gestern"
+	}
+	return germanWeekdays[d.Date.Weekday()] + ", " + d.Date.Format("02.01.2006")
+}
+
+func historyFile(username string) string {
+	return filepath.Join(historyDir, username+historyFileSuffix)
+}
+
+func newEventID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// appendHistory hängt Ereignisse an den Verlauf des Nutzers an.
+func appendHistory(username string, events ...WatchEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf strings.Builder
+	now := time.Now()
+	for _, e := range events {
+		if e.ID == "" {
+			id, err := newEventID()
+			if err != nil {
+				return err
+			}
+			e.ID = id
+		}
+		if e.Recorded.IsZero() {
+			e.Recorded = now
+		}
+		if e.WatchedAt.IsZero() {
+			e.WatchedAt = now
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(historyFile(username), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(buf.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHistory liest alle Zeilen. Unlesbare Zeilen (z. B. nach einem Absturz
+// mitten im Schreiben) werden übersprungen.
+func loadHistory(username string) ([]WatchEvent, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	f, err := os.Open(historyFile(username))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []WatchEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e WatchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Printf("history: skipping line %d of %s: %v", line, username, err)
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// resolveHistory wendet undo und backdate an und liefert die Ereignisse,
+// neueste zuerst.
+func resolveHistory(events []WatchEvent) []HistoryEntry {
+	index := map[string]int{}
+	var entries []HistoryEntry
+	for _, e := range events {
+		switch e.Action {
+		case actionWatched, actionUnwatched:
+			index[e.ID] = len(entries)
+			entries = append(entries, HistoryEntry{WatchEvent: e})
+		case actionUndo:
+			if i, ok := index[e.Ref]; ok {
+				entries[i].Undone = true
+			}
+		case actionBackdate:
+			if i, ok := index[e.Ref]; ok {
+				entries[i].WatchedAt = e.WatchedAt
+				entries[i].Backdated = true
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].WatchedAt.After(entries[j].WatchedAt)
+	})
+	return entries
+}
+
+func groupHistoryByDay(entries []HistoryEntry) []HistoryDay {
+	var days []HistoryDay
+	for _, e := range entries {
+		local := e.WatchedAt.Local()
+		date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local)
+		if len(days) == 0 || !days[len(days)-1].Date.Equal(date) {
+			days = append(days, HistoryDay{Date: date})
+		}
+		days[len(days)-1].Entries = append(days[len(days)-1].Entries, e)
+	}
+	return days
+}
+
+// findHistoryEntry sucht ein änderbares Ereignis nach ID.
+func findHistoryEntry(username, id string) (HistoryEntry, error) {
+	events, err := loadHistory(username)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	for _, e := range resolveHistory(events) {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	for _, e := range events {
+		if e.ID == id {
+			return HistoryEntry{}, errEventNotEditable
+		}
+	}
+	return HistoryEntry{}, errEventNotFound
+}
+
+// --- ÄNDERUNGEN ERFASSEN ---
+
+// watchedState merkt sich vor einer Änderung, welche Episoden gesehen waren.
+type watchedState struct {
+	episodes map[[2]int]bool
+	count    int
+	tree     bool
+}
+
+func captureWatched(s *Series) watchedState {
+	state := watchedState{episodes: map[[2]int]bool{}, count: s.EpisodesWatched, tree: len(s.Seasons) > 0}
+	for _, season := range s.Seasons {
+		for _, e := range season.Episodes {
+			state.episodes[[2]int{season.Number, e.Number}] = e.Watched
+		}
+	}
+	return state
+}
+
+// watchedChanges vergleicht den Stand vor und nach einer Änderung. Wird
+// eine alte Serie ohne Episodenliste erstmals aufgefächert, entsteht kein
+// Eintrag, da dabei nichts neu gesehen wurde.
+func watchedChanges(before watchedState, s *Series, source string) []WatchEvent {
+	base := WatchEvent{SeriesID: s.ID, IMDBID: s.IMDBID, Title: s.Title, Source: source}
+	var events []WatchEvent
+	after := captureWatched(s)
+
+	if !before.tree && !after.tree {
+		for n := before.count + 1; n <= after.count; n++ {
+			e := base
+			e.Action, e.Episode = actionWatched, n
+			events = append(events, e)
+		}
+		for n := before.count; n > after.count; n-- {
+			e := base
+			e.Action, e.Episode = actionUnwatched, n
+			events = append(events, e)
+		}
+		return events
+	}
+	if before.tree != after.tree {
+		return nil
+	}
+
+	for _, season := range s.Seasons {
+		for _, ep := range season.Episodes {
+			key := [2]int{season.Number, ep.Number}
+			if before.episodes[key] == ep.Watched {
+				continue
+			}
+			e := base
+			e.Season, e.Episode = season.Number, ep.Number
+			e.Action = actionUnwatched
+			if ep.Watched {
+				e.Action = actionWatched
+			}
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// forSeries prüft, ob ein Ereignis zur Serie gehört. Serien-IDs werden nach
+// dem Löschen neu vergeben, daher zählt die IMDb-ID; nur Ereignisse ohne
+// sie werden über die ID zugeordnet.
+func (e WatchEvent) forSeries(s *Series) bool {
+	if e.IMDBID != "" {
+		return s.IMDBID == e.IMDBID
+	}
+	return s.ID == e.SeriesID
+}
+
+// undoHistoryEntry macht ein Ereignis rückgängig, auch am Gesehen-Stand der
+// Serie. Gibt es die Serie oder die Episode nicht mehr, bleibt der Eintrag
+// stehen und der Fehler wird zurückgegeben.
+func undoHistoryEntry(username, id string) error {
+	entry, err := findHistoryEntry(username, id)
+	if err != nil {
+		return err
+	}
+	if entry.Undone {
+		return errEventUndone
+	}
+	watched := entry.Action != actionWatched
+	seriesID := entry.SeriesID
+	err = store.UpdateSeries(username, func(seriesDB []Series) ([]Series, error) {
+		for i := range seriesDB {
+			s := &seriesDB[i]
+			if !entry.forSeries(s) {
+				continue
+			}
+			seriesID = s.ID
+			if entry.Season == 0 && len(s.Seasons) == 0 {
+				if watched {
+					setWatchedCount(s, s.EpisodesWatched+1)
+				} else if s.EpisodesWatched > 0 {
+					setWatchedCount(s, s.EpisodesWatched-1)
+				}
+				return seriesDB, nil
+			}
+			if err := setEpisodeWatched(s, entry.Season, entry.Episode, watched); err != nil {
+				return nil, err
+			}
+			return seriesDB, nil
+		}
+		return nil, errSeriesNotFound
+	})
+	if err != nil {
+		return err
+	}
+	return appendHistory(username, WatchEvent{Action: actionUndo, Ref: id, SeriesID: seriesID, IMDBID: entry.IMDBID, Source: sourceWeb})
+}
+
+func backdateHistoryEntry(username, id string, at time.Time) error {
+	entry, err := findHistoryEntry(username, id)
+	if err != nil {
+		return err
+	}
+	if entry.Undone {
+		return errEventUndone
+	}
+	if at.IsZero() || at.After(time.Now().Add(time.Minute)) {
+		return errInvalidTime
+	}
+	return appendHistory(username, WatchEvent{Action: actionBackdate, Ref: id, SeriesID: entry.SeriesID, WatchedAt: at, Source: sourceWeb})
+}
+
+func renameHistory(oldName, newName string) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	err := os.Rename(historyFile(oldName), historyFile(newName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func deleteHistory(username string) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	err := os.Remove(historyFile(username))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readHistoryFile liefert die Datei unverändert, z. B. für Sicherungen.
+// Ohne Verlauf ist das Ergebnis leer.
+func readHistoryFile(username string) ([]byte, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	data, err := os.ReadFile(historyFile(username))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// replaceHistory ersetzt die Datei beim Wiederherstellen einer Sicherung.
+// Ohne Inhalt wird sie gelöscht.
+func replaceHistory(username string, data []byte) error {
+	if len(data) == 0 {
+		return deleteHistory(username)
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(historyFile(username), data)
+}
+
+// --- HANDLER ---
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+
+	if r.Method == "POST" {
+		id := r.FormValue("id")
+		var err error
+		switch r.FormValue("action") {
+		case "undo":
+			err = undoHistoryEntry(user, id)
+			if err == nil {
+				data.SuccessMessage = "Eintrag rückgängig gemacht"
+			}
+		case "backdate":
+			var at time.Time
+			at, err = time.ParseInLocation(historyLayout, r.FormValue("watched_at"), time.Local)
+			if err != nil {
+				err = errInvalidTime
+			} else {
+				err = backdateHistoryEntry(user, id, at)
+			}
+			if err == nil {
+				data.SuccessMessage = "Zeitpunkt geändert"
+			}
+		default:
+			err = errors.New("unknown action")
+		}
+		if err != nil {
+			data.ErrorMessage = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	events, err := loadHistory(user)
+	if err != nil {
+		log.Printf("history: failed to load history of %s: %v", user, err)
+		data.ErrorMessage = "failed to load history"
+	}
+	entries := resolveHistory(events)
+	if len(entries) > historyPageLimit {
+		entries = entries[:historyPageLimit]
+	}
+	data.HistoryDays = groupHistoryByDay(entries)
+	templates.ExecuteTemplate(w, "history.html", data)
+}
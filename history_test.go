@@ -0,0 +1,174 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func testSeasons() []Season {
+	return []Season{{Number: 1, Episodes: []Episode{{Number: 1}, {Number: 2}}}}
+}
+
+func episodeWatched(t *testing.T, user, imdbID string, season, episode int) bool {
+	t.Helper()
+	for _, s := range loadSeriesForUser(user) {
+		if s.IMDBID != imdbID {
+			continue
+		}
+		for _, se := range s.Seasons {
+			for _, e := range se.Episodes {
+				if se.Number == season && e.Number == episode {
+					return e.Watched
+				}
+			}
+		}
+	}
+	t.Fatalf("%s S%dE%d not found", imdbID, season, episode)
+	return false
+}
+
+func lastHistoryEntry(t *testing.T, user string) WatchEvent {
+	t.Helper()
+	events, err := loadHistory(user)
+	if err != nil || len(events) == 0 {
+		t.Fatalf("history = %+v (%v), want entries", events, err)
+	}
+	return events[len(events)-1]
+}
+
+func TestUndoAfterSeriesIDReuse(t *testing.T) {
+	useTestData(t)
+	dark, err := insertSeries("anna", &SeriesInfo{IMDBID: "tt5753856", Title: "Dark"}, testSeasons())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updateOneSeries("anna", dark.ID, sourceWeb, func(s *Series) error {
+		return setEpisodeWatched(s, 1, 1, true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watched := lastHistoryEntry(t, "anna")
+
+	// Dark wird gelöscht, Fargo bekommt dieselbe ID.
+	trashed, err := trashSeries("anna", dark.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fargo, err := insertSeries("anna", &SeriesInfo{IMDBID: "tt2802850", Title: "Fargo"}, testSeasons())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fargo.ID != dark.ID {
+		t.Fatalf("fargo got ID %d, want the reused ID %d", fargo.ID, dark.ID)
+	}
+	err = updateOneSeries("anna", fargo.ID, "", func(s *Series) error {
+		return setEpisodeWatched(s, 1, 1, true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := undoHistoryEntry("anna", watched.ID); err != errSeriesNotFound {
+		t.Errorf("undo without Dark: err = %v, want %v", err, errSeriesNotFound)
+	}
+	if !episodeWatched(t, "anna", fargo.IMDBID, 1, 1) {
+		t.Error("undo changed Fargo")
+	}
+	if last := lastHistoryEntry(t, "anna"); last.ID != watched.ID {
+		t.Errorf("failed undo was recorded: %+v", last)
+	}
+
+	// Zurückgeholt bekommt Dark eine neue ID, die IMDb-ID findet sie.
+	restored, err := restoreTrashed("anna", trashed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ID == dark.ID {
+		t.Fatalf("restored Dark kept the taken ID %d", restored.ID)
+	}
+	if err := undoHistoryEntry("anna", watched.ID); err != nil {
+		t.Fatal(err)
+	}
+	if episodeWatched(t, "anna", dark.IMDBID, 1, 1) {
+		t.Error("undo did not unmark Dark S1E1")
+	}
+	if !episodeWatched(t, "anna", fargo.IMDBID, 1, 1) {
+		t.Error("undo changed Fargo")
+	}
+	if undo := lastHistoryEntry(t, "anna"); undo.Action != actionUndo || undo.Ref != watched.ID || undo.SeriesID != restored.ID {
+		t.Errorf("undo entry = %+v, want a reference to %s for series %d", undo, watched.ID, restored.ID)
+	}
+	if err := undoHistoryEntry("anna", watched.ID); err != errEventUndone {
+		t.Errorf("second undo: err = %v, want %v", err, errEventUndone)
+	}
+}
+
+func TestUndoWithoutIMDbID(t *testing.T) {
+	useTestData(t)
+	if err := store.SaveSeries("anna", []Series{{ID: 4, Title: "Alt", EpisodesWatched: 3, TotalEpisodes: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendHistory("anna", WatchEvent{Action: actionWatched, SeriesID: 4, Episode: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := undoHistoryEntry("anna", lastHistoryEntry(t, "anna").ID); err != nil {
+		t.Fatal(err)
+	}
+	if series := loadSeriesForUser("anna"); len(series) != 1 || series[0].EpisodesWatched != 2 {
+		t.Errorf("series = %+v, want 2 episodes watched", series)
+	}
+}
+
+func TestBackdateHistoryEntry(t *testing.T) {
+	useTestData(t)
+	if err := appendHistory("anna", WatchEvent{Action: actionWatched, SeriesID: 1, IMDBID: "tt5753856", Season: 1, Episode: 1}); err != nil {
+		t.Fatal(err)
+	}
+	watched := lastHistoryEntry(t, "anna")
+
+	if err := backdateHistoryEntry("anna", watched.ID, time.Now().Add(time.Hour)); err != errInvalidTime {
+		t.Errorf("future time: err = %v, want %v", err, errInvalidTime)
+	}
+	at := time.Date(2024, 3, 1, 21, 0, 0, 0, time.Local)
+	if err := backdateHistoryEntry("anna", watched.ID, at); err != nil {
+		t.Fatal(err)
+	}
+	backdate := lastHistoryEntry(t, "anna")
+	if err := backdateHistoryEntry("anna", backdate.ID, at); err != errEventNotEditable {
+		t.Errorf("backdating a backdate: err = %v, want %v", err, errEventNotEditable)
+	}
+	if err := backdateHistoryEntry("anna", "missing", at); err != errEventNotFound {
+		t.Errorf("unknown entry: err = %v, want %v", err, errEventNotFound)
+	}
+
+	events, err := loadHistory("anna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := resolveHistory(events)
+	if len(entries) != 1 || !entries[0].Backdated || !entries[0].WatchedAt.Equal(at) || entries[0].Recorded.Equal(at) {
+		t.Errorf("entries = %+v, want one backdated to %s", entries, at)
+	}
+}
+
+func TestResolveHistory(t *testing.T) {
+	base := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	events := []WatchEvent{
+		{ID: "a", Action: actionWatched, Episode: 1, WatchedAt: base},
+		{ID: "b", Action: actionWatched, Episode: 2, WatchedAt: base.Add(time.Hour)},
+		{ID: "c", Action: actionUndo, Ref: "a"},
+		{ID: "d", Action: actionBackdate, Ref: "b", WatchedAt: base.Add(-time.Hour)},
+		{ID: "e", Action: actionUndo, Ref: "missing"},
+	}
+	entries := resolveHistory(events)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].ID != "a" || !entries[0].Undone {
+		t.Errorf("first = %+v, want a undone", entries[0])
+	}
+	if entries[1].ID != "b" || !entries[1].Backdated || !entries[1].WatchedAt.Equal(base.Add(-time.Hour)) {
+		t.Errorf("second = %+v, want b backdated", entries[1])
+	}
+}
@@ -0,0 +1,801 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- IMPORT ---
+
+// Ein Import läuft in zwei Schritten: planImport ordnet jede Zeile über die
+// Metadaten-Anbieter einer IMDb-ID zu und zeigt, was passieren würde
+// (Probelauf), applyImport führt den Plan aus. Das Dateiformat kennt nur
+// der jeweilige Parser, der ImportRows liefert.
+//
+// Neue Serien brauchen je eine Anfrage für die Details und mehrere für die
+// Staffeln. Eine Datei darf daher höchstens importMaxRows Serien enthalten,
+// damit ein Import das Tageskontingent von OMDb (1000 Anfragen) nicht
+// aufbraucht, und der Import selbst läuft im Hintergrund (startImportJob).
+//
+// Gesehene Episoden landen nur dann im Verlauf, wenn die Quelle den
+// Zeitpunkt kennt (Trakt, TV Time). Reine Zählerstände aus CSV-Dateien
+// erscheinen dort nicht.
+
+const (
+	importMaxBytes        = 1 << 20
+	importMaxArchiveBytes = 32 << 20
+	importMaxRows         = 250
+	importJobKeep         = time.Hour
+
+	importNew       = "new"
+	importConflict  = "conflict"
+	importUnmatched = "unmatched"
+	importInvalid   = "invalid"
+	importDuplicate = "duplicate"
+
+	// Auflösungen für Serien, die schon in der Liste sind.
+	resolveMerge     = "merge"
+	resolveOverwrite = "overwrite"
+	resolveSkip      = "skip"
+)
+
+// ImportEpisode ist eine gesehene Episode, WatchedAt ist leer, wenn die
+// Quelle den Zeitpunkt nicht kennt.
+type ImportEpisode struct {
+	Season    int       `json:"s"`
+	Episode   int       `json:"e"`
+	WatchedAt time.Time `json:"at,omitempty"`
+}
+
+// ImportRow ist eine Zeile der Importdatei. Nicht angegebene Werte sind nil
+// und lassen die Serie unverändert.
+type ImportRow struct {
+	Line            int             `json:"line"`
+	Title           string          `json:"title,omitempty"`
+	IMDBID          string          `json:"imdb_id,omitempty"`
+	Year            string          `json:"year,omitempty"`
+	Status          string          `json:"status,omitempty"` // leer = aus dem Fortschritt ableiten
+	EpisodesWatched *int            `json:"episodes_watched,omitempty"`
+	Episodes        []ImportEpisode `json:"episodes,omitempty"` // nil = nicht angegeben
+	Rating          *int            `json:"rating,omitempty"`
+	Notes           *string         `json:"notes,omitempty"`
+	Favorite        *bool           `json:"favorite,omitempty"`
+	Tags            []string        `json:"tags,omitempty"`  // nil = nicht angegeben
+	Error           string          `json:"error,omitempty"` // Grund, falls die Zeile nicht lesbar war
+}
+
+// Label nennt die Zeile so, wie sie in der Datei steht.
+func (r ImportRow) Label() string {
+	switch {
+	case r.Title != "" && r.Year != "":
+		return fmt.Sprintf("%s (%s)", r.Title, r.Year)
+	case r.Title != "":
+		return r.Title
+	}
+	return r.IMDBID
+}
+
+// Summary fasst die importierten Werte für die Konfliktauflösung zusammen.
+func (r ImportRow) Summary() string {
+	var parts []string
+	if r.Episodes != nil {
+		parts = append(parts, fmt.Sprintf("%d Episoden gesehen", len(r.Episodes)))
+	} else if r.EpisodesWatched != nil {
+		parts = append(parts, fmt.Sprintf("%d Episoden gesehen", *r.EpisodesWatched))
+	}
+	if r.Status != "" {
+		parts = append(parts, r.Status)
+	}
+	if r.Rating != nil && *r.Rating > 0 {
+		parts = append(parts, fmt.Sprintf("Bewertung %d/%d", *r.Rating, ratingMax))
+	}
+	if r.Favorite != nil && *r.Favorite {
+		parts = append(parts, "Favorit")
+	}
+	if len(r.Tags) > 0 {
+		parts = append(parts, "Tags: "+strings.Join(r.Tags, ", "))
+	}
+	if r.Notes != nil && *r.Notes != "" {
+		parts = append(parts, "Notizen")
+	}
+	if len(parts) == 0 {
+		return "keine weiteren Angaben"
+	}
+	return strings.Join(parts, " · ")
+}
+
+// validate prüft Werte, die aus dem Formular zurückkommen, erneut.
+func (r *ImportRow) validate() error {
+	if r.Status != "" && r.Status != "auto" && !isValidStatus(r.Status) {
+		return fmt.Errorf("invalid status %q", r.Status)
+	}
+	if r.EpisodesWatched != nil && *r.EpisodesWatched < 0 {
+		return fmt.Errorf("invalid episodes watched %d", *r.EpisodesWatched)
+	}
+	if r.Rating != nil {
+		if err := validateRating(*r.Rating); err != nil {
+			return err
+		}
+	}
+	if r.Notes != nil {
+		notes, err := normalizeNotes(*r.Notes)
+		if err != nil {
+			return err
+		}
+		r.Notes = &notes
+	}
+	if r.Tags != nil {
+		tags, err := normalizeTags(r.Tags)
+		if err != nil {
+			return err
+		}
+		r.Tags = tags
+	}
+	return nil
+}
+
+// ImportItem ist das Ergebnis der Zuordnung einer Zeile.
+type ImportItem struct {
+	Row        ImportRow
+	Match      *SeriesInfo
+	Existing   *Series // bereits in der Liste
+	Action     string
+	Resolution string // nur bei importConflict
+	Message    string
+}
+
+func (i ImportItem) ActionLabel() string {
+	switch i.Action {
+	case importNew:
+		return "Neu"
+	case importConflict:
+		return "Bereits vorhanden"
+	case importUnmatched:
+		return "Nicht gefunden"
+	case importDuplicate:
+		return "Doppelt"
+	}
+	return "Ungültig"
+}
+
+type ImportResult struct {
+	Added       int
+	Merged      int
+	Overwritten int
+	Skipped     int
+	Failed      []ImportItem
+}
+
+// planImport ordnet die Zeilen zu, ohne etwas zu speichern. resolve liefert
+// für Serien, die schon in der Liste sind, die gewählte Auflösung einer
+// Zeile; ohne Wahl wird zusammengeführt.
+func planImport(user string, rows []ImportRow, resolve func(line int) string) ([]ImportItem, error) {
+	series, err := store.LoadSeries(user)
+	if err != nil {
+		return nil, err
+	}
+	byIMDB := map[string]*Series{}
+	byTitle := map[string]*Series{}
+	for i := range series {
+		byIMDB[series[i].IMDBID] = &series[i]
+		byTitle[strings.ToLower(series[i].Title)] = &series[i]
+	}
+
+	items := make([]ImportItem, 0, len(rows))
+	seen := map[string]int{}
+	for _, row := range rows {
+		item := ImportItem{Row: row}
+		switch {
+		case row.Error != "":
+			item.Action = importInvalid
+			item.Message = row.Error
+		case row.Title == "" && row.IMDBID == "":
+			item.Action = importInvalid
+			item.Message = "weder Titel noch IMDb-ID"
+		default:
+			// Serien aus der eigenen Liste brauchen keine Anfrage, so
+			// klappt auch das Wiedereinlesen eines Exports ohne Anbieter.
+			existing := byIMDB[row.IMDBID]
+			if existing == nil && row.IMDBID == "" {
+				existing = byTitle[strings.ToLower(row.Title)]
+			}
+			if existing != nil {
+				item.Match = &SeriesInfo{Title: existing.Title, Year: existing.Year, IMDBID: existing.IMDBID}
+			} else {
+				matchImportRow(&item)
+			}
+		}
+		if item.Match != nil {
+			if line, ok := seen[item.Match.IMDBID]; ok {
+				item.Action = importDuplicate
+				item.Message = fmt.Sprintf("schon in Zeile %d", line)
+			} else {
+				seen[item.Match.IMDBID] = row.Line
+				item.Existing = byIMDB[item.Match.IMDBID]
+				item.Action = importNew
+				if item.Existing != nil {
+					item.Action = importConflict
+					item.Resolution = resolveMerge
+					switch r := resolve(row.Line); r {
+					case resolveOverwrite, resolveSkip:
+						item.Resolution = r
+					}
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// matchImportRow sucht die Serie über die IMDb-ID oder ersatzweise den Titel.
+func matchImportRow(item *ImportItem) {
+	identifier := item.Row.Title
+	if isIMDBID(item.Row.IMDBID) {
+		identifier = item.Row.IMDBID
+	}
+	info, err := metadata.Lookup(identifier)
+	if err != nil || info.IMDBID == "" {
+		item.Action = importUnmatched
+		if err != nil {
+			item.Message = err.Error()
+		}
+		return
+	}
+	item.Match = info
+	// Verglichen wird nur das Startjahr, "2008–2013" passt also zu "2008".
+	year := item.Row.Year
+	if len(year) > 4 {
+		year = year[:4]
+	}
+	if year != "" && !strings.HasPrefix(info.Year, year) {
+		item.Message = fmt.Sprintf("Jahr weicht ab (Datei: %s, gefunden: %s)", item.Row.Year, info.Year)
+	}
+}
+
+// applyImport führt den Plan aus. Fehler einzelner Zeilen brechen den
+// Import nicht ab, sondern landen in Failed. progress wird nach jeder Zeile
+// mit der Zahl der erledigten aufgerufen.
+func applyImport(user string, items []ImportItem, progress func(done int)) ImportResult {
+	var result ImportResult
+	for i, item := range items {
+		if progress != nil && i > 0 {
+			progress(i)
+		}
+		var err error
+		switch {
+		case item.Action == importNew:
+			var added Series
+			added, err = insertSeries(user, item.Match, fetchInitialSeasons(item.Match))
+			if err == nil {
+				err = importIntoSeries(user, added.ID, item.Row, resolveOverwrite)
+			}
+			if err == nil {
+				result.Added++
+			}
+		case item.Action == importConflict && item.Resolution == resolveSkip:
+			result.Skipped++
+		case item.Action == importConflict:
+			err = importIntoSeries(user, item.Existing.ID, item.Row, item.Resolution)
+			if err == nil && item.Resolution == resolveOverwrite {
+				result.Overwritten++
+			} else if err == nil {
+				result.Merged++
+			}
+		default:
+			result.Failed = append(result.Failed, item)
+		}
+		if err != nil {
+			log.Printf("import: line %d for %s failed: %v", item.Row.Line, user, err)
+			item.Action = importInvalid
+			item.Message = err.Error()
+			result.Failed = append(result.Failed, item)
+		}
+	}
+	return result
+}
+
+// importIntoSeries übernimmt eine Zeile in eine Serie und trägt gesehene
+// Episoden mit bekanntem Zeitpunkt in den Verlauf ein.
+func importIntoSeries(user string, id int, row ImportRow, mode string) error {
+	var events []WatchEvent
+	err := updateOneSeries(user, id, "", func(s *Series) error {
+		before := captureWatched(s)
+		if err := applyImportRow(s, row, mode); err != nil {
+			return err
+		}
+		events = importedEvents(before, s, row)
+		return nil
+	})
+	if err == nil {
+		if err := appendHistory(user, events...); err != nil {
+			log.Printf("history: failed to record import for %s: %v", user, err)
+		}
+	}
+	return err
+}
+
+// importedEvents liefert die neu gesehenen Episoden, deren Zeitpunkt die
+// Quelle kennt.
+func importedEvents(before watchedState, s *Series, row ImportRow) []WatchEvent {
+	watchedAt := map[[2]int]time.Time{}
+	for _, e := range row.Episodes {
+		if !e.WatchedAt.IsZero() {
+			watchedAt[[2]int{e.Season, e.Episode}] = e.WatchedAt
+		}
+	}
+	var events []WatchEvent
+	for _, e := range watchedChanges(before, s, sourceImport) {
+		at, ok := watchedAt[[2]int{e.Season, e.Episode}]
+		if e.Action != actionWatched || !ok {
+			continue
+		}
+		e.WatchedAt = at
+		events = append(events, e)
+	}
+	return events
+}
+
+// applyImportRow übernimmt die angegebenen Werte einer Zeile. Beim
+// Zusammenführen geht nichts verloren: Episoden und Tags kommen hinzu,
+// Bewertung, Notizen und Status werden nur gesetzt, wenn sie fehlen.
+func applyImportRow(s *Series, row ImportRow, mode string) error {
+	overwrite := mode == resolveOverwrite
+	if row.Episodes != nil {
+		markImportedEpisodes(s, row.Episodes, overwrite)
+	}
+	if row.EpisodesWatched != nil && (overwrite || *row.EpisodesWatched > s.EpisodesWatched) {
+		setWatchedCount(s, *row.EpisodesWatched)
+	}
+	// Nur ein abweichender Status wird als manuell gesetzt übernommen.
+	if row.Status != "" && row.Status != s.Status && (overwrite || !s.StatusManual) {
+		if err := setStatus(s, row.Status); err != nil {
+			return err
+		}
+	}
+	if row.Rating != nil && (overwrite || s.Rating == 0) {
+		s.Rating = *row.Rating
+	}
+	if row.Notes != nil && (overwrite || s.Notes == "") {
+		s.Notes = *row.Notes
+	}
+	if row.Favorite != nil {
+		s.Favorite = *row.Favorite || (!overwrite && s.Favorite)
+	}
+	if row.Tags != nil {
+		tags := row.Tags
+		if !overwrite {
+			tags = append(append([]string{}, s.Tags...), row.Tags...)
+		}
+		normalized, err := normalizeTags(tags)
+		if err != nil {
+			return err
+		}
+		s.Tags = normalized
+	}
+	return nil
+}
+
+// markImportedEpisodes setzt die gesehenen Episoden. Beim Überschreiben
+// gelten alle übrigen als ungesehen. Fehlt der Serie die Episodenliste,
+// bleibt nur der Zähler.
+func markImportedEpisodes(s *Series, episodes []ImportEpisode, overwrite bool) {
+	if len(s.Seasons) == 0 {
+		if overwrite || len(episodes) > s.EpisodesWatched {
+			setWatchedCount(s, len(episodes))
+		}
+		return
+	}
+	watched := map[[2]int]bool{}
+	for _, e := range episodes {
+		watched[[2]int{e.Season, e.Episode}] = true
+	}
+	for i := range s.Seasons {
+		for j := range s.Seasons[i].Episodes {
+			ep := &s.Seasons[i].Episodes[j]
+			if watched[[2]int{s.Seasons[i].Number, ep.Number}] {
+				ep.Watched = true
+			} else if overwrite {
+				ep.Watched = false
+			}
+		}
+	}
+	recountEpisodes(s)
+}
+
+// --- QUELLEN ---
+
+// importSource ist ein Format, aus dem importiert werden kann. Quellen ohne
+// parse (CSV) brauchen vorher die Zuordnung der Spalten.
+type importSource struct {
+	Key   string
+	Label string
+	Hint  string
+	parse func(name string, data []byte) ([]ImportRow, error)
+}
+
+var importSources = []importSource{
+	{"csv", "CSV-Datei", "Eine Zeile pro Serie mit Kopfzeile, getrennt durch Komma, Semikolon oder Tab. Die Spalten ordnest du im nächsten Schritt zu.", nil},
+	{"trakt", "Trakt", "JSON-Backup als ZIP oder einzelne Datei (watched-shows, history, ratings-shows, watchlist-shows). Gesehene Episoden kommen mit Zeitpunkt in den Verlauf.", parseTrakt},
+	{"tvtime", "TV Time", "DSGVO-Export als ZIP oder die Dateien seen_episode.csv bzw. followed_tv_show.csv. Zugeordnet wird über den Titel.", parseTVTime},
+	{"imdb", "IMDb", "Watchlist- oder Bewertungs-Export (CSV). Filme und einzelne Episoden werden übersprungen.", parseIMDb},
+}
+
+func findImportSource(key string) (importSource, bool) {
+	for _, source := range importSources {
+		if source.Key == key {
+			return source, true
+		}
+	}
+	return importSource{}, false
+}
+
+// isZip erkennt ZIP-Archive an ihrer Signatur.
+func isZip(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// importFiles liefert die Dateien einer Quelle nach Namen in Kleinbuchstaben
+// ohne Verzeichnis. Ein ZIP wird ausgepackt, sonst ist es nur die eine Datei.
+func importFiles(name string, data []byte) (map[string][]byte, error) {
+	if !isZip(data) {
+		return map[string][]byte{strings.ToLower(path.Base(name)): data}, nil
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file: %v", err)
+	}
+	files := map[string][]byte{}
+	var total int64
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		base := strings.ToLower(path.Base(f.Name))
+		if !strings.HasSuffix(base, ".json") && !strings.HasSuffix(base, ".csv") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip file: %v", err)
+		}
+		// Schutz vor Archiven, die beim Entpacken sehr groß werden.
+		content, err := io.ReadAll(io.LimitReader(rc, importMaxArchiveBytes-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip file: %v", err)
+		}
+		if total += int64(len(content)); total > importMaxArchiveBytes {
+			return nil, fmt.Errorf("archive is larger than %d MB when unpacked", importMaxArchiveBytes>>20)
+		}
+		files[base] = content
+	}
+	return files, nil
+}
+
+// importEntry sammelt alle Angaben zu einer Serie, die in Quellen wie Trakt
+// oder TV Time über mehrere Dateien und Zeilen verteilt sind.
+type importEntry struct {
+	row      ImportRow
+	episodes map[[2]int]time.Time
+}
+
+// see merkt sich eine gesehene Episode, bei mehrfachem Sehen zählt das
+// erste Mal.
+func (e *importEntry) see(season, number int, at *time.Time) {
+	key := [2]int{season, number}
+	var t time.Time
+	if at != nil {
+		t = *at
+	}
+	if old, ok := e.episodes[key]; ok && (t.IsZero() || (!old.IsZero() && old.Before(t))) {
+		return
+	}
+	e.episodes[key] = t
+}
+
+func sortedEpisodes(episodes map[[2]int]time.Time) []ImportEpisode {
+	list := make([]ImportEpisode, 0, len(episodes))
+	for key, at := range episodes {
+		list = append(list, ImportEpisode{Season: key[0], Episode: key[1], WatchedAt: at})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Season != list[j].Season {
+			return list[i].Season < list[j].Season
+		}
+		return list[i].Episode < list[j].Episode
+	})
+	return list
+}
+
+// entryRows macht aus den gesammelten Serien Zeilen in der Reihenfolge, in
+// der sie in der Quelle zuerst vorkamen.
+func entryRows(entries map[string]*importEntry, order []string) ([]ImportRow, error) {
+	rows := make([]ImportRow, 0, len(order))
+	for _, key := range order {
+		entry := entries[key]
+		if len(entry.episodes) > 0 {
+			entry.row.Episodes = sortedEpisodes(entry.episodes)
+		}
+		rows = append(rows, entry.row)
+	}
+	return numberRows(rows)
+}
+
+// numberRows vergibt laufende Nummern und begrenzt die Zahl der Serien.
+func numberRows(rows []ImportRow) ([]ImportRow, error) {
+	if len(rows) == 0 {
+		return nil, errors.New("no series found in file")
+	}
+	if len(rows) > importMaxRows {
+		return nil, fmt.Errorf("file has more than %d series, please split it into smaller files", importMaxRows)
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	return rows, nil
+}
+
+// --- HINTERGRUND-IMPORT ---
+
+// ImportJob ist ein laufender oder abgeschlossener Import eines Nutzers.
+// Je Nutzer läuft höchstens einer; das Ergebnis wird einmal angezeigt und
+// sonst nach importJobKeep verworfen.
+type ImportJob struct {
+	Total    int
+	Done     int
+	Started  time.Time
+	Finished time.Time
+	Result   ImportResult
+}
+
+func (j ImportJob) Running() bool {
+	return j.Finished.IsZero()
+}
+
+// Percent liefert den Fortschritt für die Anzeige.
+func (j ImportJob) Percent() int {
+	if j.Total == 0 {
+		return 100
+	}
+	return j.Done * 100 / j.Total
+}
+
+var (
+	importJobsMu sync.Mutex
+	importJobs   = map[string]*ImportJob{}
+
+	errImportRunning = errors.New("an import is already running, please wait until it has finished")
+)
+
+// startImportJob führt den Plan im Hintergrund aus.
+func startImportJob(user string, items []ImportItem) error {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+	if job, ok := importJobs[user]; ok && job.Running() {
+		return errImportRunning
+	}
+	job := &ImportJob{Total: len(items), Started: time.Now()}
+	importJobs[user] = job
+	go func() {
+		result := applyImport(user, items, func(done int) {
+			importJobsMu.Lock()
+			job.Done = done
+			importJobsMu.Unlock()
+		})
+		importJobsMu.Lock()
+		job.Done, job.Result, job.Finished = job.Total, result, time.Now()
+		importJobsMu.Unlock()
+		log.Printf("import: finished for %s in %s: %d added, %d merged, %d overwritten, %d skipped, %d failed",
+			user, time.Since(job.Started).Round(time.Second), result.Added, result.Merged, result.Overwritten, result.Skipped, len(result.Failed))
+	}()
+	return nil
+}
+
+// importJobStatus liefert eine Kopie des Imports. Ein abgeschlossener wird
+// dabei entfernt, damit sein Ergebnis nur einmal erscheint.
+func importJobStatus(user string) (ImportJob, bool) {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+	job, ok := importJobs[user]
+	if !ok {
+		return ImportJob{}, false
+	}
+	if !job.Running() {
+		delete(importJobs, user)
+		if time.Since(job.Finished) > importJobKeep {
+			return ImportJob{}, false
+		}
+	}
+	return *job, true
+}
+
+// --- HANDLER ---
+
+// ImportWizard hält den Stand des Assistenten. Die hochgeladene CSV-Datei
+// bzw. die schon gelesenen Zeilen anderer Quellen werden base64-kodiert von
+// Schritt zu Schritt im Formular weitergereicht.
+type ImportWizard struct {
+	Step     string // "upload", "map", "preview", "running" oder "done"
+	Source   string
+	Sources  []importSource
+	Data     string
+	FileName string
+	Headers  []string
+	Sample   [][]string
+	Fields   []importField
+	Mapping  map[string]int // Feld -> Spalte, -1 = nicht zugeordnet
+	Items    []ImportItem
+	Job      *ImportJob
+	Result   *ImportResult
+}
+
+// Count zählt die Zeilen des Probelaufs mit der Aktion action.
+func (w ImportWizard) Count(action string) int {
+	n := 0
+	for _, item := range w.Items {
+		if item.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// HasMapping gibt an, ob die Quelle die Spaltenzuordnung braucht.
+func (w ImportWizard) HasMapping() bool {
+	source, _ := findImportSource(w.Source)
+	return source.parse == nil
+}
+
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+	wizard := &ImportWizard{Step: "upload", Source: "csv", Sources: importSources, Fields: csvImportFields}
+	data.Import = wizard
+
+	if r.Method == "POST" {
+		if err := runImportStep(user, r, wizard); err != nil {
+			data.ErrorMessage = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		} else if wizard.Step == "running" {
+			http.Redirect(w, r, "/import", http.StatusSeeOther)
+			return
+		}
+	} else if job, ok := importJobStatus(user); ok {
+		wizard.Job = &job
+		wizard.Step = "running"
+		if !job.Running() {
+			res := job.Result
+			wizard.Result = &res
+			wizard.Step = "done"
+			data.SuccessMessage = fmt.Sprintf("Import abgeschlossen: %d neu, %d zusammengeführt, %d überschrieben, %d behalten",
+				res.Added, res.Merged, res.Overwritten, res.Skipped)
+		}
+	}
+	templates.ExecuteTemplate(w, "import.html", data)
+}
+
+// runImportStep führt den im Formular gewählten Schritt aus. Bei Fehlern
+// bleibt der Assistent auf dem Schritt, auf dem sie behoben werden können.
+func runImportStep(user string, r *http.Request, wizard *ImportWizard) error {
+	source, ok := findImportSource(r.FormValue("source"))
+	if !ok {
+		return errors.New("unknown import source")
+	}
+	wizard.Source = source.Key
+	wizard.FileName = r.FormValue("filename")
+	wizard.Data = r.FormValue("data")
+	step := r.FormValue("step")
+	switch step {
+	case "upload", "remap", "preview", "import":
+	default:
+		return errors.New("unknown step")
+	}
+
+	var rows []ImportRow
+	var err error
+	if source.parse == nil {
+		rows, err = csvWizardRows(r, wizard, step)
+	} else {
+		rows, err = sourceWizardRows(r, wizard, source, step)
+	}
+	if err != nil || rows == nil {
+		return err
+	}
+
+	items, err := planImport(user, rows, func(line int) string {
+		return r.FormValue("resolve_" + strconv.Itoa(line))
+	})
+	if err != nil {
+		log.Printf("import: failed to plan import for %s: %v", user, err)
+		return errors.New("failed to load your library")
+	}
+	wizard.Items = items
+	wizard.Step = "preview"
+	if step == "import" {
+		if err := startImportJob(user, items); err != nil {
+			return err
+		}
+		wizard.Step = "running"
+	}
+	return nil
+}
+
+// sourceWizardRows liest die Datei einer Quelle mit eigenem Format. Die
+// Zeilen werden als JSON weitergereicht, damit die Datei nur einmal
+// hochgeladen und gelesen wird.
+func sourceWizardRows(r *http.Request, wizard *ImportWizard, source importSource, step string) ([]ImportRow, error) {
+	if step == "upload" {
+		raw, err := readImportUpload(r, wizard, importMaxArchiveBytes)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := source.parse(wizard.FileName, raw)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(rows)
+		if err != nil {
+			return nil, err
+		}
+		wizard.Data = base64.StdEncoding.EncodeToString(encoded)
+		return rows, nil
+	}
+
+	raw, err := decodeImportData(wizard, importMaxArchiveBytes)
+	if err != nil {
+		return nil, err
+	}
+	var rows []ImportRow
+	if err := json.Unmarshal(raw, &rows); err != nil || len(rows) > importMaxRows {
+		wizard.Data = ""
+		return nil, errImportDataMissing
+	}
+	for i := range rows {
+		if err := rows[i].validate(); err != nil {
+			rows[i].Error = err.Error()
+		}
+	}
+	return rows, nil
+}
+
+var errImportDataMissing = errors.New("import data is missing, please upload the file again")
+
+func readImportUpload(r *http.Request, wizard *ImportWizard, limit int64) ([]byte, error) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New("please choose a file")
+	}
+	defer file.Close()
+	raw, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		return nil, fmt.Errorf("file is larger than %d KB", limit>>10)
+	}
+	wizard.FileName = header.Filename
+	return raw, nil
+}
+
+func decodeImportData(wizard *ImportWizard, limit int) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(wizard.Data)
+	if err != nil || len(raw) == 0 || len(raw) > limit {
+		wizard.Data = ""
+		return nil, errImportDataMissing
+	}
+	return raw, nil
+}
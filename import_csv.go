@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- CSV-EXPORT & -IMPORT ---
+
+// Der Export enthält alle Felder einer Serie außer dem Episodenbaum (den
+// liefert /api/v1/series). Der Import liest diese Spalten wieder ein, nimmt
+// aber auch fremde Dateien: Die Spalten werden im Assistenten zugeordnet.
+
+var csvExportHeader = []string{
+	"id", "imdb_id", "title", "year", "status", "episodes_watched", "total_episodes",
+	"progress", "rating", "favorite", "notes", "tags", "genres", "runtime", "cover_url",
+}
+
+// importField ist ein Feld, dem im Assistenten eine Spalte zugeordnet wird.
+// aliases sind bekannte Spaltennamen in Kleinbuchstaben.
+type importField struct {
+	Key     string
+	Label   string
+	aliases []string
+}
+
+var csvImportFields = []importField{
+	{"title", "Titel", []string{"title", "titel", "name", "serie", "series", "show"}},
+	{"imdb_id", "IMDb-ID", []string{"imdb_id", "imdb", "imdbid", "imdb id", "const"}},
+	{"year", "Jahr", []string{"year", "jahr"}},
+	{"status", "Status", []string{"status"}},
+	{"episodes_watched", "Gesehene Episoden", []string{"episodes_watched", "gesehen", "watched", "episoden", "episodes"}},
+	{"rating", "Bewertung", []string{"rating", "bewertung", "your rating"}},
+	{"favorite", "Favorit", []string{"favorite", "favourite", "favorit"}},
+	{"notes", "Notizen", []string{"notes", "notizen", "notiz", "comment"}},
+	{"tags", "Tags", []string{"tags", "tag"}},
+}
+
+// Statusangaben, die neben den eigenen Werten verstanden werden.
+var importStatusAliases = map[string]string{
+	"plan to watch": statusPlanToWatch,
+	"plantowatch":   statusPlanToWatch,
+	"geplant":       statusPlanToWatch,
+	"watching":      statusWatching,
+	"schaue ich":    statusWatching,
+	"on hold":       statusOnHold,
+	"onhold":        statusOnHold,
+	"pausiert":      statusOnHold,
+	"dropped":       statusDropped,
+	"abgebrochen":   statusDropped,
+	"completed":     statusCompleted,
+	"abgeschlossen": statusCompleted,
+	"auto":          "auto",
+}
+
+var errNoIdentifierColumn = errors.New("map at least a title or an IMDb ID column")
+
+// parseCSV liest eine CSV-Datei mit Kopfzeile. Das Trennzeichen (Komma,
+// Semikolon oder Tab) wird aus der Kopfzeile erraten. maxRows 0 heißt ohne
+// Begrenzung.
+func parseCSV(data []byte, maxRows int) ([]string, [][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = ','
+	for _, sep := range []rune{';', '\t'} {
+		if bytes.Count(firstLine, []byte(string(sep))) > bytes.Count(firstLine, []byte(string(reader.Comma))) {
+			reader.Comma = sep
+		}
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid csv: %v", err)
+	}
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid csv: %v", err)
+		}
+		if len(strings.TrimSpace(strings.Join(record, ""))) == 0 {
+			continue
+		}
+		if maxRows > 0 && len(records) == maxRows {
+			return nil, nil, fmt.Errorf("file has more than %d rows", maxRows)
+		}
+		records = append(records, record)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	return header, records, nil
+}
+
+// guessMapping ordnet die Spalten anhand ihrer Namen zu.
+func guessMapping(headers []string) map[string]int {
+	mapping := map[string]int{}
+	for _, field := range csvImportFields {
+		mapping[field.Key] = -1
+	}
+	for i, h := range headers {
+		name := strings.ToLower(strings.TrimSpace(h))
+		for _, field := range csvImportFields {
+			if mapping[field.Key] >= 0 {
+				continue
+			}
+			for _, alias := range field.aliases {
+				if name == alias || strings.ReplaceAll(name, " ", "_") == alias {
+					mapping[field.Key] = i
+				}
+			}
+		}
+	}
+	return mapping
+}
+
+// readMapping liest die Zuordnung aus dem Formular (map_<feld>=<spalte>).
+func readMapping(r *http.Request, columns int) (map[string]int, error) {
+	mapping := map[string]int{}
+	for _, field := range csvImportFields {
+		mapping[field.Key] = -1
+		if n, err := strconv.Atoi(r.FormValue("map_" + field.Key)); err == nil && n >= 0 && n < columns {
+			mapping[field.Key] = n
+		}
+	}
+	if mapping["title"] < 0 && mapping["imdb_id"] < 0 {
+		return mapping, errNoIdentifierColumn
+	}
+	return mapping, nil
+}
+
+// csvRows wandelt die Datensätze anhand der Zuordnung in ImportRows um.
+// Zeilennummern zählen die Kopfzeile mit, wie in einer Tabellenkalkulation.
+func csvRows(records [][]string, mapping map[string]int) []ImportRow {
+	rows := make([]ImportRow, 0, len(records))
+	for i, record := range records {
+		get := func(key string) string {
+			if col := mapping[key]; col >= 0 && col < len(record) {
+				return strings.TrimSpace(record[col])
+			}
+			return ""
+		}
+		row := ImportRow{
+			Line:   i + 2,
+			Title:  get("title"),
+			IMDBID: strings.ToLower(get("imdb_id")),
+			Year:   get("year"),
+		}
+		if err := parseCSVValues(&row, get); err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func parseCSVValues(row *ImportRow, get func(string) string) error {
+	if v := get("status"); v != "" {
+		status, err := parseImportStatus(v)
+		if err != nil {
+			return err
+		}
+		row.Status = status
+	}
+	if v := get("episodes_watched"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid episodes watched %q", v)
+		}
+		row.EpisodesWatched = &n
+	}
+	if v := get("rating"); v != "" {
+		rating, err := parseImportRating(v)
+		if err != nil {
+			return err
+		}
+		row.Rating = &rating
+	}
+	if v := get("favorite"); v != "" {
+		favorite := parseImportBool(v)
+		row.Favorite = &favorite
+	}
+	if v := get("notes"); v != "" {
+		notes, err := normalizeNotes(v)
+		if err != nil {
+			return err
+		}
+		row.Notes = &notes
+	}
+	if v := get("tags"); v != "" {
+		tags, err := parseTagInput(v)
+		if err != nil {
+			return err
+		}
+		row.Tags = tags
+	}
+	return nil
+}
+
+func parseImportStatus(v string) (string, error) {
+	for _, status := range validStatuses {
+		if strings.EqualFold(v, status) {
+			return status, nil
+		}
+	}
+	if status, ok := importStatusAliases[strings.ToLower(v)]; ok {
+		return status, nil
+	}
+	return "", fmt.Errorf("invalid status %q", v)
+}
+
+// parseImportRating versteht "8", "8/10" und "8,5" (wird gerundet).
+func parseImportRating(v string) (int, error) {
+	text := strings.TrimSpace(strings.SplitN(v, "/", 2)[0])
+	f, err := strconv.ParseFloat(strings.Replace(text, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rating %q", v)
+	}
+	rating := int(f + 0.5)
+	if err := validateRating(rating); err != nil {
+		return 0, err
+	}
+	return rating, nil
+}
+
+func parseImportBool(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes", "ja", "x", "y", "j", "★":
+		return true
+	}
+	return false
+}
+
+// csvColumn sucht eine Spalte anhand möglicher Namen, -1 wenn keine passt.
+func csvColumn(headers []string, names ...string) int {
+	for i, h := range headers {
+		for _, name := range names {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// --- HANDLER ---
+
+// csvWizardRows führt die CSV-Schritte des Assistenten aus: hochladen,
+// Spalten zuordnen und erst danach Zeilen liefern. Solange die Zuordnung
+// fehlt, ist das Ergebnis nil.
+func csvWizardRows(r *http.Request, wizard *ImportWizard, step string) ([]ImportRow, error) {
+	var raw []byte
+	var err error
+	if step == "upload" {
+		if raw, err = readImportUpload(r, wizard, importMaxBytes); err != nil {
+			return nil, err
+		}
+		wizard.Data = base64.StdEncoding.EncodeToString(raw)
+	} else if raw, err = decodeImportData(wizard, importMaxBytes); err != nil {
+		return nil, err
+	}
+
+	headers, records, err := parseCSV(raw, importMaxRows)
+	if err != nil {
+		wizard.Data = ""
+		return nil, err
+	}
+	wizard.Headers = headers
+	wizard.Sample = records
+	if len(wizard.Sample) > 5 {
+		wizard.Sample = wizard.Sample[:5]
+	}
+	wizard.Step = "map"
+
+	switch step {
+	case "upload":
+		wizard.Mapping = guessMapping(headers)
+		return nil, nil
+	case "remap":
+		// Zurück vom Probelauf, die bisherige Zuordnung bleibt erhalten.
+		wizard.Mapping, _ = readMapping(r, len(headers))
+		return nil, nil
+	}
+	if wizard.Mapping, err = readMapping(r, len(headers)); err != nil {
+		return nil, err
+	}
+	return csvRows(records, wizard.Mapping), nil
+}
+
+// exportCSVHandler liefert die Liste als CSV. Das BOM sorgt dafür, dass
+// Tabellenkalkulationen die Datei als UTF-8 erkennen.
+func exportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	series, err := store.LoadSeries(user)
+	if err != nil {
+		log.Printf("export: failed to load series of %s: %v", user, err)
+		http.Error(w, "failed to load series", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=mylist.csv")
+	io.WriteString(w, "\xef\xbb\xbf")
+	out := csv.NewWriter(w)
+	out.Write(csvExportHeader)
+	for _, s := range series {
+		rating := ""
+		if s.Rating > 0 {
+			rating = strconv.Itoa(s.Rating)
+		}
+		runtime := ""
+		if s.Runtime > 0 {
+			runtime = strconv.Itoa(s.Runtime)
+		}
+		out.Write([]string{
+			strconv.Itoa(s.ID), s.IMDBID, s.Title, s.Year, s.Status,
+			strconv.Itoa(s.EpisodesWatched), strconv.Itoa(s.TotalEpisodes), strconv.Itoa(s.Progress),
+			rating, strconv.FormatBool(s.Favorite), s.Notes, s.TagInput(),
+			strings.Join(s.Genres, ", "), runtime, s.CoverURL,
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("export: failed to write csv for %s: %v", user, err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		maxRows     int
+		wantHeaders []string
+		wantRows    int
+		wantErr     bool
+	}{
+		{"comma", "title,year\nDark,2017\nLost,2004\n", 0, []string{"title", "year"}, 2, false},
+		{"semicolon with bom", "\xef\xbb\xbftitle;notes\nDark;a, b\n", 0, []string{"title", "notes"}, 1, false},
+		{"tab", "title\tyear\nDark\t2017\n", 0, []string{"title", "year"}, 1, false},
+		{"blank lines are skipped", "title\nDark\n\n,\nLost\n", 0, []string{"title"}, 2, false},
+		{"row limit", "title\nA\nB\nC\n", 2, nil, 0, true},
+		{"empty", "", 0, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers, records, err := parseCSV([]byte(tt.data), tt.maxRows)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(headers, tt.wantHeaders) {
+				t.Errorf("headers = %q, want %q", headers, tt.wantHeaders)
+			}
+			if len(records) != tt.wantRows {
+				t.Errorf("got %d rows, want %d", len(records), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestGuessMapping(t *testing.T) {
+	mapping := guessMapping([]string{"Const", "Name", "Your Rating", "Episoden", "Sonstiges"})
+	want := map[string]int{"imdb_id": 0, "title": 1, "rating": 2, "episodes_watched": 3}
+	for key, col := range want {
+		if mapping[key] != col {
+			t.Errorf("mapping[%s] = %d, want %d", key, mapping[key], col)
+		}
+	}
+	for _, key := range []string{"year", "status", "favorite", "notes", "tags"} {
+		if mapping[key] != -1 {
+			t.Errorf("mapping[%s] = %d, want -1", key, mapping[key])
+		}
+	}
+}
+
+func TestCSVRows(t *testing.T) {
+	headers, records, err := parseCSV([]byte(
+		"title,imdb_id,status,episodes_watched,rating,favorite,tags\n"+
+			"Dark,TT5753856,abgeschlossen,26,8/10,ja,\"mystery, sci-fi\"\n"+
+			"Lost,,Watching,-1,,,\n"+
+			"Fargo,,,,11,,\n"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := csvRows(records, guessMapping(headers))
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	dark := rows[0]
+	if dark.Line != 2 || dark.IMDBID != "tt5753856" || dark.Status != statusCompleted || dark.Error != "" {
+		t.Errorf("dark = %+v", dark)
+	}
+	if dark.EpisodesWatched == nil || *dark.EpisodesWatched != 26 {
+		t.Errorf("dark episodes = %v, want 26", dark.EpisodesWatched)
+	}
+	if dark.Rating == nil || *dark.Rating != 8 {
+		t.Errorf("dark rating = %v, want 8", dark.Rating)
+	}
+	if dark.Favorite == nil || !*dark.Favorite {
+		t.Errorf("dark favorite = %v, want true", dark.Favorite)
+	}
+	if !reflect.DeepEqual(dark.Tags, []string{"mystery", "sci-fi"}) {
+		t.Errorf("dark tags = %q", dark.Tags)
+	}
+
+	if rows[1].Error == "" {
+		t.Error("negative episode count was accepted")
+	}
+	if rows[2].Error == "" {
+		t.Error("rating 11 was accepted")
+	}
+}
+
+func TestParseImportRating(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"8", 8, false},
+		{"8/10", 8, false},
+		{"7,5", 8, false},
+		{"10", 10, false},
+		{"0", 0, false}, // 0 entfernt die Bewertung
+		{"11", 0, true},
+		{"gut", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseImportRating(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseImportRating(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
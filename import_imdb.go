@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// --- IMPORT: IMDB ---
+
+// IMDb exportiert Watchlist, Bewertungen und eigene Listen als CSV mit der
+// IMDb-ID in der Spalte "Const". Übernommen werden nur Serien und
+// Miniserien, samt der eigenen Bewertung.
+
+// imdbSeriesTypes sind die Werte der Spalte "Title Type" für Serien, ohne
+// Leerzeichen und in Kleinbuchstaben (ältere Exporte: "tvSeries", neuere:
+// "TV Series").
+var imdbSeriesTypes = map[string]bool{"tvseries": true, "tvminiseries": true}
+
+func parseIMDb(name string, data []byte) ([]ImportRow, error) {
+	headers, records, err := parseCSV(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	id := csvColumn(headers, "Const")
+	if id < 0 {
+		return nil, errors.New("not an imdb export: column Const is missing")
+	}
+	title := csvColumn(headers, "Title")
+	year := csvColumn(headers, "Year")
+	kind := csvColumn(headers, "Title Type")
+	rating := csvColumn(headers, "Your Rating")
+
+	get := func(record []string, col int) string {
+		if col >= 0 && col < len(record) {
+			return strings.TrimSpace(record[col])
+		}
+		return ""
+	}
+	var rows []ImportRow
+	for _, record := range records {
+		if kind >= 0 && !imdbSeriesTypes[strings.ToLower(strings.ReplaceAll(get(record, kind), " ", ""))] {
+			continue
+		}
+		row := ImportRow{
+			Title:  get(record, title),
+			IMDBID: strings.ToLower(get(record, id)),
+			Year:   get(record, year),
+		}
+		if v := get(record, rating); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && validateRating(n) == nil {
+				row.Rating = &n
+			} else {
+				row.Error = "invalid rating " + strconv.Quote(v)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return numberRows(rows)
+}
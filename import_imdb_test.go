@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestParseIMDb(t *testing.T) {
+	data := "Position,Const,Created,Title,Title Type,Your Rating,Year\n" +
+		"1,tt5753856,2024-01-01,Dark,TV Series,9,2017\n" +
+		"2,tt0113277,2024-01-01,Heat,Movie,8,1995\n" +
+		"3,tt7366338,2024-01-01,Chernobyl,TV Mini Series,,2019\n" +
+		"4,tt0944947,2024-01-01,Game of Thrones,tvSeries,zehn,2011\n" +
+		"5,tt1480055,2024-01-01,Winter Is Coming,TV Episode,7,2011\n"
+	rows, err := parseIMDb("ratings.csv", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want the three series: %+v", len(rows), rows)
+	}
+
+	dark := rows[0]
+	if dark.IMDBID != "tt5753856" || dark.Title != "Dark" || dark.Year != "2017" || dark.Rating == nil || *dark.Rating != 9 {
+		t.Errorf("dark = %+v", dark)
+	}
+	if chernobyl := rows[1]; chernobyl.Title != "Chernobyl" || chernobyl.Rating != nil || chernobyl.Line != 2 {
+		t.Errorf("chernobyl = %+v, want no rating in line 2", chernobyl)
+	}
+	if got := rows[2]; got.Error == "" {
+		t.Errorf("invalid rating was accepted: %+v", got)
+	}
+}
+
+func TestParseIMDbErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"no const column", "Title,Year\nDark,2017\n"},
+		{"only movies", "Const,Title,Title Type\ntt0113277,Heat,Movie\n"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		if _, err := parseIMDb("export.csv", []byte(tt.data)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
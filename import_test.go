@@ -0,0 +1,71 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipFiles packt Dateien für Tests in ein ZIP.
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportFiles(t *testing.T) {
+	files, err := importFiles("Export/Watched-Shows.JSON", []byte("[]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["watched-shows.json"]; !ok || len(files) != 1 {
+		t.Errorf("single file = %v, want watched-shows.json", files)
+	}
+
+	data := zipFiles(t, map[string]string{
+		"backup/History.json": "[]",
+		"backup/seen.csv":     "a",
+		"backup/readme.txt":   "skipped",
+	})
+	files, err = importFiles("backup.zip", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files["history.json"] == nil || files["seen.csv"] == nil {
+		t.Errorf("zip files = %v, want history.json and seen.csv", files)
+	}
+
+	if _, err := importFiles("broken.zip", []byte("PK\x03\x04broken")); err == nil {
+		t.Error("broken zip was accepted")
+	}
+}
+
+func TestNumberRows(t *testing.T) {
+	rows, err := numberRows([]ImportRow{{Title: "A"}, {Title: "B"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].Line != 1 || rows[1].Line != 2 {
+		t.Errorf("lines = %d, %d, want 1, 2", rows[0].Line, rows[1].Line)
+	}
+	if _, err := numberRows(nil); err == nil {
+		t.Error("empty file was accepted")
+	}
+	if _, err := numberRows(make([]ImportRow, importMaxRows+1)); err == nil || !strings.Contains(err.Error(), "split") {
+		t.Errorf("err = %v, want the row limit", err)
+	}
+}
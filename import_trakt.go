@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- IMPORT: TRAKT ---
+
+// Trakt-Backups bestehen aus mehreren JSON-Dateien mit Listen von Einträgen,
+// die alle ein "show"-Objekt tragen. Gelesen werden gesehene Serien
+// (watched-shows), der Verlauf (history), Bewertungen (ratings-shows) und
+// die Watchlist; Filme und Episodenbewertungen werden übersprungen.
+
+type traktShow struct {
+	Title string `json:"title"`
+	Year  int    `json:"year"`
+	IDs   struct {
+		Trakt int    `json:"trakt"`
+		IMDB  string `json:"imdb"`
+	} `json:"ids"`
+}
+
+type traktItem struct {
+	Type    string     `json:"type"`
+	Show    *traktShow `json:"show"`
+	Episode *struct {
+		Season int `json:"season"`
+		Number int `json:"number"`
+	} `json:"episode"`
+	Rating    int        `json:"rating"`
+	WatchedAt *time.Time `json:"watched_at"`
+	Seasons   []struct {
+		Number   int `json:"number"`
+		Episodes []struct {
+			Number        int        `json:"number"`
+			LastWatchedAt *time.Time `json:"last_watched_at"`
+		} `json:"episodes"`
+	} `json:"seasons"`
+}
+
+func parseTrakt(name string, data []byte) ([]ImportRow, error) {
+	files, err := importFiles(name, data)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for n := range files {
+		if strings.HasSuffix(n, ".json") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	entries := map[string]*importEntry{}
+	var order []string
+	read := 0
+	for _, n := range names {
+		var items []traktItem
+		// Andere Dateien des Backups (Profil, Einstellungen) sind keine
+		// Listen und werden übergangen.
+		if err := json.Unmarshal(files[n], &items); err != nil {
+			continue
+		}
+		read++
+		for _, item := range items {
+			if item.Show == nil || item.Type == "movie" || item.Type == "season" {
+				continue
+			}
+			key := traktKey(item.Show)
+			entry, ok := entries[key]
+			if !ok {
+				entry = &importEntry{row: ImportRow{Title: item.Show.Title, IMDBID: item.Show.IDs.IMDB}, episodes: map[[2]int]time.Time{}}
+				if item.Show.Year > 0 {
+					entry.row.Year = strconv.Itoa(item.Show.Year)
+				}
+				entries[key] = entry
+				order = append(order, key)
+			}
+			switch {
+			case item.Episode != nil:
+				// Bewertungen einzelner Episoden haben keinen Zeitpunkt.
+				if item.WatchedAt != nil {
+					entry.see(item.Episode.Season, item.Episode.Number, item.WatchedAt)
+				}
+			case item.Rating > 0:
+				rating := item.Rating
+				entry.row.Rating = &rating
+			}
+			for _, season := range item.Seasons {
+				for _, e := range season.Episodes {
+					entry.see(season.Number, e.Number, e.LastWatchedAt)
+				}
+			}
+		}
+	}
+	if read == 0 {
+		return nil, errors.New("no trakt export found in file")
+	}
+
+	return entryRows(entries, order)
+}
+
+// traktKey fasst Einträge derselben Serie aus verschiedenen Dateien zusammen.
+func traktKey(show *traktShow) string {
+	switch {
+	case show.IDs.Trakt > 0:
+		return "trakt:" + strconv.Itoa(show.IDs.Trakt)
+	case show.IDs.IMDB != "":
+		return "imdb:" + show.IDs.IMDB
+	}
+	return "title:" + strings.ToLower(show.Title) + ":" + strconv.Itoa(show.Year)
+}
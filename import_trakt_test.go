@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+const traktWatchedShows = `[
+  {
+    "plays": 3,
+    "show": {"title": "Dark", "year": 2017, "ids": {"trakt": 1, "imdb": "tt5753856"}},
+    "seasons": [
+      {"number": 1, "episodes": [
+        {"number": 1, "last_watched_at": "2024-01-02T20:00:00.000Z"},
+        {"number": 2, "last_watched_at": "2024-01-03T20:00:00.000Z"}
+      ]}
+    ]
+  }
+]`
+
+const traktHistory = `[
+  {"type": "episode", "watched_at": "2023-12-31T21:00:00.000Z",
+   "episode": {"season": 1, "number": 1},
+   "show": {"title": "Dark", "year": 2017, "ids": {"trakt": 1, "imdb": "tt5753856"}}},
+  {"type": "movie", "watched_at": "2024-01-01T10:00:00.000Z",
+   "movie": {"title": "Heat"}}
+]`
+
+const traktRatings = `[
+  {"type": "show", "rating": 9,
+   "show": {"title": "Fargo", "year": 2014, "ids": {"trakt": 2, "imdb": "tt2802850"}}},
+  {"type": "episode", "rating": 7,
+   "episode": {"season": 1, "number": 1},
+   "show": {"title": "Dark", "year": 2017, "ids": {"trakt": 1, "imdb": "tt5753856"}}}
+]`
+
+func TestParseTraktZip(t *testing.T) {
+	data := zipFiles(t, map[string]string{
+		"trakt/watched-shows.json": traktWatchedShows,
+		"trakt/history.json":       traktHistory,
+		"trakt/ratings-shows.json": traktRatings,
+		"trakt/profile.json":       `{"username": "anna"}`,
+	})
+	rows, err := parseTrakt("trakt.zip", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want Dark and Fargo: %+v", len(rows), rows)
+	}
+	byID := map[string]ImportRow{}
+	for _, row := range rows {
+		byID[row.IMDBID] = row
+	}
+
+	dark := byID["tt5753856"]
+	if dark.Title != "Dark" || dark.Year != "2017" || dark.Rating != nil {
+		t.Errorf("dark = %+v", dark)
+	}
+	if len(dark.Episodes) != 2 {
+		t.Fatalf("dark episodes = %+v, want 2", dark.Episodes)
+	}
+	// Mehrfach gesehen zählt das erste Mal.
+	first := time.Date(2023, 12, 31, 21, 0, 0, 0, time.UTC)
+	if e := dark.Episodes[0]; e.Season != 1 || e.Episode != 1 || !e.WatchedAt.Equal(first) {
+		t.Errorf("first episode = %+v, want S1E1 at %s", e, first)
+	}
+
+	fargo := byID["tt2802850"]
+	if fargo.Rating == nil || *fargo.Rating != 9 || fargo.Episodes != nil {
+		t.Errorf("fargo = %+v, want rating 9 and no episodes", fargo)
+	}
+}
+
+func TestParseTraktSingleFile(t *testing.T) {
+	rows, err := parseTrakt("ratings-shows.json", []byte(traktRatings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Line != 1 || rows[1].Line != 2 {
+		t.Errorf("rows = %+v, want two numbered rows", rows)
+	}
+}
+
+func TestParseTraktErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data []byte
+	}{
+		{"no list", "profile.json", []byte(`{"username": "anna"}`)},
+		{"only movies", "history.json", []byte(`[{"type": "movie", "movie": {"title": "Heat"}}]`)},
+	}
+	for _, tt := range tests {
+		if _, err := parseTrakt(tt.file, tt.data); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- IMPORT: TV TIME ---
+
+// Der DSGVO-Export von TV Time ist ein ZIP mit CSV-Dateien. Gelesen werden
+// seen_episode.csv (gesehene Episoden mit Zeitpunkt) und followed_tv_show.csv
+// (gefolgte Serien). IMDb-IDs enthält der Export nicht, die Zuordnung läuft
+// daher über den Titel.
+
+// tvtimeLayouts sind die Zeitformate im Export, die Zeiten sind in UTC.
+var tvtimeLayouts = []string{"2006-01-02 15:04:05", time.RFC3339, "2006-01-02"}
+
+func parseTVTime(name string, data []byte) ([]ImportRow, error) {
+	files, err := importFiles(name, data)
+	if err != nil {
+		return nil, err
+	}
+	seen, hasSeen := files["seen_episode.csv"]
+	followed, hasFollowed := files["followed_tv_show.csv"]
+	if !hasSeen && !hasFollowed {
+		return nil, errors.New("no seen_episode.csv or followed_tv_show.csv found in file")
+	}
+
+	entries := map[string]*importEntry{}
+	var order []string
+	entry := func(title string) *importEntry {
+		key := strings.ToLower(title)
+		e, ok := entries[key]
+		if !ok {
+			e = &importEntry{row: ImportRow{Title: title}, episodes: map[[2]int]time.Time{}}
+			entries[key] = e
+			order = append(order, key)
+		}
+		return e
+	}
+
+	if hasFollowed {
+		headers, records, err := parseCSV(followed, 0)
+		if err != nil {
+			return nil, err
+		}
+		col := csvColumn(headers, "tv_show_name", "show_name", "name")
+		if col < 0 {
+			return nil, errors.New("followed_tv_show.csv has no show name column")
+		}
+		for _, record := range records {
+			if col < len(record) && strings.TrimSpace(record[col]) != "" {
+				entry(strings.TrimSpace(record[col]))
+			}
+		}
+	}
+
+	if hasSeen {
+		headers, records, err := parseCSV(seen, 0)
+		if err != nil {
+			return nil, err
+		}
+		show := csvColumn(headers, "tv_show_name", "show_name")
+		season := csvColumn(headers, "episode_season_number", "season_number", "season")
+		number := csvColumn(headers, "episode_number", "number")
+		at := csvColumn(headers, "created_at", "watched_at", "updated_at")
+		if show < 0 || season < 0 || number < 0 {
+			return nil, errors.New("seen_episode.csv is missing show, season or episode columns")
+		}
+		for _, record := range records {
+			if show >= len(record) || season >= len(record) || number >= len(record) {
+				continue
+			}
+			s, err1 := strconv.Atoi(strings.TrimSpace(record[season]))
+			n, err2 := strconv.Atoi(strings.TrimSpace(record[number]))
+			title := strings.TrimSpace(record[show])
+			if err1 != nil || err2 != nil || title == "" {
+				continue
+			}
+			var watchedAt *time.Time
+			if at >= 0 && at < len(record) {
+				watchedAt = parseTVTimeTime(record[at])
+			}
+			entry(title).see(s, n, watchedAt)
+		}
+	}
+
+	return entryRows(entries, order)
+}
+
+func parseTVTimeTime(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range tvtimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
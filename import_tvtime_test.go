@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTVTime(t *testing.T) {
+	data := zipFiles(t, map[string]string{
+		"gdpr/followed_tv_show.csv": "tv_show_name,created_at\nFargo,2024-01-01 10:00:00\nDark,2024-01-01 10:00:00\n",
+		"gdpr/seen_episode.csv": "tv_show_name,episode_season_number,episode_number,created_at\n" +
+			"Dark,1,2,2024-02-01 21:00:00\n" +
+			"dark,1,1,2024-01-31 21:00:00\n" +
+			"Dark,1,1,2024-03-01 21:00:00\n" +
+			"Dark,x,3,2024-03-02 21:00:00\n" +
+			"Lost,1,1,\n",
+	})
+	rows, err := parseTVTime("tvtime.zip", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want Fargo, Dark and Lost: %+v", len(rows), rows)
+	}
+	if rows[0].Title != "Fargo" || rows[0].Episodes != nil {
+		t.Errorf("first row = %+v, want Fargo without episodes", rows[0])
+	}
+
+	dark := rows[1]
+	if dark.Title != "Dark" || len(dark.Episodes) != 2 {
+		t.Fatalf("dark = %+v, want two episodes", dark)
+	}
+	want := time.Date(2024, 1, 31, 21, 0, 0, 0, time.UTC)
+	if e := dark.Episodes[0]; e.Season != 1 || e.Episode != 1 || !e.WatchedAt.Equal(want) {
+		t.Errorf("S1E1 = %+v, want first viewing at %s", e, want)
+	}
+
+	lost := rows[2]
+	if len(lost.Episodes) != 1 || !lost.Episodes[0].WatchedAt.IsZero() {
+		t.Errorf("lost = %+v, want one episode without time", lost)
+	}
+}
+
+func TestParseTVTimeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data []byte
+	}{
+		{"unknown file", "tvtime.zip", zipFiles(t, map[string]string{"user.csv": "a\n1\n"})},
+		{"missing columns", "seen_episode.csv", []byte("tv_show_name,created_at\nDark,2024-01-01 10:00:00\n")},
+	}
+	for _, tt := range tests {
+		if _, err := parseTVTime(tt.file, tt.data); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestParseTVTimeTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-01-31 21:00:00", time.Date(2024, 1, 31, 21, 0, 0, 0, time.UTC)},
+		{"2024-01-31T21:00:00+01:00", time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)},
+		{" 2024-01-31 ", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got := parseTVTimeTime(tt.in)
+		if got == nil || !got.Equal(tt.want) {
+			t.Errorf("parseTVTimeTime(%q) = %v, want %s", tt.in, got, tt.want)
+		}
+	}
+	if got := parseTVTimeTime("gestern"); got != nil {
+		t.Errorf("parseTVTimeTime(gestern) = %v, want nil", got)
+	}
+}
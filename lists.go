@@ -0,0 +1,545 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// --- TAGS ---
+
+// Tags stehen direkt an der Serie und werden klein geschrieben gespeichert,
+// damit "Anime" und "anime" derselbe Tag sind.
+
+const (
+	tagsMaxCount = 20
+	tagMaxRunes  = 40
+)
+
+// normalizeTags bereinigt Tags, entfernt doppelte und sortiert sie.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > tagMaxRunes {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, tagMaxRunes)
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("tag %q must not contain commas", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > tagsMaxCount {
+		return nil, fmt.Errorf("at most %d tags per series", tagsMaxCount)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// parseTagInput zerlegt die Eingabe "anime, mit Kindern" aus dem Formular.
+func parseTagInput(input string) ([]string, error) {
+	return normalizeTags(strings.Split(input, ","))
+}
+
+func (s Series) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TagInput liefert die Tags für das Eingabefeld.
+func (s Series) TagInput() string {
+	return strings.Join(s.Tags, ", ")
+}
+
+// collectTags liefert alle vergebenen Tags für die Filterauswahl.
+func collectTags(series []Series) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, s := range series {
+		for _, t := range s.Tags {
+			if !seen[t] {
+				seen[t] = true
+				tags = append(tags, t)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// --- EIGENE LISTEN ---
+
+// Eigene Listen wie "Wochenende" liegen pro Nutzer in data/lists/<nutzer>.json.
+// Sie verweisen über die IMDb-ID auf Serien, da IDs nach dem Löschen neu
+// vergeben werden können. Die Reihenfolge im Slice ist die der Liste.
+
+const (
+	listsSubdir   = "lists"
+	listNameMax   = 60
+	listsMaxCount = 100
+	listMoveUp    = -1
+	listMoveDown  = 1
+)
+
+var (
+	listsDir = filepath.Join(dataDir, listsSubdir)
+	listsMu  sync.Mutex
+
+	errListNotFound  = errors.New("list not found")
+	errListExists    = errors.New("a list with this name already exists")
+	errListName      = fmt.Errorf("list name must be 1 to %d characters", listNameMax)
+	errTooManyLists  = fmt.Errorf("at most %d lists per user", listsMaxCount)
+	errAlreadyInList = errors.New("series is already in this list")
+	errNotInList     = errors.New("series is not in this list")
+)
+
+// CustomList ist eine benannte Liste mit eigener Reihenfolge.
+type CustomList struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Series  []string  `json:"series"` // IMDb-IDs in der Reihenfolge der Liste
+	Created time.Time `json:"created"`
+}
+
+func (l CustomList) Contains(imdbID string) bool {
+	return l.position(imdbID) >= 0
+}
+
+func (l CustomList) position(imdbID string) int {
+	for i, id := range l.Series {
+		if id == imdbID {
+			return i
+		}
+	}
+	return -1
+}
+
+func listsFile(username string) string {
+	return filepath.Join(listsDir, username+".json")
+}
+
+// loadLists liest die Listen des Nutzers. Ohne Datei gibt es keine Listen.
+func loadLists(username string) ([]CustomList, error) {
+	listsMu.Lock()
+	defer listsMu.Unlock()
+	return readLists(username)
+}
+
+func readLists(username string) ([]CustomList, error) {
+	data, err := os.ReadFile(listsFile(username))
+	if os.IsNotExist(err) {
+		return []CustomList{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lists []CustomList
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return nil, fmt.Errorf("failed to read lists of %s: %v", username, err)
+	}
+	return lists, nil
+}
+
+// updateLists liest, ändert und schreibt die Listen unter einer Sperre.
+func updateLists(username string, fn func([]CustomList) ([]CustomList, error)) error {
+	listsMu.Lock()
+	defer listsMu.Unlock()
+	lists, err := readLists(username)
+	if err != nil {
+		return err
+	}
+	lists, err = fn(lists)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(lists, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(listsDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(listsFile(username), data)
+}
+
+func findList(lists []CustomList, id int) int {
+	for i := range lists {
+		if lists[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func validateListName(lists []CustomList, name string, except int) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || utf8.RuneCountInString(name) > listNameMax {
+		return "", errListName
+	}
+	for _, l := range lists {
+		if l.ID != except && strings.EqualFold(l.Name, name) {
+			return "", errListExists
+		}
+	}
+	return name, nil
+}
+
+func createList(username, name string) (CustomList, error) {
+	var created CustomList
+	err := updateLists(username, func(lists []CustomList) ([]CustomList, error) {
+		if len(lists) >= listsMaxCount {
+			return nil, errTooManyLists
+		}
+		name, err := validateListName(lists, name, 0)
+		if err != nil {
+			return nil, err
+		}
+		nextID := 1
+		for _, l := range lists {
+			if l.ID >= nextID {
+				nextID = l.ID + 1
+			}
+		}
+		created = CustomList{ID: nextID, Name: name, Series: []string{}, Created: time.Now()}
+		return append(lists, created), nil
+	})
+	return created, err
+}
+
+// updateOneList wendet fn auf die Liste mit der ID an.
+func updateOneList(username string, id int, fn func(l *CustomList) error) error {
+	return updateLists(username, func(lists []CustomList) ([]CustomList, error) {
+		i := findList(lists, id)
+		if i < 0 {
+			return nil, errListNotFound
+		}
+		if err := fn(&lists[i]); err != nil {
+			return nil, err
+		}
+		return lists, nil
+	})
+}
+
+func renameList(username string, id int, name string) error {
+	return updateLists(username, func(lists []CustomList) ([]CustomList, error) {
+		i := findList(lists, id)
+		if i < 0 {
+			return nil, errListNotFound
+		}
+		name, err := validateListName(lists, name, id)
+		if err != nil {
+			return nil, err
+		}
+		lists[i].Name = name
+		return lists, nil
+	})
+}
+
+func deleteList(username string, id int) error {
+	return updateLists(username, func(lists []CustomList) ([]CustomList, error) {
+		i := findList(lists, id)
+		if i < 0 {
+			return nil, errListNotFound
+		}
+		return append(lists[:i], lists[i+1:]...), nil
+	})
+}
+
+func addToList(username string, id int, imdbID string) error {
+	return updateOneList(username, id, func(l *CustomList) error {
+		if l.Contains(imdbID) {
+			return errAlreadyInList
+		}
+		l.Series = append(l.Series, imdbID)
+		return nil
+	})
+}
+
+func removeFromList(username string, id int, imdbID string) error {
+	return updateOneList(username, id, func(l *CustomList) error {
+		pos := l.position(imdbID)
+		if pos < 0 {
+			return errNotInList
+		}
+		l.Series = append(l.Series[:pos], l.Series[pos+1:]...)
+		return nil
+	})
+}
+
+// moveInList verschiebt eine Serie um delta sichtbare Plätze. Einträge
+// gelöschter Serien bleiben für den Papierkorb in der Liste, werden beim
+// Verschieben aber übersprungen. Am Rand bleibt die Serie stehen.
+func moveInList(username string, id int, imdbID string, delta int) error {
+	visible := map[string]bool{}
+	for _, s := range loadSeriesForUser(username) {
+		visible[s.IMDBID] = true
+	}
+	return updateOneList(username, id, func(l *CustomList) error {
+		pos := l.position(imdbID)
+		if pos < 0 {
+			return errNotInList
+		}
+		step := 1
+		if delta < 0 {
+			step, delta = -1, -delta
+		}
+		target := pos
+		for i := pos + step; i >= 0 && i < len(l.Series) && delta > 0; i += step {
+			if visible[l.Series[i]] {
+				target = i
+				delta--
+			}
+		}
+		l.Series[pos], l.Series[target] = l.Series[target], l.Series[pos]
+		return nil
+	})
+}
+
+// setSeriesLists legt fest, in welchen Listen eine Serie steht. Neu
+// hinzugekommene Listen bekommen sie ans Ende.
+func setSeriesLists(username, imdbID string, listIDs []int) error {
+	wanted := map[int]bool{}
+	for _, id := range listIDs {
+		wanted[id] = true
+	}
+	return updateLists(username, func(lists []CustomList) ([]CustomList, error) {
+		for id := range wanted {
+			if findList(lists, id) < 0 {
+				return nil, errListNotFound
+			}
+		}
+		for i := range lists {
+			pos := lists[i].position(imdbID)
+			switch {
+			case wanted[lists[i].ID] && pos < 0:
+				lists[i].Series = append(lists[i].Series, imdbID)
+			case !wanted[lists[i].ID] && pos >= 0:
+				lists[i].Series = append(lists[i].Series[:pos], lists[i].Series[pos+1:]...)
+			}
+		}
+		return lists, nil
+	})
+}
+
+// listSeries liefert die Serien einer Liste in deren Reihenfolge. Einträge
+// gelöschter Serien werden übersprungen.
+func listSeries(l CustomList, series []Series) []Series {
+	byIMDB := map[string]Series{}
+	for _, s := range series {
+		byIMDB[s.IMDBID] = s
+	}
+	ordered := []Series{}
+	for _, id := range l.Series {
+		if s, ok := byIMDB[id]; ok {
+			ordered = append(ordered, s)
+		}
+	}
+	return ordered
+}
+
+func hasSeriesWithIMDB(username, imdbID string) bool {
+	if imdbID == "" {
+		return false
+	}
+	for _, s := range loadSeriesForUser(username) {
+		if s.IMDBID == imdbID {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByList ordnet series nach der Reihenfolge der Liste.
+func sortByList(series []Series, l CustomList) {
+	sort.SliceStable(series, func(i, j int) bool {
+		return l.position(series[i].IMDBID) < l.position(series[j].IMDBID)
+	})
+}
+
+func renameLists(oldName, newName string) error {
+	listsMu.Lock()
+	defer listsMu.Unlock()
+	err := os.Rename(listsFile(oldName), listsFile(newName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func deleteLists(username string) error {
+	listsMu.Lock()
+	defer listsMu.Unlock()
+	err := os.Remove(listsFile(username))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readListsFile liefert die Datei unverändert, z. B. für Sicherungen.
+func readListsFile(username string) ([]byte, error) {
+	listsMu.Lock()
+	defer listsMu.Unlock()
+	data, err := os.ReadFile(listsFile(username))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// replaceLists ersetzt die Datei beim Wiederherstellen einer Sicherung.
+// Ohne Inhalt wird sie gelöscht.
+func replaceLists(username string, data []byte) error {
+	if len(data) == 0 {
+		return deleteLists(username)
+	}
+	listsMu.Lock()
+	defer listsMu.Unlock()
+	if err := os.MkdirAll(listsDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(listsFile(username), data)
+}
+
+// --- HANDLER ---
+
+// tagsHandler speichert die Tags einer Serie von der Detailseite.
+func tagsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	tags, err := parseTagInput(r.FormValue("tags"))
+	if err == nil {
+		err = updateOneSeries(user, id, sourceWeb, func(s *Series) error {
+			s.Tags = tags
+			return nil
+		})
+	}
+	redirectToSeries(w, r, id, err)
+}
+
+// listsHandler zeigt /lists bzw. mit ?id= eine einzelne Liste zum Ordnen.
+func listsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+	listID, _ := strconv.Atoi(r.FormValue("id"))
+	status := http.StatusOK
+
+	if r.Method == "POST" {
+		imdbID := r.FormValue("imdb_id")
+		var err error
+		switch r.FormValue("action") {
+		case "create":
+			var created CustomList
+			created, err = createList(user, r.FormValue("name"))
+			if err == nil {
+				data.SuccessMessage = fmt.Sprintf("Liste „%s“ angelegt", created.Name)
+			}
+		case "rename":
+			err = renameList(user, listID, r.FormValue("name"))
+			if err == nil {
+				data.SuccessMessage = "Liste umbenannt"
+			}
+		case "delete":
+			err = deleteList(user, listID)
+			if err == nil {
+				data.SuccessMessage = "Liste gelöscht"
+				listID = 0
+			}
+		case "add":
+			if !hasSeriesWithIMDB(user, imdbID) {
+				err = errSeriesNotFound
+			} else {
+				err = addToList(user, listID, imdbID)
+			}
+		case "remove":
+			err = removeFromList(user, listID, imdbID)
+		case "move_up":
+			err = moveInList(user, listID, imdbID, listMoveUp)
+		case "move_down":
+			err = moveInList(user, listID, imdbID, listMoveDown)
+		case "membership":
+			// Kommt von der Detailseite einer Serie und kehrt dorthin zurück.
+			seriesID, _ := strconv.Atoi(r.FormValue("series_id"))
+			var ids []int
+			for _, v := range r.Form["list"] {
+				if n, convErr := strconv.Atoi(v); convErr == nil {
+					ids = append(ids, n)
+				}
+			}
+			if imdbID == "" {
+				err = errNoIMDBID
+			} else {
+				err = setSeriesLists(user, imdbID, ids)
+			}
+			redirectToSeries(w, r, seriesID, err)
+			return
+		default:
+			err = errors.New("unknown action")
+		}
+		if err != nil {
+			data.ErrorMessage = err.Error()
+			status = http.StatusBadRequest
+		}
+	}
+
+	lists, err := loadLists(user)
+	if err != nil {
+		log.Printf("lists: failed to load lists of %s: %v", user, err)
+		data.ErrorMessage = "failed to load lists"
+	}
+	series := loadSeriesForUser(user)
+	data.Lists = lists
+	data.ListCounts = map[int]int{}
+	for _, l := range lists {
+		data.ListCounts[l.ID] = len(listSeries(l, series))
+	}
+	if listID != 0 {
+		i := findList(lists, listID)
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		current := lists[i]
+		data.CurrentList = &current
+		data.SeriesList = listSeries(current, series)
+		for _, s := range series {
+			if s.IMDBID != "" && !current.Contains(s.IMDBID) {
+				data.ListCandidates = append(data.ListCandidates, s)
+			}
+		}
+		sortSeries(data.ListCandidates, "title", "asc")
+	}
+	w.WriteHeader(status)
+	templates.ExecuteTemplate(w, "lists.html", data)
+}
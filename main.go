@@ -1,20 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
 	"log"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/jung-kurt/gofpdf"
@@ -23,32 +19,24 @@ import (
 // --- STRUKTUREN ---
 
 type Series struct {
-	ID              int    `json:"id"`
-	Title           string `json:"title"`
-	Year            string `json:"year"`
-	IMDBID          string `json:"imdb_id"`
-	EpisodesWatched int    `json:"episodes_watched"`
-	TotalEpisodes   int    `json:"total_episodes"`
-	Status          string `json:"status"`
-	Progress        int    `json:"progress"`
-	CoverURL        string `json:"cover_url"`
-}
-
-type OMDbResponse struct {
-	Title        string `json:"Title"`
-	Year         string `json:"Year"`
-	TotalSeasons string `json:"totalSeasons"`
-	IMDBID       string `json:"imdbID"`
-	Response     string `json:"Response"`
-	Error        string `json:"Error"`
-	Poster       string `json:"Poster"`
-}
-
-type SearchResult struct {
-	Search       []SearchItem `json:"Search"`
-	Response     string       `json:"Response"`
-	Error        string       `json:"Error"`
-	TotalResults string       `json:"totalResults"`
+	ID              int      `json:"id"`
+	Title           string   `json:"title"`
+	Year            string   `json:"year"`
+	IMDBID          string   `json:"imdb_id"`
+	EpisodesWatched int      `json:"episodes_watched"`
+	TotalEpisodes   int      `json:"total_episodes"`
+	Status          string   `json:"status"`
+	StatusManual    bool     `json:"status_manual,omitempty"` // Status wurde von Hand gesetzt
+	Progress        int      `json:"progress"`
+	CoverURL        string   `json:"cover_url"`
+	Rating          int      `json:"rating,omitempty"` // 1–10, 0 = nicht bewertet
+	Notes           string   `json:"notes,omitempty"`
+	Favorite        bool     `json:"favorite,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	Runtime         int      `json:"runtime,omitempty"` // übliche Episodenlänge in Minuten
+	Genres          []string `json:"genres,omitempty"`
+
+	Seasons []Season `json:"seasons,omitempty"`
 }
 
 type SearchItem struct {
@@ -64,23 +52,62 @@ type User struct {
 	Theme       string `json:"theme"` // z. B. "netflix", "apple", "android", "windows"
 	Lang        string `json:"lang"`
 	IsAdmin     bool   `json:"is_admin"`
+
+	// Höchstens eines der beiden ist gesetzt; ohne beide ist das Profil
+	// ohne Anmeldedaten nutzbar (z. B. für Kinder ohne eigenes Gerät).
+	PasswordHash string `json:"password_hash,omitempty"`
+	PINHash      string `json:"pin_hash,omitempty"`
+
+	APITokens []APIToken `json:"api_tokens,omitempty"`
+
+	// Hash des Tokens für den Kalender-Feed, leer wenn keiner eingerichtet ist.
+	CalendarTokenHash string `json:"calendar_token_hash,omitempty"`
 }
 
 type PageData struct {
 	SeriesList      []Series
+	Detail          *Series
 	SearchResults   []SearchItem
 	SearchQuery     string
 	ErrorMessage    string
 	SuccessMessage  string
 	APIAvailable    bool
+	APIHealth       HealthStatus
 	TotalSeries     int
 	TotalWatched    int
 	SortBy          string
 	Order           string
+	SortParam       string // ?sort= von /mylist, für die Filter-Links
+	Filter          SeriesFilter
+	ReturnPath      string // Rücksprung nach Formularen in den Karten
 	CurrentUser     string
 	CurrentUserName string
 	UserTheme       string // ← Wird für dynamisches Theme-Laden genutzt
 	IsAdmin         bool
+	Users           []UserEntry
+	Account         *UserEntry
+	Sessions        []SessionEntry
+	CSRFToken       string
+	APITokens       []APIToken
+	NewToken        string
+	CacheStats      *CacheStats
+	Backups         *BackupOverview
+	Trash           []TrashedSeries
+	Trashed         *TrashedSeries // gerade gelöscht, für „Rückgängig“
+	TrashDays       int
+	Upcoming        []CalendarEntry
+	RecentlyAired   []CalendarEntry
+	HasCalendarFeed bool
+	CalendarFeedURL string
+	HistoryDays     []HistoryDay
+	Tags            []string // alle vergebenen Tags für die Filterauswahl
+	Lists           []CustomList
+	ListCounts      map[int]int
+	CurrentList     *CustomList
+	ListCandidates  []Series
+	Stats           *Stats
+	Review          *YearReview
+	Import          *ImportWizard
 }
 
 // --- GLOBALE VARIABLEN ---
@@ -89,116 +116,63 @@ var (
 	apiKey = os.Getenv("OMDb_API_KEY")
 
 	templates *template.Template
-	mutex     sync.Mutex
-
-	users = map[string]User{
-		"user_a": {DisplayName: "Nutzer A", Theme: "netflix", Lang: "de", IsAdmin: true},
-		"user_b": {DisplayName: "Nutzer B", Theme: "netflix", Lang: "de", IsAdmin: false},
-		"user_c": {DisplayName: "Nutzer C", Theme: "netflix", Lang: "de", IsAdmin: false},
-		"user_d": {DisplayName: "Nutzer D", Theme: "netflix", Lang: "de", IsAdmin: false},
-	}
+	store     Store
 
 	httpClient = &http.Client{
 		Timeout: 15 * time.Second,
 	}
+
+	errSeriesExists   = errors.New("series already in your library")
+	errSeriesNotFound = errors.New("series not found")
 )
 
 // --- HILFSFUNKTIONEN ---
 
-func getDataFileForUser(username string) string {
-	return filepath.Join("data", username+".json")
-}
-
-func getUsersFile() string {
-	return filepath.Join("data", "users.json")
-}
-
-func loadUsers() {
-	file := getUsersFile()
-	if _, err := os.Stat(file); os.IsNotExist(err) {
-		saveUsers()
-		return
-	}
-	data, err := os.ReadFile(file)
-	if err != nil {
-		log.Printf("failed to load users.json: %v", err)
-		return
-	}
-	var loadedUsers map[string]User
-	if err := json.Unmarshal(data, &loadedUsers); err != nil {
-		log.Printf("failed to parse users.json: %v", err)
-		return
-	}
-	for k, v := range loadedUsers {
-		if _, exists := users[k]; exists {
-			users[k] = v
-		}
-	}
-}
-
-func saveUsers() {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	data, err := json.MarshalIndent(users, "", "  ")
-	if err != nil {
-		log.Printf("failed to marshal users: %v", err)
-		return
-	}
-	if err := os.MkdirAll("data", 0755); err != nil {
-		log.Printf("failed to create data dir: %v", err)
-		return
-	}
-	if err := os.WriteFile(getUsersFile(), data, 0644); err != nil {
-		log.Printf("failed to write users.json: %v", err)
-	}
-}
-
+// loadSeriesForUser liefert die Liste für die Anzeige. Fehler werden nur
+// protokolliert; Änderungen laufen über store.UpdateSeries und brechen bei
+// einer beschädigten Datei ab, statt sie zu überschreiben.
 func loadSeriesForUser(username string) []Series {
-	file := getDataFileForUser(username)
-	if _, err := os.Stat(file); os.IsNotExist(err) {
-		return []Series{}
-	}
-	data, err := os.ReadFile(file)
+	series, err := store.LoadSeries(username)
 	if err != nil {
-		log.Printf("failed to read %s: %v", file, err)
-		return []Series{}
-	}
-	var series []Series
-	if err := json.Unmarshal(data, &series); err != nil {
-		log.Printf("failed to unmarshal %s: %v", file, err)
+		log.Printf("failed to load series for %s: %v", username, err)
 		return []Series{}
 	}
 	return series
 }
 
-func saveSeriesForUser(username string, series []Series) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	data, err := json.MarshalIndent(series, "", "  ")
-	if err != nil {
-		log.Printf("failed to marshal series for %s: %v", username, err)
-		return
-	}
-	if err := os.MkdirAll("data", 0755); err != nil {
-		log.Printf("failed to create data dir: %v", err)
-		return
+func getCurrentUser(r *http.Request) (string, bool) {
+	_, s, ok := sessionFromRequest(r)
+	if !ok {
+		return "", false
 	}
-	if err := os.WriteFile(getDataFileForUser(username), data, 0644); err != nil {
-		log.Printf("failed to write %s: %v", getDataFileForUser(username), err)
+	if _, exists := getUser(s.Username); exists {
+		return s.Username, true
 	}
+	return "", false
 }
 
-func getCurrentUser(r *http.Request) (string, bool) {
-	cookie, err := r.Cookie("user")
-	if err != nil {
-		return "", false
+// themeForUser liefert das Theme des Nutzers oder "netflix" als Fallback.
+func themeForUser(user string) string {
+	u, _ := getUser(user)
+	if !isValidTheme(u.Theme) {
+		return "netflix"
 	}
-	if _, exists := users[cookie.Value]; exists {
-		return cookie.Value, true
+	return u.Theme
+}
+
+// newPageData füllt die Felder, die jede Seite für Kopfzeile und Theme braucht.
+func newPageData(r *http.Request, user string) PageData {
+	u, _ := getUser(user)
+	health := currentAPIHealth()
+	return PageData{
+		CurrentUser:     user,
+		CurrentUserName: u.DisplayName,
+		UserTheme:       themeForUser(user),
+		IsAdmin:         u.IsAdmin,
+		CSRFToken:       csrfToken(r),
+		APIAvailable:    health.Available,
+		APIHealth:       health,
 	}
-	return "", false
 }
 
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -218,20 +192,9 @@ func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
-		if !users[user].IsAdmin {
-			// Stelle sicher, dass Theme gültig ist
-			theme := users[user].Theme
-			validThemes := map[string]bool{"style": true, "netflix": true, "apple": true, "android": true, "windows": true}
-			if !validThemes[theme] {
-				theme = "netflix"
-			}
-			data := PageData{
-				ErrorMessage:    "Zugriff verweigert: Nur für Administratoren",
-				CurrentUser:     user,
-				CurrentUserName: users[user].DisplayName,
-				UserTheme:       theme,
-				IsAdmin:         false,
-			}
+		if u, _ := getUser(user); !u.IsAdmin {
+			data := newPageData(r, user)
+			data.ErrorMessage = "Zugriff verweigert: Nur für Administratoren"
 			w.WriteHeader(http.StatusForbidden)
 			templates.ExecuteTemplate(w, "index.html", data)
 			return
@@ -243,96 +206,45 @@ func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
 // --- HANDLER ---
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
+	data := PageData{
+		UserTheme: "netflix",
+		Users:     listUsers(),
+	}
 	if r.Method == "POST" {
 		user := r.FormValue("user")
-		valid := map[string]bool{
-			"user_a": true,
-			"user_b": true,
-			"user_c": true,
-			"user_d": true,
-		}
-		if !valid[user] {
+		u, exists := getUser(user)
+		if !exists {
 			http.Error(w, "invalid user", http.StatusBadRequest)
 			return
 		}
-		http.SetCookie(w, &http.Cookie{
-			Name:  "user",
-			Value: user,
-			Path:  "/",
-		})
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	// Für Login-Seite: Standard-Theme (z. B. netflix)
-	templates.ExecuteTemplate(w, "login.html", map[string]string{"UserTheme": "netflix"})
-}
-
-func adminHandler(w http.ResponseWriter, r *http.Request) {
-	user, _ := getCurrentUser(r)
-	if r.Method == "POST" {
-		// Namen aktualisieren
-		if name := r.FormValue("user_b_name"); name != "" {
-			u := users["user_b"]
-			u.DisplayName = name
-			users["user_b"] = u
-		}
-		if name := r.FormValue("user_c_name"); name != "" {
-			u := users["user_c"]
-			u.DisplayName = name
-			users["user_c"] = u
-		}
-		if name := r.FormValue("user_d_name"); name != "" {
-			u := users["user_d"]
-			u.DisplayName = name
-			users["user_d"] = u
-		}
-
-		// Themes aktualisieren
-		if theme := r.FormValue("user_b_theme"); theme != "" {
-			u := users["user_b"]
-			u.Theme = theme
-			users["user_b"] = u
-		}
-		if theme := r.FormValue("user_c_theme"); theme != "" {
-			u := users["user_c"]
-			u.Theme = theme
-			users["user_c"] = u
+		if wait := loginLocked(user, clientIP(r)); wait > 0 {
+			log.Printf("login: rejected attempt for %s from %s, locked for %s", user, clientIP(r), wait.Round(time.Second))
+			data.ErrorMessage = loginLockedMessage(wait)
+			setRetryAfter(w, wait)
+			w.WriteHeader(http.StatusTooManyRequests)
+			templates.ExecuteTemplate(w, "login.html", data)
+			return
 		}
-		if theme := r.FormValue("user_d_theme"); theme != "" {
-			u := users["user_d"]
-			u.Theme = theme
-			users["user_d"] = u
+		if !u.checkCredential(r.FormValue("password")) {
+			log.Printf("login: wrong credentials for %s from %s", user, clientIP(r))
+			recordLoginFailure(user, clientIP(r))
+			data.ErrorMessage = "Falsches Passwort oder falsche PIN"
+			w.WriteHeader(http.StatusUnauthorized)
+			templates.ExecuteTemplate(w, "login.html", data)
+			return
 		}
-
-		saveUsers()
-
-		// Nutzerdaten löschen
-		delUser := r.FormValue("delete_user")
-		if delUser != "" && delUser != "user_a" {
-			if _, exists := users[delUser]; exists {
-				os.Remove(getDataFileForUser(delUser))
-			}
+		resetLoginFailures(user)
+		if err := createSession(w, r, user); err != nil {
+			log.Printf("login: failed to create session for %s: %v", user, err)
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
+			return
 		}
-
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		log.Printf("login: %s from %s", user, clientIP(r))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-
-	// Theme für Admin-Seite
-	theme := users[user].Theme
-	validThemes := map[string]bool{"netflix": true, "apple": true, "android": true, "windows": true}
-	if !validThemes[theme] {
-		theme = "netflix"
-	}
-
-	data := PageData{
-		CurrentUser:     user,
-		CurrentUserName: users[user].DisplayName,
-		UserTheme:       theme,
-		IsAdmin:         true,
-		//Users:           User,
-	}
-	templates.ExecuteTemplate(w, "admin.html", data)
+	// Für Login-Seite: Standard-Theme (z. B. netflix)
+	templates.ExecuteTemplate(w, "login.html", data)
 }
 
 func indexHandler(w http.ResponseWriter, r *http.Request) {
@@ -342,26 +254,18 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Theme laden und validieren
-	theme := users[user].Theme
-	validThemes := map[string]bool{"netflix": true, "apple": true, "android": true, "windows": true}
-	if !validThemes[theme] {
-		theme = "netflix"
-	}
-
-	series := loadSeriesForUser(user)
+	series, loadErr := store.LoadSeries(user)
 	totalSeries, totalWatched := calculateStats(series)
-	apiAvailable := testAPIConnection()
 
-	data := PageData{
-		SeriesList:      series,
-		APIAvailable:    apiAvailable,
-		TotalSeries:     totalSeries,
-		TotalWatched:    totalWatched,
-		CurrentUser:     user,
-		CurrentUserName: users[user].DisplayName,
-		UserTheme:       theme,
-		IsAdmin:         users[user].IsAdmin,
+	data := newPageData(r, user)
+	data.SeriesList = series
+	data.TotalSeries = totalSeries
+	data.TotalWatched = totalWatched
+	data.ReturnPath = "/"
+	data.Trashed = trashFlash(r, user)
+	if loadErr != nil {
+		log.Printf("failed to load series for %s: %v", user, loadErr)
+		data.ErrorMessage = fmt.Sprintf("failed to load your list: %v", loadErr)
 	}
 	templates.ExecuteTemplate(w, "index.html", data)
 }
@@ -373,14 +277,7 @@ func myListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Theme laden und validieren
-	theme := users[user].Theme
-	validThemes := map[string]bool{"netflix": true, "apple": true, "android": true, "windows": true}
-	if !validThemes[theme] {
-		theme = "netflix"
-	}
-
-	series := loadSeriesForUser(user)
+	series, loadErr := store.LoadSeries(user)
 	sortParam := r.URL.Query().Get("sort")
 	var sortBy, order string
 	switch sortParam {
@@ -392,10 +289,33 @@ func myListHandler(w http.ResponseWriter, r *http.Request) {
 		sortBy, order = "progress", "asc"
 	case "progress_desc":
 		sortBy, order = "progress", "desc"
+	case "rating_asc":
+		sortBy, order = "rating", "asc"
+	case "rating_desc":
+		sortBy, order = "rating", "desc"
+	case "favorite":
+		sortBy, order = "favorite", "desc"
+	case "list":
+		sortBy, order = "list", "asc"
 	default:
 		sortBy, order = "title", "asc"
 	}
-	sortSeries(series, sortBy, order)
+	filter := parseSeriesFilter(r.URL.Query())
+	if err := filter.loadList(user); err != nil {
+		log.Printf("failed to load list %d for %s: %v", filter.ListID, user, err)
+		filter.ListID = 0
+	}
+	if sortParam == "" && filter.List() != nil {
+		// Eine eigene Liste erscheint zunächst in ihrer eigenen Reihenfolge.
+		sortBy, order = "list", "asc"
+	}
+	tags := collectTags(series)
+	series = filterSeries(series, filter)
+	if sortBy == "list" && filter.List() != nil {
+		sortByList(series, *filter.List())
+	} else {
+		sortSeries(series, sortBy, order)
+	}
 
 	totalSeries := len(series)
 	totalEpisodesWatched := 0
@@ -403,17 +323,25 @@ func myListHandler(w http.ResponseWriter, r *http.Request) {
 		totalEpisodesWatched += s.EpisodesWatched
 	}
 
-	data := PageData{
-		SeriesList:      series,
-		APIAvailable:    testAPIConnection(),
-		TotalSeries:     totalSeries,
-		TotalWatched:    totalEpisodesWatched,
-		SortBy:          sortBy,
-		Order:           order,
-		CurrentUser:     user,
-		CurrentUserName: users[user].DisplayName,
-		UserTheme:       theme,
-		IsAdmin:         users[user].IsAdmin,
+	data := newPageData(r, user)
+	data.SeriesList = series
+	data.TotalSeries = totalSeries
+	data.TotalWatched = totalEpisodesWatched
+	data.SortBy = sortBy
+	data.Order = order
+	data.SortParam = sortParam
+	data.Tags = tags
+	if lists, err := loadLists(user); err == nil {
+		data.Lists = lists
+	} else {
+		log.Printf("failed to load lists for %s: %v", user, err)
+	}
+	data.Filter = filter
+	data.ReturnPath = withTrashFlash(r.URL.RequestURI(), "")
+	data.Trashed = trashFlash(r, user)
+	if loadErr != nil {
+		log.Printf("failed to load series for %s: %v", user, loadErr)
+		data.ErrorMessage = fmt.Sprintf("failed to load your list: %v", loadErr)
 	}
 	templates.ExecuteTemplate(w, "mylist.html", data)
 }
@@ -427,17 +355,6 @@ func addHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-	theme := users[user].Theme
-	validThemes := map[string]bool{"netflix": true, "apple": true, "android": true, "windows": true}
-	if !validThemes[theme] {
-		theme = "netflix"
-	}
-	if theme == "" || !validThemes[theme] {
-		theme = "netflix"
-		// Optional: Speichere den Fallback-Wert dauerhaft
-		users[user].Theme = theme
-		saveUsers() // falls du Nutzerdaten persistierst
-	}
 	if r.Method != "POST" {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -449,87 +366,93 @@ func addHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	seriesData, err := fetchIMDBData(identifier)
+	seriesData, err := metadata.Lookup(identifier)
 	if err != nil {
 		seriesList := loadSeriesForUser(user)
 		totalSeries, totalWatched := calculateStats(seriesList)
-		data := PageData{
-			SeriesList:      seriesList,
-			ErrorMessage:    fmt.Sprintf("failed to add series: %v", err),
-			APIAvailable:    testAPIConnection(),
-			TotalSeries:     totalSeries,
-			TotalWatched:    totalWatched,
-			CurrentUser:     user,
-			CurrentUserName: users[user].DisplayName,
-			UserTheme:       theme,
-			IsAdmin:         users[user].IsAdmin,
-		}
+		data := newPageData(r, user)
+		data.SeriesList = seriesList
+		data.ErrorMessage = fmt.Sprintf("failed to add series: %v", err)
+		data.TotalSeries = totalSeries
+		data.TotalWatched = totalWatched
 		templates.ExecuteTemplate(w, "index.html", data)
 		return
 	}
 
-	totalEpisodes := 0
-	if seriesData.TotalSeasons != "" {
-		if seasons, err := strconv.Atoi(seriesData.TotalSeasons); err == nil {
-			totalEpisodes = seasons * 10
+	seasons := fetchInitialSeasons(seriesData)
+	_, err = insertSeries(user, seriesData, seasons)
+	if err != nil {
+		message := fmt.Sprintf("failed to add series: %v", err)
+		if err == errSeriesExists {
+			message = "series already in your library"
 		}
+		seriesList := loadSeriesForUser(user)
+		totalSeries, totalWatched := calculateStats(seriesList)
+		data := newPageData(r, user)
+		data.SeriesList = seriesList
+		data.ErrorMessage = message
+		data.TotalSeries = totalSeries
+		data.TotalWatched = totalWatched
+		templates.ExecuteTemplate(w, "index.html", data)
+		return
 	}
 
-	seriesDB := loadSeriesForUser(user)
-	for _, s := range seriesDB {
-		if s.IMDBID == seriesData.IMDBID {
-			seriesList := loadSeriesForUser(user)
-			totalSeries, totalWatched := calculateStats(seriesList)
-			data := PageData{
-				SeriesList:      seriesList,
-				ErrorMessage:    "series already in your library",
-				APIAvailable:    testAPIConnection(),
-				TotalSeries:     totalSeries,
-				TotalWatched:    totalWatched,
-				CurrentUser:     user,
-				CurrentUserName: users[user].DisplayName,
-				UserTheme:       theme,
-				IsAdmin:         users[user].IsAdmin,
-			}
-			templates.ExecuteTemplate(w, "index.html", data)
-			return
-		}
-	}
+	seriesList := loadSeriesForUser(user)
+	totalSeries, totalWatched := calculateStats(seriesList)
+	data := newPageData(r, user)
+	data.SeriesList = seriesList
+	data.SuccessMessage = fmt.Sprintf("✅ '%s' added successfully!", seriesData.Title)
+	data.TotalSeries = totalSeries
+	data.TotalWatched = totalWatched
+	templates.ExecuteTemplate(w, "index.html", data)
+}
 
-	nextID := 1
-	for _, s := range seriesDB {
-		if s.ID >= nextID {
-			nextID = s.ID + 1
-		}
+// fetchInitialSeasons lädt Staffeln und Episoden vor dem Speichern. Schlägt
+// das fehl, wird die Serie ohne Episoden angelegt und kann später über
+// "Aktualisieren" auf der Detailseite nachgeladen werden.
+func fetchInitialSeasons(seriesData *SeriesInfo) []Season {
+	seasons, err := metadata.Seasons(seriesData)
+	if err != nil {
+		log.Printf("failed to load seasons for %s: %v", seriesData.IMDBID, err)
+		return nil
 	}
+	return seasons
+}
 
-	newSeries := Series{
-		ID:            nextID,
-		Title:         seriesData.Title,
-		Year:          seriesData.Year,
-		IMDBID:        seriesData.IMDBID,
-		TotalEpisodes: totalEpisodes,
-		Status:        "Watching",
-		CoverURL:      seriesData.Poster,
-	}
+// insertSeries legt eine Serie mit der nächsten freien ID an.
+func insertSeries(user string, seriesData *SeriesInfo, seasons []Season) (Series, error) {
+	var added Series
+	err := store.UpdateSeries(user, func(seriesDB []Series) ([]Series, error) {
+		for _, s := range seriesDB {
+			if s.IMDBID == seriesData.IMDBID {
+				return nil, errSeriesExists
+			}
+		}
 
-	seriesDB = append(seriesDB, newSeries)
-	saveSeriesForUser(user, seriesDB)
+		nextID := 1
+		for _, s := range seriesDB {
+			if s.ID >= nextID {
+				nextID = s.ID + 1
+			}
+		}
 
-	seriesList := loadSeriesForUser(user)
-	totalSeries, totalWatched := calculateStats(seriesList)
-	data := PageData{
-		SeriesList:      seriesList,
-		SuccessMessage:  fmt.Sprintf("✅ '%s' added successfully!", seriesData.Title),
-		APIAvailable:    testAPIConnection(),
-		TotalSeries:     totalSeries,
-		TotalWatched:    totalWatched,
-		CurrentUser:     user,
-		CurrentUserName: users[user].DisplayName,
-		UserTheme:       theme,
-		IsAdmin:         users[user].IsAdmin,
+		added = Series{
+			ID:       nextID,
+			Title:    seriesData.Title,
+			Year:     seriesData.Year,
+			IMDBID:   seriesData.IMDBID,
+			CoverURL: seriesData.Poster,
+			Runtime:  seriesData.Runtime,
+			Genres:   seriesData.Genres,
+			Seasons:  seasons,
+		}
+		recountEpisodes(&added)
+		return append(seriesDB, added), nil
+	})
+	if err == nil {
+		prefetchCover(added)
 	}
-	templates.ExecuteTemplate(w, "index.html", data)
+	return added, err
 }
 
 func updateHandler(w http.ResponseWriter, r *http.Request) {
@@ -538,9 +461,6 @@ func updateHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-	seriesDB := loadSeriesForUser(user)
-	found := false
-
 	if r.Method != "POST" {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -556,20 +476,19 @@ func updateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	episodes, err := strconv.Atoi(episodesStr)
-	if err != nil {
+	if err != nil || episodes < 0 {
 		http.Error(w, "invalid episodes number", http.StatusBadRequest)
 		return
 	}
 
-	for i := range seriesDB {
-		if seriesDB[i].ID == id {
-			seriesDB[i].EpisodesWatched = episodes
-			found = true
-			break
-		}
-	}
-	if found {
-		saveSeriesForUser(user, seriesDB)
+	err = updateOneSeries(user, id, sourceWeb, func(s *Series) error {
+		setWatchedCount(s, episodes)
+		return nil
+	})
+	if err != nil && err != errSeriesNotFound {
+		log.Printf("failed to update series %d for %s: %v", id, user, err)
+		http.Error(w, "failed to save changes", http.StatusInternalServerError)
+		return
 	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -593,15 +512,19 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	seriesDB := loadSeriesForUser(user)
-	newSeries := []Series{}
-	for _, s := range seriesDB {
-		if s.ID != id {
-			newSeries = append(newSeries, s)
-		}
+	// Die Serie landet im Papierkorb, die Seite bietet danach „Rückgängig“ an.
+	target := safeReturnPath(r.FormValue("return"))
+	trashed, err := trashSeries(user, id)
+	if err == errSeriesNotFound {
+		http.Redirect(w, r, withTrashFlash(target, ""), http.StatusSeeOther)
+		return
 	}
-	saveSeriesForUser(user, newSeries)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	if err != nil {
+		log.Printf("failed to delete series %d for %s: %v", id, user, err)
+		http.Error(w, "failed to save changes", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, withTrashFlash(target, trashed.ID), http.StatusSeeOther)
 }
 
 func searchHandler(w http.ResponseWriter, r *http.Request) {
@@ -610,17 +533,6 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-	theme := users[user].Theme
-	validThemes := map[string]bool{"netflix": true, "apple": true, "android": true, "windows": true}
-	if !validThemes[theme] {
-		theme = "netflix"
-	}
-	if theme == "" || !validThemes[theme] {
-		theme = "netflix"
-		// Optional: Speichere den Fallback-Wert dauerhaft
-		users[user].Theme = theme
-		saveUsers() // falls du Nutzerdaten persistierst
-	}
 	if r.Method != "GET" {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -632,51 +544,30 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results, err := searchIMDBData(query)
+	seriesResults, err := metadata.Search(query)
 	if err != nil {
 		seriesList := loadSeriesForUser(user)
 		totalSeries, totalWatched := calculateStats(seriesList)
-		data := PageData{
-			SeriesList:      seriesList,
-			SearchQuery:     query,
-			ErrorMessage:    fmt.Sprintf("search failed: %v", err),
-			APIAvailable:    testAPIConnection(),
-			TotalSeries:     totalSeries,
-			TotalWatched:    totalWatched,
-			CurrentUser:     user,
-			CurrentUserName: users[user].DisplayName,
-			UserTheme:       theme,
-			IsAdmin:         users[user].IsAdmin,
-		}
+		data := newPageData(r, user)
+		data.SeriesList = seriesList
+		data.SearchQuery = query
+		data.ErrorMessage = fmt.Sprintf("search failed: %v", err)
+		data.TotalSeries = totalSeries
+		data.TotalWatched = totalWatched
 		templates.ExecuteTemplate(w, "index.html", data)
 		return
 	}
 
-	var seriesResults []SearchItem
-	for _, item := range results.Search {
-		if item.Type == "series" {
-			seriesResults = append(seriesResults, item)
-		}
-	}
-
 	seriesList := loadSeriesForUser(user)
 	totalSeries, totalWatched := calculateStats(seriesList)
-	data := PageData{
-		SeriesList:      seriesList,
-		SearchResults:   seriesResults,
-		SearchQuery:     query,
-		APIAvailable:    testAPIConnection(),
-		TotalSeries:     totalSeries,
-		TotalWatched:    totalWatched,
-		CurrentUser:     user,
-		CurrentUserName: users[user].DisplayName,
-		UserTheme:       theme,
-		IsAdmin:         users[user].IsAdmin,
-	}
-
-	if len(seriesResults) == 0 && len(results.Search) > 0 {
-		data.ErrorMessage = "no series found (only movies or other types)"
-	} else if len(seriesResults) == 0 {
+	data := newPageData(r, user)
+	data.SeriesList = seriesList
+	data.SearchResults = seriesResults
+	data.SearchQuery = query
+	data.TotalSeries = totalSeries
+	data.TotalWatched = totalWatched
+
+	if len(seriesResults) == 0 {
 		data.ErrorMessage = "no results found"
 	}
 
@@ -714,31 +605,14 @@ func pdfHandler(w http.ResponseWriter, r *http.Request) {
 		startY := pdf.GetY()
 		var imgHeight float64 = 20
 
-		if s.CoverURL != "" && s.CoverURL != "N/A" {
-			resp, err := httpClient.Get(s.CoverURL)
-			if err == nil {
-				func() {
-					defer resp.Body.Close()
-					data, err := io.ReadAll(resp.Body)
-					if err != nil {
-						return
-					}
-					imgName := fmt.Sprintf("cover_%d", s.ID)
-					info := pdf.RegisterImageOptionsReader(
-						imgName,
-						gofpdf.ImageOptions{ImageType: "JPG", ReadDpi: true},
-						bytes.NewReader(data),
-					)
-					if info != nil && info.Width() > 0 {
-						imgHeight = info.Height() * imgWidth / info.Width()
-						pdf.ImageOptions(
-							imgName, 10, startY, imgWidth, 0,
-							false,
-							gofpdf.ImageOptions{ImageType: "JPG", ReadDpi: true},
-							0, "",
-						)
-					}
-				}()
+		// Die Cover kommen aus data/covers/ und werden nur beim ersten
+		// Export einer Serie heruntergeladen.
+		if file, format, err := resizedCover(s, coverDefaultWidth); err == nil {
+			options := gofpdf.ImageOptions{ImageType: pdfImageType(format), ReadDpi: true}
+			info := pdf.RegisterImageOptions(file, options)
+			if info != nil && info.Width() > 0 {
+				imgHeight = info.Height() * imgWidth / info.Width()
+				pdf.ImageOptions(file, 10, startY, imgWidth, 0, false, options, 0, "")
 			}
 		}
 
@@ -754,6 +628,15 @@ func pdfHandler(w http.ResponseWriter, r *http.Request) {
 			utf8(fmt.Sprintf("Status: %s – %d/%d Episoden", s.Status, s.EpisodesWatched, s.TotalEpisodes)),
 			"", "L", false,
 		)
+		if line := ratingLine(s); line != "" {
+			pdf.SetX(textX)
+			pdf.MultiCell(0, 6, utf8(line), "", "L", false)
+		}
+		if s.Notes != "" {
+			pdf.SetX(textX)
+			pdf.SetFont("Helvetica", "I", 10)
+			pdf.MultiCell(0, 5, utf8(s.Notes), "", "L", false)
+		}
 
 		endY := pdf.GetY()
 		finalY := startY + imgHeight
@@ -773,12 +656,7 @@ func pdfHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func apiSeriesHandler(w http.ResponseWriter, r *http.Request) {
-	user, ok := getCurrentUser(r)
-	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
+func apiSeriesHandler(w http.ResponseWriter, r *http.Request, user string) {
 	w.Header().Set("Content-Type", "application/json")
 	series := loadSeriesForUser(user)
 	json.NewEncoder(w).Encode(series)
@@ -830,6 +708,35 @@ func sortSeries(series []Series, sortBy, order string) {
 				return series[i].Title < series[j].Title
 			})
 		}
+	case "rating":
+		// Nicht bewertete Serien stehen in beiden Richtungen am Ende.
+		if order == "desc" {
+			sort.Slice(series, func(i, j int) bool {
+				if series[i].Rating != series[j].Rating {
+					return series[i].Rating > series[j].Rating
+				}
+				return series[i].Title < series[j].Title
+			})
+		} else {
+			sort.Slice(series, func(i, j int) bool {
+				if (series[i].Rating == 0) != (series[j].Rating == 0) {
+					return series[j].Rating == 0
+				}
+				if series[i].Rating != series[j].Rating {
+					return series[i].Rating < series[j].Rating
+				}
+				return series[i].Title < series[j].Title
+			})
+		}
+	case "favorite":
+		// Favoriten zuerst ("desc") bzw. zuletzt ("asc"), sonst nach Titel.
+		first := order != "asc"
+		sort.Slice(series, func(i, j int) bool {
+			if series[i].Favorite != series[j].Favorite {
+				return series[i].Favorite == first
+			}
+			return series[i].Title < series[j].Title
+		})
 	default:
 		sort.Slice(series, func(i, j int) bool {
 			return series[i].Title < series[j].Title
@@ -848,128 +755,76 @@ func calculateStats(series []Series) (int, int) {
 	return totalSeries, totalCompleted
 }
 
-func testAPIConnection() bool {
-	if apiKey == "" {
-		return false
-	}
-	testURL := fmt.Sprintf("http://www.omdbapi.com/?apikey=%s&t=Game%%20of%%20Thrones&r=json", apiKey)
-	resp, err := httpClient.Get(testURL)
-	if err != nil {
-		return false
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return false
-	}
-	var result struct {
-		Response string `json:"Response"`
-		Error    string `json:"Error"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return false
-	}
-	return result.Response != "False"
-}
+// --- MAIN ---
 
-func fetchIMDBData(identifier string) (*OMDbResponse, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("omdb api key not set")
-	}
-	baseURL := "http://www.omdbapi.com/"
-	params := url.Values{}
-	params.Add("apikey", apiKey)
-	params.Add("r", "json")
-	if len(identifier) > 2 && identifier[:2] == "tt" {
-		params.Add("i", identifier)
-	} else {
-		params.Add("t", url.QueryEscape(identifier))
-		params.Add("type", "series")
-	}
-	urlStr := baseURL + "?" + params.Encode()
-	resp, err := httpClient.Get(urlStr)
-	if err != nil {
-		return nil, fmt.Errorf("network error: %v", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("invalid api key (status 401)")
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("api responded with status: %d", resp.StatusCode)
-	}
-	var result OMDbResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+func main() {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		log.Fatal("failed to create data directory:", err)
 	}
-	if result.Response == "False" {
-		if result.Error != "" {
-			return nil, fmt.Errorf("api error: %s", result.Error)
-		}
-		return nil, fmt.Errorf("series not found")
+	if err := runMigrations(dataDir); err != nil {
+		log.Fatal("failed to migrate data files:", err)
 	}
-	return &result, nil
-}
-
-func searchIMDBData(query string) (*SearchResult, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("omdb api key not set")
-	}
-	baseURL := "http://www.omdbapi.com/"
-	params := url.Values{}
-	params.Add("apikey", apiKey)
-	params.Add("s", url.QueryEscape(query))
-	params.Add("type", "series")
-	params.Add("r", "json")
-	params.Add("page", "1")
-	urlStr := baseURL + "?" + params.Encode()
-	resp, err := httpClient.Get(urlStr)
+	var err error
+	store, err = openStore()
 	if err != nil {
-		return nil, fmt.Errorf("network error: %v", err)
+		log.Fatal("failed to open storage:", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("invalid api key (status 401)")
+	defer store.Close()
+	if err := loadUsers(); err != nil {
+		log.Fatal("failed to load users:", err)
 	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("api responded with status: %d", resp.StatusCode)
+	if err := loadSessions(); err != nil {
+		log.Fatal("failed to load sessions:", err)
 	}
-	var result SearchResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
-	}
-	if result.Response == "False" {
-		if result.Error != "" {
-			return nil, fmt.Errorf("api error: %s", result.Error)
-		}
-		return nil, fmt.Errorf("no results found")
-	}
-	return &result, nil
-}
-
-// --- MAIN ---
-
-func main() {
-	if apiKey == "" {
-		log.Println("⚠️  warning: OMDb_API_KEY environment variable not set")
-	}
-
-	if err := os.MkdirAll("data", 0755); err != nil {
-		log.Fatal("failed to create data directory:", err)
+	go purgeExpiredSessions(time.Hour)
+	metadata = newMetadataChain()
+	go runHealthChecker()
+	go runEpisodeRefresher()
+	go runTrashPurger()
+	if backupInterval > 0 {
+		go runBackupScheduler()
 	}
-	loadUsers()
 
-	templates = template.Must(template.ParseGlob("templates/*.html"))
+	templates = template.Must(template.New("").Funcs(template.FuncMap{
+		"statusClass": statusClass,
+		"statuses":    func() []string { return validStatuses },
+		"ratings":     func() []int { return ratingOptions },
+	}).ParseGlob("templates/*.html"))
 
 	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/admin", requireAdmin(adminHandler))
-	http.HandleFunc("/", authMiddleware(indexHandler))
-	http.HandleFunc("/mylist", authMiddleware(myListHandler))
-	http.HandleFunc("/add", authMiddleware(addHandler))
-	http.HandleFunc("/update", authMiddleware(updateHandler))
-	http.HandleFunc("/delete", authMiddleware(deleteHandler))
-	http.HandleFunc("/search", authMiddleware(searchHandler))
-	http.HandleFunc("/api/series", authMiddleware(apiSeriesHandler))
-	http.HandleFunc("/pdf", authMiddleware(pdfHandler))
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/calendar.ics", calendarFeedHandler)
+	http.HandleFunc("/logout", csrfProtect(logoutHandler))
+	http.HandleFunc("/admin", csrfProtect(requireAdmin(adminHandler)))
+	http.HandleFunc("/admin/backup", csrfProtect(requireAdmin(backupDownloadHandler)))
+	http.HandleFunc("/password", csrfProtect(authMiddleware(passwordHandler)))
+	http.HandleFunc("/tokens", csrfProtect(authMiddleware(tokensHandler)))
+	http.HandleFunc("/", csrfProtect(authMiddleware(indexHandler)))
+	http.HandleFunc("/mylist", csrfProtect(authMiddleware(myListHandler)))
+	http.HandleFunc("/add", csrfProtect(authMiddleware(addHandler)))
+	http.HandleFunc("/update", csrfProtect(authMiddleware(updateHandler)))
+	http.HandleFunc("/delete", csrfProtect(authMiddleware(deleteHandler)))
+	http.HandleFunc("/trash", csrfProtect(authMiddleware(trashHandler)))
+	http.HandleFunc("/series", csrfProtect(authMiddleware(seriesDetailHandler)))
+	http.HandleFunc("/calendar", csrfProtect(authMiddleware(calendarHandler)))
+	http.HandleFunc("/history", csrfProtect(authMiddleware(historyHandler)))
+	http.HandleFunc("/stats", csrfProtect(authMiddleware(statsHandler)))
+	http.HandleFunc("/review", csrfProtect(authMiddleware(reviewHandler)))
+	http.HandleFunc("/review/pdf", csrfProtect(authMiddleware(reviewPDFHandler)))
+	http.HandleFunc("/episode", csrfProtect(authMiddleware(episodeHandler)))
+	http.HandleFunc("/season", csrfProtect(authMiddleware(seasonHandler)))
+	http.HandleFunc("/refresh", csrfProtect(authMiddleware(refreshHandler)))
+	http.HandleFunc("/status", csrfProtect(authMiddleware(statusHandler)))
+	http.HandleFunc("/rate", csrfProtect(authMiddleware(ratingHandler)))
+	http.HandleFunc("/tags", csrfProtect(authMiddleware(tagsHandler)))
+	http.HandleFunc("/lists", csrfProtect(authMiddleware(listsHandler)))
+	http.HandleFunc("/search", csrfProtect(authMiddleware(searchHandler)))
+	http.HandleFunc("/api/series", csrfProtect(apiAuth(apiSeriesHandler)))
+	http.HandleFunc("/api/v1/", csrfProtect(apiAuth(apiV1Handler)))
+	http.HandleFunc("/pdf", csrfProtect(authMiddleware(pdfHandler)))
+	http.HandleFunc("/export/csv", csrfProtect(authMiddleware(exportCSVHandler)))
+	http.HandleFunc("/import", csrfProtect(authMiddleware(importHandler)))
+	http.HandleFunc("/covers/", authMiddleware(coversHandler))
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 
 	port := findAvailablePort()
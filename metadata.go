@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// --- METADATEN-ANBIETER ---
+
+// Serieninformationen kommen von einem oder mehreren Anbietern. Welche in
+// welcher Reihenfolge gefragt werden, legt METADATA_PROVIDERS fest (z. B.
+// "omdb,tvmaze,tmdb"); liefert der erste nichts, wird der nächste versucht.
+// Serien werden weiterhin über ihre IMDb-ID identifiziert, daher liefern
+// alle Anbieter nur Treffer mit IMDb-ID.
+
+// MetadataProvider ist ein einzelner Anbieter wie OMDb oder TVmaze.
+type MetadataProvider interface {
+	Name() string
+	// Search liefert Serien zu einem Suchbegriff.
+	Search(query string) ([]SearchItem, error)
+	// Lookup sucht eine Serie über ihre IMDb-ID oder ihren Titel.
+	Lookup(identifier string) (*SeriesInfo, error)
+	// Seasons lädt alle Staffeln samt Episodenliste.
+	Seasons(info *SeriesInfo) ([]Season, error)
+	// Artwork liefert die URL eines Posters, falls vorhanden.
+	Artwork(info *SeriesInfo) (string, error)
+	// Check prüft ohne Cache, ob der Anbieter erreichbar ist.
+	Check() error
+}
+
+// SeriesInfo sind die von allen Anbietern gleich gelieferten Angaben.
+type SeriesInfo struct {
+	Title        string
+	Year         string
+	IMDBID       string
+	Poster       string
+	TotalSeasons int // 0, wenn der Anbieter die Zahl erst mit den Staffeln kennt
+	Runtime      int // übliche Episodenlänge in Minuten, 0 wenn unbekannt
+	Genres       []string
+
+	Provider   string
+	ProviderID string
+}
+
+const (
+	defaultMetadataProviders = "omdb,tvmaze,tmdb"
+	metadataMaxBodySize      = 2 << 20
+	// Game of Thrones, wie schon beim früheren Test vor jedem Seitenaufruf.
+	healthCheckIMDBID = "tt0944947"
+)
+
+var (
+	errNoMetadataProvider = errors.New("no metadata provider configured")
+	errMetadataNotFound   = errors.New("series not found")
+	errNoIMDBID           = errors.New("series has no imdb id")
+
+	// metadata wird in main aus METADATA_PROVIDERS aufgebaut.
+	metadata providerChain
+)
+
+func isIMDBID(identifier string) bool {
+	return len(identifier) > 2 && identifier[:2] == "tt"
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// newMetadataChain baut die Anbieter in der konfigurierten Reihenfolge auf.
+// Anbieter ohne API-Key werden übersprungen.
+func newMetadataChain() providerChain {
+	var chain providerChain
+	for _, name := range strings.Split(envOr("METADATA_PROVIDERS", defaultMetadataProviders), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		var p MetadataProvider
+		switch name {
+		case "":
+			continue
+		case "omdb":
+			if apiKey == "" {
+				log.Println("⚠️  warning: OMDb_API_KEY environment variable not set, skipping omdb")
+				continue
+			}
+			p = newOMDbProvider()
+		case "tvmaze":
+			p = newTVmazeProvider()
+		case "tmdb":
+			if os.Getenv("TMDB_API_KEY") == "" {
+				continue
+			}
+			p = newTMDBProvider()
+		default:
+			log.Printf("metadata: ignoring unknown provider %q", name)
+			continue
+		}
+		chain = append(chain, p)
+	}
+	if len(chain) == 0 {
+		log.Println("⚠️  warning: no metadata provider available, search and adding series are disabled")
+	} else {
+		log.Printf("metadata: using providers %s", strings.Join(chain.names(), ", "))
+	}
+	return chain
+}
+
+// --- REIHENFOLGE ---
+
+// providerChain fragt die Anbieter der Reihe nach. Fehler werden gesammelt
+// und nur gemeldet, wenn keiner eine Antwort hatte.
+type providerChain []MetadataProvider
+
+func (c providerChain) names() []string {
+	names := make([]string, len(c))
+	for i, p := range c {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+func (c providerChain) Name() string {
+	return strings.Join(c.names(), ",")
+}
+
+// providerErrors sind die gesammelten Fehler aller Anbieter. errors.Is
+// prüft nur die echten Fehler, damit ein Ausfall nicht als "nicht
+// gefunden" gilt, nur weil ein anderer Anbieter die Serie nicht kennt.
+type providerErrors struct {
+	all      []error
+	failures []error
+}
+
+func (e *providerErrors) Error() string {
+	messages := make([]string, len(e.all))
+	for i, err := range e.all {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *providerErrors) Unwrap() []error {
+	return e.failures
+}
+
+func providerError(p MetadataProvider, err error) error {
+	return fmt.Errorf("%s: %w", p.Name(), err)
+}
+
+// chainError liefert errMetadataNotFound, wenn alle Anbieter die Serie
+// nicht kennen, und sonst alle Fehler zusammen.
+func chainError(errs []error) error {
+	if len(errs) == 0 {
+		return errNoMetadataProvider
+	}
+	var failures []error
+	for _, err := range errs {
+		if !errors.Is(err, errMetadataNotFound) {
+			failures = append(failures, err)
+		}
+	}
+	if len(failures) == 0 {
+		return errMetadataNotFound
+	}
+	return &providerErrors{all: errs, failures: failures}
+}
+
+// Search fragt die Anbieter der Reihe nach, bis einer Treffer liefert.
+// Finden alle Anbieter nichts, ist das Ergebnis leer und kein Fehler; nur
+// echte Fehler werden zu einem Ketten-Fehler.
+func (c providerChain) Search(query string) ([]SearchItem, error) {
+	if len(c) == 0 {
+		return nil, errNoMetadataProvider
+	}
+	var errs []error
+	for _, p := range c {
+		items, err := p.Search(query)
+		if err != nil {
+			errs = append(errs, providerError(p, err))
+			continue
+		}
+		if len(items) > 0 {
+			return items, nil
+		}
+	}
+	if err := chainError(errs); len(errs) > 0 && err != errMetadataNotFound {
+		return nil, err
+	}
+	return []SearchItem{}, nil
+}
+
+// Lookup nimmt den ersten Treffer. Fehlt dort ein Poster, wird es bei den
+// übrigen Anbietern gesucht. Kennt kein Anbieter die Serie, ist der Fehler
+// errMetadataNotFound; ein Treffer ohne IMDb-ID zählt dabei wie keiner.
+func (c providerChain) Lookup(identifier string) (*SeriesInfo, error) {
+	var errs []error
+	for _, p := range c {
+		info, err := p.Lookup(identifier)
+		if err == errNoIMDBID {
+			err = errMetadataNotFound
+		}
+		if err != nil {
+			errs = append(errs, providerError(p, err))
+			continue
+		}
+		if info.Poster == "" && info.IMDBID != "" {
+			if poster, err := c.Artwork(info); err == nil {
+				info.Poster = poster
+			}
+		}
+		return info, nil
+	}
+	return nil, chainError(errs)
+}
+
+// Seasons fragt zuerst den Anbieter, von dem info stammt, da dessen IDs
+// schon bekannt sind. Die übrigen Anbieter suchen über die IMDb-ID.
+func (c providerChain) Seasons(info *SeriesInfo) ([]Season, error) {
+	ordered := make(providerChain, 0, len(c))
+	for _, p := range c {
+		if p.Name() == info.Provider {
+			ordered = append(ordered, p)
+		}
+	}
+	for _, p := range c {
+		if p.Name() != info.Provider {
+			ordered = append(ordered, p)
+		}
+	}
+
+	var errs []error
+	for _, p := range ordered {
+		seasons, err := p.Seasons(info)
+		if err == nil && len(seasons) > 0 {
+			return seasons, nil
+		}
+		if err == nil {
+			err = errors.New("no seasons found")
+		}
+		errs = append(errs, providerError(p, err))
+	}
+	return nil, chainError(errs)
+}
+
+func (c providerChain) Artwork(info *SeriesInfo) (string, error) {
+	var errs []error
+	for _, p := range c {
+		if p.Name() == info.Provider {
+			// Hat schon beim Lookup kein Poster geliefert.
+			continue
+		}
+		poster, err := p.Artwork(info)
+		if err == nil && poster != "" {
+			return poster, nil
+		}
+		if err == nil {
+			err = errors.New("no artwork found")
+		}
+		errs = append(errs, providerError(p, err))
+	}
+	return "", chainError(errs)
+}
+
+// Check gilt als erfolgreich, sobald ein Anbieter erreichbar ist.
+func (c providerChain) Check() error {
+	var errs []error
+	for _, p := range c {
+		err := p.Check()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, providerError(p, err))
+	}
+	return chainError(errs)
+}
+
+// --- HTTP ---
+
+// metadataFetch ruft rawURL ohne Cache ab und liefert den Rohinhalt. Da
+// manche Anbieter den Key in der URL erwarten, werden secrets aus
+// Fehlermeldungen entfernt.
+func metadataFetch(rawURL string, header http.Header, secrets ...string) ([]byte, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		message := err.Error()
+		for _, secret := range secrets {
+			if secret != "" {
+				message = strings.ReplaceAll(message, secret, "***")
+			}
+		}
+		return nil, fmt.Errorf("network error: %s", message)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == 401:
+		return nil, fmt.Errorf("invalid api key (status 401)")
+	case resp.StatusCode == 404:
+		return nil, errMetadataNotFound
+	case resp.StatusCode != 200:
+		return nil, fmt.Errorf("api responded with status: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, metadataMaxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	return body, nil
+}
+
+// splitGenres zerlegt Angaben wie "Drama, Crime" und lässt "N/A" weg.
+func splitGenres(genres string) []string {
+	var result []string
+	for _, g := range strings.Split(genres, ",") {
+		g = strings.TrimSpace(g)
+		if g != "" && g != "N/A" {
+			result = append(result, g)
+		}
+	}
+	return result
+}
+
+// yearRange formatiert Laufzeiten wie OMDb: "2008–2013", "2019–" oder
+// "2020" für eine abgeschlossene Serie innerhalb eines Jahres.
+func yearRange(start, end string, ended bool) string {
+	if len(start) < 4 {
+		return ""
+	}
+	from := start[:4]
+	if !ended {
+		return from + "–"
+	}
+	if len(end) < 4 || end[:4] == from {
+		return from
+	}
+	return from + "–" + end[:4]
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// --- OMDB ---
+
+// OMDb braucht einen API-Key (OMDb_API_KEY) und meldet Fehler mit Status
+// 200 und "Response": "False".
+
+type OMDbResponse struct {
+	Title        string `json:"Title"`
+	Year         string `json:"Year"`
+	TotalSeasons string `json:"totalSeasons"`
+	IMDBID       string `json:"imdbID"`
+	Response     string `json:"Response"`
+	Error        string `json:"Error"`
+	Poster       string `json:"Poster"`
+	Runtime      string `json:"Runtime"` // z. B. "45 min"
+	Genre        string `json:"Genre"`   // z. B. "Drama, Crime"
+}
+
+type SearchResult struct {
+	Search       []SearchItem `json:"Search"`
+	Response     string       `json:"Response"`
+	Error        string       `json:"Error"`
+	TotalResults string       `json:"totalResults"`
+}
+
+type OMDbSeasonResponse struct {
+	Title        string `json:"Title"`
+	Season       string `json:"Season"`
+	TotalSeasons string `json:"totalSeasons"`
+	Episodes     []struct {
+		Title    string `json:"Title"`
+		Released string `json:"Released"`
+		Episode  string `json:"Episode"`
+		IMDBID   string `json:"imdbID"`
+	} `json:"Episodes"`
+	Response string `json:"Response"`
+	Error    string `json:"Error"`
+}
+
+type omdbProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+func newOMDbProvider() *omdbProvider {
+	return &omdbProvider{
+		baseURL: envOr("OMDB_BASE_URL", "http://www.omdbapi.com/"),
+		apiKey:  apiKey,
+	}
+}
+
+func (p *omdbProvider) Name() string { return "omdb" }
+
+// fetch fragt OMDb ohne Cache ab und liefert den Rohinhalt der Antwort.
+func (p *omdbProvider) fetch(params url.Values) ([]byte, error) {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("apikey", p.apiKey)
+	query.Set("r", "json")
+	return metadataFetch(p.baseURL+"?"+query.Encode(), nil, p.apiKey)
+}
+
+// get liest eine Antwort über den Cache nach v und wertet "Response":
+// "False" als Fehler. OMDb meldet fehlende Treffer als "… not found!", das
+// wird zu errMetadataNotFound.
+func (p *omdbProvider) get(kind, name string, params url.Values, v interface{}) error {
+	body, err := metadataCache.get(kind, name, func() ([]byte, error) { return p.fetch(params) })
+	if err != nil {
+		return err
+	}
+	var status struct {
+		Response string `json:"Response"`
+		Error    string `json:"Error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if status.Response == "False" {
+		if strings.HasSuffix(status.Error, "not found!") {
+			return errMetadataNotFound
+		}
+		if status.Error != "" {
+			return fmt.Errorf("api error: %s", status.Error)
+		}
+		return errMetadataNotFound
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	return nil
+}
+
+func omdbPoster(poster string) string {
+	if poster == "N/A" {
+		return ""
+	}
+	return poster
+}
+
+func (p *omdbProvider) Search(query string) ([]SearchItem, error) {
+	params := url.Values{}
+	params.Add("s", query)
+	params.Add("type", "series")
+	params.Add("page", "1")
+	var result SearchResult
+	err := p.get(cacheKindSearch, cacheName(cacheKindSearch, hashedCacheKey(query)), params, &result)
+	if err == errMetadataNotFound {
+		return []SearchItem{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	items := []SearchItem{}
+	for _, item := range result.Search {
+		if item.Type == "series" {
+			item.Poster = omdbPoster(item.Poster)
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (p *omdbProvider) Lookup(identifier string) (*SeriesInfo, error) {
+	params := url.Values{}
+	var name string
+	if isIMDBID(identifier) {
+		params.Add("i", identifier)
+		name = cacheName(cacheKindTitle, safeCacheKey(identifier))
+	} else {
+		params.Add("t", identifier)
+		params.Add("type", "series")
+		name = cacheName(cacheKindTitle, "q", hashedCacheKey(identifier))
+	}
+	var result OMDbResponse
+	if err := p.get(cacheKindTitle, name, params, &result); err != nil {
+		return nil, err
+	}
+	total, _ := strconv.Atoi(result.TotalSeasons)
+	return &SeriesInfo{
+		Title:        result.Title,
+		Year:         result.Year,
+		IMDBID:       result.IMDBID,
+		Poster:       omdbPoster(result.Poster),
+		TotalSeasons: total,
+		Runtime:      omdbRuntime(result.Runtime),
+		Genres:       splitGenres(result.Genre),
+		Provider:     p.Name(),
+		ProviderID:   result.IMDBID,
+	}, nil
+}
+
+// omdbRuntime liest "45 min"; "N/A" und Unbekanntes ergeben 0.
+func omdbRuntime(runtime string) int {
+	minutes, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(runtime), " min"))
+	if err != nil || minutes < 0 {
+		return 0
+	}
+	return minutes
+}
+
+func (p *omdbProvider) fetchSeason(imdbID string, season int) (*OMDbSeasonResponse, error) {
+	params := url.Values{}
+	params.Add("i", imdbID)
+	params.Add("Season", strconv.Itoa(season))
+	name := cacheName(cacheKindSeason, safeCacheKey(imdbID), strconv.Itoa(season))
+	var result OMDbSeasonResponse
+	if err := p.get(cacheKindSeason, name, params, &result); err != nil {
+		if err == errMetadataNotFound {
+			return nil, errSeasonNotFound
+		}
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Seasons fragt jede Staffel einzeln ab; die Anzahl kommt aus dem Lookup.
+func (p *omdbProvider) Seasons(info *SeriesInfo) ([]Season, error) {
+	if info.IMDBID == "" {
+		return nil, errNoIMDBID
+	}
+	total := info.TotalSeasons
+	if info.Provider != p.Name() || total == 0 {
+		own, err := p.Lookup(info.IMDBID)
+		if err != nil {
+			return nil, err
+		}
+		total = own.TotalSeasons
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("unknown number of seasons")
+	}
+
+	seasons := []Season{}
+	for n := 1; n <= total; n++ {
+		data, err := p.fetchSeason(info.IMDBID, n)
+		if err != nil {
+			return nil, fmt.Errorf("season %d: %v", n, err)
+		}
+		season := Season{Number: n}
+		for _, e := range data.Episodes {
+			number, err := strconv.Atoi(e.Episode)
+			if err != nil {
+				continue
+			}
+			released := e.Released
+			if released == "N/A" {
+				released = ""
+			}
+			season.Episodes = append(season.Episodes, Episode{
+				Number:   number,
+				Title:    e.Title,
+				IMDBID:   e.IMDBID,
+				Released: released,
+			})
+		}
+		seasons = append(seasons, season)
+	}
+	return seasons, nil
+}
+
+func (p *omdbProvider) Artwork(info *SeriesInfo) (string, error) {
+	if info.IMDBID == "" {
+		return "", errNoIMDBID
+	}
+	own, err := p.Lookup(info.IMDBID)
+	if err != nil {
+		return "", err
+	}
+	return own.Poster, nil
+}
+
+func (p *omdbProvider) Check() error {
+	body, err := p.fetch(url.Values{"i": {healthCheckIMDBID}})
+	if err != nil {
+		return err
+	}
+	var result OMDbResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if result.Response == "False" {
+		return fmt.Errorf("api error: %s", result.Error)
+	}
+	return nil
+}
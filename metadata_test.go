@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// fakeProvider antwortet mit festen Ergebnissen.
+type fakeProvider struct {
+	name  string
+	info  *SeriesInfo
+	items []SearchItem
+	err   error
+}
+
+func (p fakeProvider) Name() string { return p.name }
+
+func (p fakeProvider) Search(query string) ([]SearchItem, error) { return p.items, p.err }
+
+func (p fakeProvider) Lookup(identifier string) (*SeriesInfo, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.info, nil
+}
+
+func (p fakeProvider) Seasons(info *SeriesInfo) ([]Season, error) { return nil, p.err }
+func (p fakeProvider) Artwork(info *SeriesInfo) (string, error)   { return "", p.err }
+func (p fakeProvider) Check() error                               { return p.err }
+
+func TestProviderChainLookupErrors(t *testing.T) {
+	down := errors.New("network error: timeout")
+	notFound := fakeProvider{name: "omdb", err: errMetadataNotFound}
+	noIMDb := fakeProvider{name: "tvmaze", err: errNoIMDBID}
+	failing := fakeProvider{name: "tmdb", err: down}
+
+	if _, err := (providerChain{notFound, noIMDb}).Lookup("Dark"); err != errMetadataNotFound {
+		t.Errorf("all not found: err = %v, want %v", err, errMetadataNotFound)
+	}
+
+	_, err := providerChain{notFound, failing}.Lookup("Dark")
+	if errors.Is(err, errMetadataNotFound) {
+		t.Errorf("err = %v, a provider failure must not count as not found", err)
+	}
+	if !errors.Is(err, down) {
+		t.Errorf("err = %v, want it to wrap the provider failure", err)
+	}
+	if want := "omdb: series not found; tmdb: network error: timeout"; err.Error() != want {
+		t.Errorf("message = %q, want %q", err.Error(), want)
+	}
+
+	found := fakeProvider{name: "tvmaze", info: &SeriesInfo{Title: "Dark", IMDBID: "tt5753856", Poster: "x"}}
+	if info, err := (providerChain{failing, found}).Lookup("Dark"); err != nil || info.Title != "Dark" {
+		t.Errorf("fallback = %+v (%v), want Dark", info, err)
+	}
+	if _, err := (providerChain{}).Lookup("Dark"); err != errNoMetadataProvider {
+		t.Errorf("no providers: err = %v, want %v", err, errNoMetadataProvider)
+	}
+}
+
+func TestProviderChainSearch(t *testing.T) {
+	down := errors.New("api responded with status: 500")
+	empty := fakeProvider{name: "omdb", items: []SearchItem{}}
+	notFound := fakeProvider{name: "tvmaze", err: errMetadataNotFound}
+	failing := fakeProvider{name: "tmdb", err: down}
+
+	if items, err := (providerChain{empty, notFound}).Search("xyz"); err != nil || items == nil || len(items) != 0 {
+		t.Errorf("no hits = %v (%v), want an empty result", items, err)
+	}
+	if _, err := (providerChain{empty, failing}).Search("xyz"); !errors.Is(err, down) {
+		t.Errorf("failure: err = %v, want the provider error", err)
+	}
+	hit := fakeProvider{name: "tvmaze", items: []SearchItem{{Title: "Dark"}}}
+	if items, err := (providerChain{failing, hit}).Search("Dark"); err != nil || len(items) != 1 {
+		t.Errorf("fallback = %v (%v), want one hit", items, err)
+	}
+	if _, err := (providerChain{}).Search("Dark"); err != errNoMetadataProvider {
+		t.Errorf("no providers: err = %v, want %v", err, errNoMetadataProvider)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- TMDB ---
+
+// TMDB braucht TMDB_API_KEY. Akzeptiert wird sowohl der kurze v3-Key als
+// auch das lange Lese-Token (v4), das als Bearer-Header gesendet wird.
+
+const tmdbSearchDetails = 8 // so viele Suchtreffer werden um die IMDb-ID ergänzt
+
+type tmdbShow struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	Status          string `json:"status"`
+	FirstAirDate    string `json:"first_air_date"`
+	LastAirDate     string `json:"last_air_date"`
+	NumberOfSeasons int    `json:"number_of_seasons"`
+	PosterPath      string `json:"poster_path"`
+	EpisodeRunTime  []int  `json:"episode_run_time"`
+	Genres          []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	ExternalIDs struct {
+		IMDBID string `json:"imdb_id"`
+	} `json:"external_ids"`
+}
+
+type tmdbSeason struct {
+	Episodes []struct {
+		EpisodeNumber int    `json:"episode_number"`
+		Name          string `json:"name"`
+		AirDate       string `json:"air_date"`
+		Runtime       *int   `json:"runtime"`
+	} `json:"episodes"`
+}
+
+type tmdbProvider struct {
+	baseURL   string
+	imageBase string
+	apiKey    string
+}
+
+func newTMDBProvider() *tmdbProvider {
+	return &tmdbProvider{
+		baseURL:   strings.TrimRight(envOr("TMDB_BASE_URL", "https://api.themoviedb.org/3"), "/"),
+		imageBase: strings.TrimRight(envOr("TMDB_IMAGE_BASE_URL", "https://image.tmdb.org/t/p/w500"), "/"),
+		apiKey:    os.Getenv("TMDB_API_KEY"),
+	}
+}
+
+func (p *tmdbProvider) Name() string { return "tmdb" }
+
+// fetch fragt TMDB ohne Cache ab.
+func (p *tmdbProvider) fetch(path string, params url.Values) ([]byte, error) {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	header := http.Header{}
+	if strings.HasPrefix(p.apiKey, "eyJ") {
+		header.Set("Authorization", "Bearer "+p.apiKey)
+	} else {
+		query.Set("api_key", p.apiKey)
+	}
+	return metadataFetch(p.baseURL+path+"?"+query.Encode(), header, p.apiKey)
+}
+
+func (p *tmdbProvider) get(kind, name, path string, params url.Values, v interface{}) error {
+	body, err := metadataCache.get(kind, name, func() ([]byte, error) { return p.fetch(path, params) })
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	return nil
+}
+
+// details lädt eine Serie samt IMDb-ID. key ist die IMDb-ID, sofern schon
+// bekannt, damit invalidateIMDB auch diesen Eintrag findet.
+func (p *tmdbProvider) details(id int, key string) (*tmdbShow, error) {
+	if key == "" {
+		key = strconv.Itoa(id)
+	}
+	var show tmdbShow
+	name := cacheName(cacheKindTitle, p.Name(), safeCacheKey(key), "details")
+	err := p.get(cacheKindTitle, name, "/tv/"+strconv.Itoa(id), url.Values{"append_to_response": {"external_ids"}}, &show)
+	if err != nil {
+		return nil, err
+	}
+	return &show, nil
+}
+
+func (p *tmdbProvider) poster(path string) string {
+	if path == "" {
+		return ""
+	}
+	return p.imageBase + path
+}
+
+func (p *tmdbProvider) info(show *tmdbShow) *SeriesInfo {
+	info := &SeriesInfo{
+		Title:        show.Name,
+		Year:         yearRange(show.FirstAirDate, show.LastAirDate, show.Status == "Ended" || show.Status == "Canceled"),
+		IMDBID:       show.ExternalIDs.IMDBID,
+		Poster:       p.poster(show.PosterPath),
+		TotalSeasons: show.NumberOfSeasons,
+		Provider:     p.Name(),
+		ProviderID:   strconv.Itoa(show.ID),
+	}
+	if len(show.EpisodeRunTime) > 0 {
+		info.Runtime = show.EpisodeRunTime[0]
+	}
+	for _, g := range show.Genres {
+		info.Genres = append(info.Genres, g.Name)
+	}
+	return info
+}
+
+func (p *tmdbProvider) search(query string) ([]tmdbShow, error) {
+	var result struct {
+		Results []tmdbShow `json:"results"`
+	}
+	name := cacheName(cacheKindSearch, p.Name(), hashedCacheKey(query))
+	if err := p.get(cacheKindSearch, name, "/search/tv", url.Values{"query": {query}}, &result); err != nil {
+		return nil, err
+	}
+	return result.Results, nil
+}
+
+// Search ergänzt die ersten Treffer um ihre IMDb-ID, da die Suche von TMDB
+// sie nicht mitliefert. Treffer ohne IMDb-ID werden ausgelassen.
+func (p *tmdbProvider) Search(query string) ([]SearchItem, error) {
+	results, err := p.search(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > tmdbSearchDetails {
+		results = results[:tmdbSearchDetails]
+	}
+	items := []SearchItem{}
+	for _, r := range results {
+		show, err := p.details(r.ID, "")
+		if err != nil || show.ExternalIDs.IMDBID == "" {
+			continue
+		}
+		items = append(items, SearchItem{
+			Title:  show.Name,
+			Year:   p.info(show).Year,
+			IMDBID: show.ExternalIDs.IMDBID,
+			Type:   "series",
+			Poster: p.poster(show.PosterPath),
+		})
+	}
+	return items, nil
+}
+
+// findID sucht die TMDB-ID zu einer IMDb-ID.
+func (p *tmdbProvider) findID(imdbID string) (int, error) {
+	var result struct {
+		TVResults []tmdbShow `json:"tv_results"`
+	}
+	name := cacheName(cacheKindTitle, p.Name(), safeCacheKey(imdbID))
+	err := p.get(cacheKindTitle, name, "/find/"+url.PathEscape(imdbID), url.Values{"external_source": {"imdb_id"}}, &result)
+	if err != nil {
+		return 0, err
+	}
+	if len(result.TVResults) == 0 {
+		return 0, errMetadataNotFound
+	}
+	return result.TVResults[0].ID, nil
+}
+
+func (p *tmdbProvider) Lookup(identifier string) (*SeriesInfo, error) {
+	var show *tmdbShow
+	if isIMDBID(identifier) {
+		id, err := p.findID(identifier)
+		if err != nil {
+			return nil, err
+		}
+		if show, err = p.details(id, identifier); err != nil {
+			return nil, err
+		}
+	} else {
+		results, err := p.search(identifier)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			return nil, errMetadataNotFound
+		}
+		if show, err = p.details(results[0].ID, ""); err != nil {
+			return nil, err
+		}
+	}
+	if show.ExternalIDs.IMDBID == "" {
+		return nil, errNoIMDBID
+	}
+	return p.info(show), nil
+}
+
+func (p *tmdbProvider) Seasons(info *SeriesInfo) ([]Season, error) {
+	if info.IMDBID == "" {
+		return nil, errNoIMDBID
+	}
+	own := info
+	if info.Provider != p.Name() || info.TotalSeasons == 0 {
+		var err error
+		if own, err = p.Lookup(info.IMDBID); err != nil {
+			return nil, err
+		}
+	}
+
+	seasons := []Season{}
+	for n := 1; n <= own.TotalSeasons; n++ {
+		var data tmdbSeason
+		name := cacheName(cacheKindSeason, p.Name(), safeCacheKey(info.IMDBID), strconv.Itoa(n))
+		path := "/tv/" + url.PathEscape(own.ProviderID) + "/season/" + strconv.Itoa(n)
+		if err := p.get(cacheKindSeason, name, path, nil, &data); err != nil {
+			return nil, fmt.Errorf("season %d: %v", n, err)
+		}
+		season := Season{Number: n}
+		for _, e := range data.Episodes {
+			episode := Episode{
+				Number:   e.EpisodeNumber,
+				Title:    e.Name,
+				Released: e.AirDate,
+			}
+			if e.Runtime != nil {
+				episode.Runtime = *e.Runtime
+			}
+			season.Episodes = append(season.Episodes, episode)
+		}
+		seasons = append(seasons, season)
+	}
+	return seasons, nil
+}
+
+func (p *tmdbProvider) Artwork(info *SeriesInfo) (string, error) {
+	if info.IMDBID == "" {
+		return "", errNoIMDBID
+	}
+	own, err := p.Lookup(info.IMDBID)
+	if err != nil {
+		return "", err
+	}
+	return own.Poster, nil
+}
+
+func (p *tmdbProvider) Check() error {
+	body, err := p.fetch("/find/"+healthCheckIMDBID, url.Values{"external_source": {"imdb_id"}})
+	if err != nil {
+		return err
+	}
+	var result struct {
+		TVResults []tmdbShow `json:"tv_results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	return nil
+}
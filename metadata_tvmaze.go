@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- TVMAZE ---
+
+// TVmaze kommt ohne API-Key aus und liefert alle Episoden einer Serie mit
+// einer einzigen Anfrage.
+
+type tvmazeShow struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	Premiered string   `json:"premiered"`
+	Ended     string   `json:"ended"`
+	Runtime   *int     `json:"runtime"`
+	Average   *int     `json:"averageRuntime"`
+	Genres    []string `json:"genres"`
+	Externals struct {
+		IMDB string `json:"imdb"`
+	} `json:"externals"`
+	Image *struct {
+		Medium   string `json:"medium"`
+		Original string `json:"original"`
+	} `json:"image"`
+}
+
+type tvmazeEpisode struct {
+	Name    string `json:"name"`
+	Season  int    `json:"season"`
+	Number  *int   `json:"number"` // null bei Specials
+	Airdate string `json:"airdate"`
+	Runtime *int   `json:"runtime"`
+}
+
+type tvmazeProvider struct {
+	baseURL string
+}
+
+func newTVmazeProvider() *tvmazeProvider {
+	return &tvmazeProvider{
+		baseURL: strings.TrimRight(envOr("TVMAZE_BASE_URL", "https://api.tvmaze.com"), "/"),
+	}
+}
+
+func (p *tvmazeProvider) Name() string { return "tvmaze" }
+
+func (p *tvmazeProvider) get(kind, name, path string, params url.Values, v interface{}) error {
+	target := p.baseURL + path
+	if len(params) > 0 {
+		target += "?" + params.Encode()
+	}
+	body, err := metadataCache.get(kind, name, func() ([]byte, error) { return metadataFetch(target, nil) })
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	return nil
+}
+
+func (p *tvmazeProvider) info(show tvmazeShow) *SeriesInfo {
+	info := &SeriesInfo{
+		Title:      show.Name,
+		Year:       yearRange(show.Premiered, show.Ended, show.Status == "Ended"),
+		IMDBID:     show.Externals.IMDB,
+		Provider:   p.Name(),
+		ProviderID: strconv.Itoa(show.ID),
+		Genres:     show.Genres,
+	}
+	// runtime fehlt bei Serien mit unterschiedlich langen Folgen.
+	switch {
+	case show.Runtime != nil:
+		info.Runtime = *show.Runtime
+	case show.Average != nil:
+		info.Runtime = *show.Average
+	}
+	if show.Image != nil {
+		info.Poster = show.Image.Original
+		if info.Poster == "" {
+			info.Poster = show.Image.Medium
+		}
+	}
+	return info
+}
+
+func (p *tvmazeProvider) Search(query string) ([]SearchItem, error) {
+	var results []struct {
+		Show tvmazeShow `json:"show"`
+	}
+	name := cacheName(cacheKindSearch, p.Name(), hashedCacheKey(query))
+	if err := p.get(cacheKindSearch, name, "/search/shows", url.Values{"q": {query}}, &results); err != nil {
+		return nil, err
+	}
+	items := []SearchItem{}
+	for _, r := range results {
+		if r.Show.Externals.IMDB == "" {
+			continue
+		}
+		item := SearchItem{
+			Title:  r.Show.Name,
+			Year:   yearRange(r.Show.Premiered, r.Show.Ended, r.Show.Status == "Ended"),
+			IMDBID: r.Show.Externals.IMDB,
+			Type:   "series",
+		}
+		if r.Show.Image != nil {
+			item.Poster = r.Show.Image.Medium
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (p *tvmazeProvider) Lookup(identifier string) (*SeriesInfo, error) {
+	var show tvmazeShow
+	var err error
+	if isIMDBID(identifier) {
+		name := cacheName(cacheKindTitle, p.Name(), safeCacheKey(identifier))
+		err = p.get(cacheKindTitle, name, "/lookup/shows", url.Values{"imdb": {identifier}}, &show)
+	} else {
+		name := cacheName(cacheKindTitle, p.Name(), "q", hashedCacheKey(identifier))
+		err = p.get(cacheKindTitle, name, "/singlesearch/shows", url.Values{"q": {identifier}}, &show)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if show.Externals.IMDB == "" {
+		return nil, errNoIMDBID
+	}
+	return p.info(show), nil
+}
+
+func (p *tvmazeProvider) Seasons(info *SeriesInfo) ([]Season, error) {
+	if info.IMDBID == "" {
+		return nil, errNoIMDBID
+	}
+	showID := info.ProviderID
+	if info.Provider != p.Name() || showID == "" {
+		own, err := p.Lookup(info.IMDBID)
+		if err != nil {
+			return nil, err
+		}
+		showID = own.ProviderID
+	}
+
+	var episodes []tvmazeEpisode
+	name := cacheName(cacheKindSeason, p.Name(), safeCacheKey(info.IMDBID))
+	if err := p.get(cacheKindSeason, name, "/shows/"+url.PathEscape(showID)+"/episodes", nil, &episodes); err != nil {
+		return nil, err
+	}
+
+	bySeason := map[int]*Season{}
+	for _, e := range episodes {
+		if e.Number == nil || e.Season < 1 {
+			continue
+		}
+		season, ok := bySeason[e.Season]
+		if !ok {
+			season = &Season{Number: e.Season}
+			bySeason[e.Season] = season
+		}
+		episode := Episode{
+			Number:   *e.Number,
+			Title:    e.Name,
+			Released: e.Airdate,
+		}
+		if e.Runtime != nil {
+			episode.Runtime = *e.Runtime
+		}
+		season.Episodes = append(season.Episodes, episode)
+	}
+	seasons := []Season{}
+	for _, season := range bySeason {
+		sort.Slice(season.Episodes, func(i, j int) bool { return season.Episodes[i].Number < season.Episodes[j].Number })
+		seasons = append(seasons, *season)
+	}
+	sort.Slice(seasons, func(i, j int) bool { return seasons[i].Number < seasons[j].Number })
+	return seasons, nil
+}
+
+func (p *tvmazeProvider) Artwork(info *SeriesInfo) (string, error) {
+	if info.IMDBID == "" {
+		return "", errNoIMDBID
+	}
+	own, err := p.Lookup(info.IMDBID)
+	if err != nil {
+		return "", err
+	}
+	return own.Poster, nil
+}
+
+func (p *tvmazeProvider) Check() error {
+	body, err := metadataFetch(p.baseURL+"/lookup/shows?imdb="+healthCheckIMDBID, nil)
+	if err != nil {
+		return err
+	}
+	var show tvmazeShow
+	if err := json.Unmarshal(body, &show); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	return nil
+}
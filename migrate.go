@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- SCHEMA-VERSIONEN & MIGRATIONEN ---
+
+// currentSchemaVersion ist die Version, die diese Programmversion schreibt.
+// Jede Änderung am Format von Series oder User bekommt eine neue Version
+// und einen Eintrag in migrations.
+const currentSchemaVersion = 3
+
+// seriesFile ist das Format von data/<nutzer>.json.
+type seriesFile struct {
+	SchemaVersion int      `json:"schema_version"`
+	Series        []Series `json:"series"`
+}
+
+// usersFile ist das Format von data/users.json.
+type usersFile struct {
+	SchemaVersion int             `json:"schema_version"`
+	Users         map[string]User `json:"users"`
+}
+
+// rawDoc ist ein einzelner Datensatz (Serie oder Nutzer) in roher Form,
+// damit Migrationen auch Felder umbenennen oder entfernen können.
+type rawDoc = map[string]interface{}
+
+type migration struct {
+	version     int
+	description string
+	// series wird auf alle Serien eines Nutzers angewendet (optional).
+	series func(username string, items []rawDoc) ([]rawDoc, error)
+	// users wird auf alle Nutzer angewendet (optional).
+	users func(users map[string]rawDoc) error
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "wrap data files in a versioned envelope",
+	},
+	{
+		// Der Episodenbaum wird beim nächsten "Aktualisieren" geladen;
+		// bis dahin gelten die alten Zähler weiter.
+		version:     2,
+		description: "add per-episode season tree to series",
+	},
+	{
+		version:     3,
+		description: "compute progress and normalize status values",
+		series:      migrateProgressAndStatus,
+	},
+}
+
+// migrateProgressAndStatus berechnet das bisher nie geschriebene Feld
+// progress und bringt Status-Werte auf die festen Schreibweisen. Alte
+// Dateien hatten immer "Watching", unabhängig vom Fortschritt.
+func migrateProgressAndStatus(username string, items []rawDoc) ([]rawDoc, error) {
+	for _, item := range items {
+		watched, _ := item["episodes_watched"].(float64)
+		total, _ := item["total_episodes"].(float64)
+		progress := 0
+		if total > 0 {
+			progress = int(watched * 100 / total)
+			if progress > 100 {
+				progress = 100
+			}
+		}
+		item["progress"] = progress
+
+		status, _ := item["status"].(string)
+		normalized := ""
+		for _, s := range validStatuses {
+			if strings.EqualFold(statusClass(s), statusClass(status)) {
+				normalized = s
+			}
+		}
+		switch {
+		case total > 0 && watched >= total:
+			normalized = statusCompleted
+		case normalized == statusOnHold || normalized == statusDropped:
+			item["status_manual"] = true
+		case watched > 0:
+			normalized = statusWatching
+		default:
+			normalized = statusPlanToWatch
+		}
+		item["status"] = normalized
+	}
+	return items, nil
+}
+
+// reservedDataFiles sind JSON-Dateien in data/, die keine Serienliste sind.
+var reservedDataFiles = map[string]bool{
+	"users.json":    true,
+	"sessions.json": true,
+	"settings.json": true,
+}
+
+// schemaError meldet eine Datei, deren Version nicht zur Programmversion passt.
+type schemaError struct {
+	file    string
+	version int
+}
+
+func (e *schemaError) Error() string {
+	if e.version > currentSchemaVersion {
+		return fmt.Sprintf("%s has schema version %d, this build only supports up to %d", e.file, e.version, currentSchemaVersion)
+	}
+	return fmt.Sprintf("%s has schema version %d and needs to be migrated to %d (restart the server)", e.file, e.version, currentSchemaVersion)
+}
+
+// decodeVersioned liest die Schema-Version einer Datei. Dateien ohne
+// Umschlag (reines Array bzw. Objekt ohne schema_version) haben Version 0.
+func decodeVersioned(data []byte, payloadKey string) (int, json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return currentSchemaVersion, nil, nil
+	}
+	if trimmed[0] == '[' {
+		return 0, trimmed, nil
+	}
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &envelope); err != nil {
+		return 0, nil, err
+	}
+	rawVersion, ok := envelope["schema_version"]
+	if !ok {
+		return 0, trimmed, nil
+	}
+	var version int
+	if err := json.Unmarshal(rawVersion, &version); err != nil {
+		return 0, nil, fmt.Errorf("invalid schema_version: %v", err)
+	}
+	return version, envelope[payloadKey], nil
+}
+
+// runMigrations bringt alle JSON-Dateien in dir auf currentSchemaVersion.
+// Vor der ersten Änderung werden die betroffenen Dateien nach
+// data/backups/migrations/<zeitstempel>/ kopiert.
+func runMigrations(dir string) error {
+	type pending struct {
+		file    string
+		version int
+		payload json.RawMessage
+		users   bool
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	var todo []pending
+	for _, file := range files {
+		name := filepath.Base(file)
+		isUsers := name == "users.json"
+		if reservedDataFiles[name] && !isUsers {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		key := "series"
+		if isUsers {
+			key = "users"
+		}
+		version, payload, err := decodeVersioned(data, key)
+		if err != nil {
+			return &corruptFileError{file: file, err: err}
+		}
+		if version > currentSchemaVersion {
+			return &schemaError{file: file, version: version}
+		}
+		if version < currentSchemaVersion {
+			todo = append(todo, pending{file: file, version: version, payload: payload, users: isUsers})
+		}
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+
+	backupDir := filepath.Join(dir, "backups", "migrations", time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup dir: %v", err)
+	}
+	for _, p := range todo {
+		if err := copyFile(p.file, filepath.Join(backupDir, filepath.Base(p.file))); err != nil {
+			return fmt.Errorf("failed to back up %s: %v", p.file, err)
+		}
+	}
+	log.Printf("migration: backed up %d file(s) to %s", len(todo), backupDir)
+
+	js, err := newJSONStore(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range todo {
+		name := filepath.Base(p.file)
+		if p.users {
+			docs := map[string]rawDoc{}
+			if len(p.payload) > 0 {
+				if err := json.Unmarshal(p.payload, &docs); err != nil {
+					return &corruptFileError{file: p.file, err: err}
+				}
+			}
+			if err := migrateUserDocs(docs, p.version, func(m migration) {
+				log.Printf("migration: %s v%d -> v%d: %s", name, m.version-1, m.version, m.description)
+			}); err != nil {
+				return fmt.Errorf("migration of %s failed: %v", name, err)
+			}
+			if err := js.writeJSON(p.file, map[string]interface{}{
+				"schema_version": currentSchemaVersion,
+				"users":          docs,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		username := name[:len(name)-len(".json")]
+		docs := []rawDoc{}
+		if len(p.payload) > 0 {
+			if err := json.Unmarshal(p.payload, &docs); err != nil {
+				return &corruptFileError{file: p.file, err: err}
+			}
+		}
+		docs, err := migrateSeriesDocs(username, docs, p.version, func(m migration) {
+			log.Printf("migration: %s v%d -> v%d: %s", name, m.version-1, m.version, m.description)
+		})
+		if err != nil {
+			return fmt.Errorf("migration of %s failed: %v", name, err)
+		}
+		if err := js.writeJSON(p.file, map[string]interface{}{
+			"schema_version": currentSchemaVersion,
+			"series":         docs,
+		}); err != nil {
+			return err
+		}
+	}
+	log.Printf("migration: %d file(s) now at schema version %d", len(todo), currentSchemaVersion)
+	return nil
+}
+
+// migrateSeriesDocs wendet alle Migrationen nach fromVersion auf die Serien
+// eines Nutzers an. Wird auch vom SQLite-Backend genutzt.
+func migrateSeriesDocs(username string, docs []rawDoc, fromVersion int, step func(m migration)) ([]rawDoc, error) {
+	for _, m := range migrations {
+		if m.version <= fromVersion {
+			continue
+		}
+		if step != nil {
+			step(m)
+		}
+		if m.series == nil {
+			continue
+		}
+		var err error
+		docs, err = m.series(username, docs)
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %v", m.version, m.description, err)
+		}
+	}
+	return docs, nil
+}
+
+// migrateUserDocs ist das Gegenstück zu migrateSeriesDocs für Nutzer.
+func migrateUserDocs(docs map[string]rawDoc, fromVersion int, step func(m migration)) error {
+	for _, m := range migrations {
+		if m.version <= fromVersion {
+			continue
+		}
+		if step != nil {
+			step(m)
+		}
+		if m.users == nil {
+			continue
+		}
+		if err := m.users(docs); err != nil {
+			return fmt.Errorf("step %d (%s): %v", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
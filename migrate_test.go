@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeVersioned(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantVersion int
+		wantPayload string
+		wantErr     bool
+	}{
+		{"empty file", "  \n", currentSchemaVersion, "", false},
+		{"bare array (v0)", `[{"id":1}]`, 0, `[{"id":1}]`, false},
+		{"object without version (v0)", `{"anna":{}}`, 0, `{"anna":{}}`, false},
+		{"envelope", `{"schema_version":2,"series":[{"id":1}]}`, 2, `[{"id":1}]`, false},
+		{"envelope without payload", `{"schema_version":3}`, 3, "", false},
+		{"invalid version", `{"schema_version":"x","series":[]}`, 0, "", true},
+		{"invalid json", `{"schema_version":`, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, payload, err := decodeVersioned([]byte(tt.data), "series")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", version, tt.wantVersion)
+			}
+			if string(payload) != tt.wantPayload {
+				t.Errorf("payload = %s, want %s", payload, tt.wantPayload)
+			}
+		})
+	}
+}
+
+func TestMigrateSeriesDocs(t *testing.T) {
+	tests := []struct {
+		name         string
+		from         int
+		doc          rawDoc
+		wantStatus   string
+		wantProgress float64
+		wantManual   bool
+	}{
+		{"v1 completed", 1, rawDoc{"episodes_watched": 10.0, "total_episodes": 10.0, "status": "Watching"}, statusCompleted, 100, false},
+		{"v1 started", 1, rawDoc{"episodes_watched": 3.0, "total_episodes": 12.0, "status": "Watching"}, statusWatching, 25, false},
+		{"v1 not started", 1, rawDoc{"episodes_watched": 0.0, "total_episodes": 12.0, "status": "Watching"}, statusPlanToWatch, 0, false},
+		{"v1 on hold stays manual", 1, rawDoc{"episodes_watched": 2.0, "total_episodes": 8.0, "status": "on hold"}, statusOnHold, 25, true},
+		{"v2 dropped stays manual", 2, rawDoc{"episodes_watched": 1.0, "total_episodes": 0.0, "status": "DROPPED"}, statusDropped, 0, true},
+		{"v0 over total is capped", 0, rawDoc{"episodes_watched": 14.0, "total_episodes": 12.0}, statusCompleted, 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := migrateSeriesDocs("anna", []rawDoc{tt.doc}, tt.from, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := docs[0]
+			if got["status"] != tt.wantStatus {
+				t.Errorf("status = %v, want %s", got["status"], tt.wantStatus)
+			}
+			if progress, _ := got["progress"].(int); float64(progress) != tt.wantProgress {
+				t.Errorf("progress = %v, want %v", got["progress"], tt.wantProgress)
+			}
+			if manual, _ := got["status_manual"].(bool); manual != tt.wantManual {
+				t.Errorf("status_manual = %v, want %v", manual, tt.wantManual)
+			}
+		})
+	}
+}
+
+func TestMigrateSeriesDocsCurrentIsUnchanged(t *testing.T) {
+	doc := rawDoc{"episodes_watched": 3.0, "total_episodes": 12.0, "status": "Whatever"}
+	docs, err := migrateSeriesDocs("anna", []rawDoc{doc}, currentSchemaVersion, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docs[0]["status"] != "Whatever" {
+		t.Errorf("status = %v, want it unchanged", docs[0]["status"])
+	}
+}
+
+func TestRunMigrations(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("users.json", `{"anna":{"display_name":"Anna","is_admin":true}}`)
+	write("anna.json", `[{"id":1,"title":"Dark","episodes_watched":26,"total_episodes":26,"status":"Watching"}]`)
+	write("sessions.json", `{}`)
+
+	if err := runMigrations(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var series seriesFile
+	readJSONFile(t, filepath.Join(dir, "anna.json"), &series)
+	if series.SchemaVersion != currentSchemaVersion {
+		t.Errorf("series schema_version = %d, want %d", series.SchemaVersion, currentSchemaVersion)
+	}
+	if len(series.Series) != 1 || series.Series[0].Status != statusCompleted || series.Series[0].Progress != 100 {
+		t.Errorf("series = %+v, want one completed series at 100%%", series.Series)
+	}
+	var users usersFile
+	readJSONFile(t, filepath.Join(dir, "users.json"), &users)
+	if users.SchemaVersion != currentSchemaVersion || !users.Users["anna"].IsAdmin {
+		t.Errorf("users = %+v, want anna as admin at version %d", users, currentSchemaVersion)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "backups", "migrations", "*", "*.json"))
+	if len(backups) != 2 {
+		t.Errorf("backed up %d files, want users.json and anna.json", len(backups))
+	}
+
+	// Ein zweiter Lauf hat nichts mehr zu tun.
+	if err := runMigrations(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunMigrationsRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(`{"schema_version":99,"series":[]}`)
+	if err := os.WriteFile(filepath.Join(dir, "anna.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := runMigrations(dir)
+	if _, ok := err.(*schemaError); !ok {
+		t.Fatalf("err = %v, want a schema error", err)
+	}
+}
+
+func readJSONFile(t *testing.T, file string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// --- PASSWÖRTER & PINS ---
+
+const minPasswordLength = 8
+
+var (
+	validPIN = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+	errPasswordTooShort  = errors.New("password must be at least 8 characters long")
+	errPasswordTooLong   = errors.New("password must be at most 72 bytes long")
+	errPasswordMismatch  = errors.New("passwords do not match")
+	errInvalidPIN        = errors.New("pin must consist of 4 to 8 digits")
+	errWrongCredential   = errors.New("wrong password or pin")
+	errUnknownCredential = errors.New("unknown credential type")
+)
+
+// HasPassword und HasPIN werden in den Templates genutzt, um das passende
+// Eingabefeld anzuzeigen.
+func (u User) HasPassword() bool { return u.PasswordHash != "" }
+func (u User) HasPIN() bool      { return u.PINHash != "" }
+
+// checkCredential prüft Passwort bzw. PIN. Profile ohne beides lassen
+// jeden Login zu.
+func (u User) checkCredential(secret string) bool {
+	hash := u.PasswordHash
+	if hash == "" {
+		hash = u.PINHash
+	}
+	if hash == "" {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+}
+
+func hashSecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// setCredential setzt je nach kind ("password", "pin" oder "none") das
+// neue Passwort bzw. die PIN des Nutzers und entfernt die jeweils andere.
+func setCredential(name, kind, secret string) error {
+	var passwordHash, pinHash string
+	switch kind {
+	case "password":
+		if utf8.RuneCountInString(secret) < minPasswordLength {
+			return errPasswordTooShort
+		}
+		if len(secret) > 72 {
+			return errPasswordTooLong
+		}
+		hash, err := hashSecret(secret)
+		if err != nil {
+			return err
+		}
+		passwordHash = hash
+	case "pin":
+		if !validPIN.MatchString(secret) {
+			return errInvalidPIN
+		}
+		hash, err := hashSecret(secret)
+		if err != nil {
+			return err
+		}
+		pinHash = hash
+	case "none":
+	default:
+		return errUnknownCredential
+	}
+
+	return updateUsers(func(all map[string]User) error {
+		u, exists := all[name]
+		if !exists {
+			return errUserNotFound
+		}
+		u.PasswordHash = passwordHash
+		u.PINHash = pinHash
+		all[name] = u
+		return nil
+	})
+}
+
+// --- FEHLVERSUCHE ---
+
+// Nach loginMaxFailures falschen Eingaben für einen Nutzer (bzw. dem
+// Vierfachen von einer IP-Adresse) wird die Anmeldung für LOGIN_LOCKOUT
+// gesperrt; jeder weitere Fehlversuch verdoppelt die Sperre bis zu
+// loginMaxLockout. Eine vierstellige PIN lässt sich so nicht mehr in
+// Sekunden durchprobieren. Die Zähler liegen nur im Speicher.
+
+const (
+	loginIPFactor    = 4
+	loginMaxLockout  = time.Hour
+	loginForgetAfter = 24 * time.Hour
+)
+
+var (
+	loginMaxFailures = envInt("LOGIN_MAX_FAILURES", 5)
+	loginLockout     = envDuration("LOGIN_LOCKOUT", time.Minute)
+
+	loginMu       sync.Mutex
+	loginFailures = map[string]*loginFailure{}
+)
+
+type loginFailure struct {
+	Count       int
+	Last        time.Time
+	LockedUntil time.Time
+}
+
+// loginKeys liefert die Zähler, die ein Versuch betrifft, samt Grenzwert.
+func loginKeys(user, ip string) map[string]int {
+	return map[string]int{
+		"user:" + user: loginMaxFailures,
+		"ip:" + ip:     loginMaxFailures * loginIPFactor,
+	}
+}
+
+// loginLocked liefert die verbleibende Sperre für Nutzer oder IP-Adresse.
+func loginLocked(user, ip string) time.Duration {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	var wait time.Duration
+	for key := range loginKeys(user, ip) {
+		if f, ok := loginFailures[key]; ok {
+			if left := time.Until(f.LockedUntil); left > wait {
+				wait = left
+			}
+		}
+	}
+	return wait
+}
+
+// recordLoginFailure zählt einen Fehlversuch und sperrt bei Bedarf.
+func recordLoginFailure(user, ip string) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	now := time.Now()
+	for key, f := range loginFailures {
+		if now.Sub(f.Last) > loginForgetAfter && now.After(f.LockedUntil) {
+			delete(loginFailures, key)
+		}
+	}
+	for key, limit := range loginKeys(user, ip) {
+		f, ok := loginFailures[key]
+		if !ok {
+			f = &loginFailure{}
+			loginFailures[key] = f
+		}
+		f.Count++
+		f.Last = now
+		if over := f.Count - limit; over >= 0 {
+			lockout := time.Duration(float64(loginLockout) * math.Pow(2, float64(over)))
+			if lockout > loginMaxLockout || lockout <= 0 {
+				lockout = loginMaxLockout
+			}
+			f.LockedUntil = now.Add(lockout)
+			log.Printf("login: locked %s for %s after %d failed attempts", key, lockout, f.Count)
+		}
+	}
+}
+
+// resetLoginFailures setzt den Zähler des Nutzers nach einer erfolgreichen
+// Anmeldung zurück. Der der IP-Adresse bleibt, damit sich mit einem
+// eigenen Konto nicht die Sperre für fremde umgehen lässt.
+func resetLoginFailures(user string) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	delete(loginFailures, "user:"+user)
+}
+
+// loginLockedMessage beschreibt die Sperre für die Login-Seite.
+func loginLockedMessage(wait time.Duration) string {
+	minutes := int(math.Ceil(wait.Minutes()))
+	if minutes <= 1 {
+		return "Zu viele Fehlversuche, bitte in einer Minute erneut versuchen"
+	}
+	return fmt.Sprintf("Zu viele Fehlversuche, bitte in %d Minuten erneut versuchen", minutes)
+}
+
+// setRetryAfter setzt den Header für eine gesperrte Anmeldung.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// --- HANDLER ---
+
+// passwordHandler lässt Nutzer ihr eigenes Passwort bzw. ihre PIN ändern.
+// Sind bereits Anmeldedaten gesetzt, müssen sie zur Bestätigung
+// eingegeben werden.
+func passwordHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+
+	if r.Method == "POST" {
+		u, _ := getUser(user)
+		kind := r.FormValue("kind")
+		secret := r.FormValue("new_secret")
+
+		var err error
+		wait := loginLocked(user, clientIP(r))
+		switch {
+		case wait > 0:
+			err = errors.New(loginLockedMessage(wait))
+		case !u.checkCredential(r.FormValue("current")):
+			recordLoginFailure(user, clientIP(r))
+			err = errWrongCredential
+		case kind != "none" && secret != r.FormValue("confirm"):
+			err = errPasswordMismatch
+		default:
+			err = setCredential(user, kind, secret)
+		}
+
+		if err != nil {
+			log.Printf("password: change failed for %s: %v", user, err)
+			data.ErrorMessage = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			log.Printf("password: %s changed credentials (%s)", user, kind)
+			current, _, _ := sessionFromRequest(r)
+			if err := revokeUserSessions(user, current); err != nil {
+				log.Printf("password: failed to revoke other sessions of %s: %v", user, err)
+			}
+			data.SuccessMessage = "Anmeldedaten gespeichert"
+		}
+	}
+
+	u, _ := getUser(user)
+	data.Account = &UserEntry{Username: user, User: u}
+	templates.ExecuteTemplate(w, "password.html", data)
+}
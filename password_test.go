@@ -0,0 +1,189 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckCredential(t *testing.T) {
+	if !(User{}).checkCredential("") {
+		t.Error("profile without credentials rejected the login")
+	}
+	hash, err := hashSecret("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := User{PINHash: hash}
+	if !pin.checkCredential("1234") || pin.checkCredential("4321") || pin.checkCredential("") {
+		t.Error("pin check is wrong")
+	}
+	hash, err = hashSecret("geheim123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := User{PasswordHash: hash}
+	if !password.checkCredential("geheim123") || password.checkCredential("Geheim123") {
+		t.Error("password check is wrong")
+	}
+}
+
+func TestSetCredentialValidates(t *testing.T) {
+	useTestData(t)
+	err := updateUsers(func(all map[string]User) error {
+		all["anna"] = User{DisplayName: "Anna", IsAdmin: true}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		kind, secret string
+		want         error
+	}{
+		{"password", "kurz", errPasswordTooShort},
+		{"password", strings.Repeat("a", 73), errPasswordTooLong},
+		{"pin", "12a4", errInvalidPIN},
+		{"pin", "123", errInvalidPIN},
+		{"token", "1234", errUnknownCredential},
+	}
+	for _, tt := range tests {
+		if err := setCredential("anna", tt.kind, tt.secret); err != tt.want {
+			t.Errorf("setCredential(%s, %q) = %v, want %v", tt.kind, tt.secret, err, tt.want)
+		}
+	}
+	if err := setCredential("ben", "none", ""); err != errUserNotFound {
+		t.Errorf("unknown user: err = %v, want %v", err, errUserNotFound)
+	}
+
+	if err := setCredential("anna", "pin", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := getUser("anna"); !u.HasPIN() || u.HasPassword() || !u.checkCredential("1234") {
+		t.Errorf("anna = %+v, want a pin", u)
+	}
+}
+
+// useLoginLimits setzt Grenzwerte und Zähler für den Test und danach zurück.
+func useLoginLimits(t *testing.T, failures int, lockout time.Duration) {
+	t.Helper()
+	previousFailures, previousLockout := loginMaxFailures, loginLockout
+	loginMu.Lock()
+	previous := loginFailures
+	loginFailures = map[string]*loginFailure{}
+	loginMu.Unlock()
+	loginMaxFailures, loginLockout = failures, lockout
+	t.Cleanup(func() {
+		loginMaxFailures, loginLockout = previousFailures, previousLockout
+		loginMu.Lock()
+		loginFailures = previous
+		loginMu.Unlock()
+	})
+}
+
+func TestLoginLockout(t *testing.T) {
+	useLoginLimits(t, 3, time.Minute)
+	for i := 0; i < 2; i++ {
+		recordLoginFailure("anna", "192.0.2.1")
+	}
+	if wait := loginLocked("anna", "192.0.2.1"); wait != 0 {
+		t.Fatalf("locked for %s before reaching the limit", wait)
+	}
+	recordLoginFailure("anna", "192.0.2.1")
+	if wait := loginLocked("anna", "192.0.2.1"); wait <= 0 || wait > time.Minute {
+		t.Errorf("locked for %s, want up to a minute", wait)
+	}
+	// Die Sperre gilt für den Nutzer auch von einer anderen Adresse.
+	if wait := loginLocked("anna", "192.0.2.2"); wait <= 0 {
+		t.Error("lockout did not apply from another address")
+	}
+	if wait := loginLocked("ben", "192.0.2.2"); wait != 0 {
+		t.Errorf("ben is locked for %s", wait)
+	}
+
+	// Jeder weitere Fehlversuch verdoppelt die Sperre, höchstens bis zur Grenze.
+	recordLoginFailure("anna", "192.0.2.1")
+	if wait := loginLocked("anna", "192.0.2.2"); wait <= time.Minute || wait > 2*time.Minute {
+		t.Errorf("locked for %s, want up to two minutes", wait)
+	}
+	for i := 0; i < 10; i++ {
+		recordLoginFailure("anna", "192.0.2.1")
+	}
+	if wait := loginLocked("anna", "192.0.2.2"); wait > loginMaxLockout {
+		t.Errorf("locked for %s, want at most %s", wait, loginMaxLockout)
+	}
+
+	resetLoginFailures("anna")
+	if wait := loginLocked("anna", "192.0.2.2"); wait != 0 {
+		t.Errorf("locked for %s after a successful login", wait)
+	}
+}
+
+func TestLoginLockoutPerAddress(t *testing.T) {
+	useLoginLimits(t, 2, time.Minute)
+	// Verteilt auf viele Nutzer greift die Grenze der Adresse.
+	users := []string{"anna", "ben", "carl", "dora", "emil", "fritz", "gerd", "hanna"}
+	for _, user := range users {
+		recordLoginFailure(user, "192.0.2.1")
+	}
+	if wait := loginLocked("ida", "192.0.2.1"); wait <= 0 {
+		t.Error("address was not locked after failures across users")
+	}
+	if wait := loginLocked("ida", "192.0.2.2"); wait != 0 {
+		t.Errorf("other address is locked for %s", wait)
+	}
+	// Eine erfolgreiche Anmeldung hebt die Sperre der Adresse nicht auf.
+	resetLoginFailures("ida")
+	if wait := loginLocked("ida", "192.0.2.1"); wait <= 0 {
+		t.Error("successful login lifted the address lockout")
+	}
+}
+
+func TestLoginHandlerLockout(t *testing.T) {
+	useTestData(t)
+	useLoginLimits(t, 2, time.Minute)
+	previousTemplates := templates
+	templates = template.Must(template.New("login.html").Parse("{{.ErrorMessage}}"))
+	t.Cleanup(func() { templates = previousTemplates })
+
+	hash, err := hashSecret("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updateUsers(func(all map[string]User) error {
+		all["anna"] = User{DisplayName: "Anna", IsAdmin: true, PINHash: hash}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(pin string) *httptest.ResponseRecorder {
+		form := url.Values{"user": {"anna"}, "password": {pin}}
+		r := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		loginHandler(w, r)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := login("0000"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong pin: status %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	}
+	// Gesperrt wird auch die richtige PIN abgewiesen.
+	w := login("1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked login: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retry := w.Header().Get("Retry-After"); retry == "" || retry == "0" {
+		t.Errorf("Retry-After = %q, want the remaining seconds", retry)
+	}
+	if !strings.Contains(w.Body.String(), "Zu viele Fehlversuche") {
+		t.Errorf("body = %q, want the lockout message", w.Body.String())
+	}
+}
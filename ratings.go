@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// --- BEWERTUNG, NOTIZEN & FAVORITEN ---
+
+// Jede Serie kann eine Bewertung von 1 bis 10 (0 = keine), private Notizen
+// und eine Favoriten-Markierung tragen. Die Angaben gehören dem jeweiligen
+// Nutzer und werden nicht mit anderen geteilt.
+
+const (
+	ratingMin     = 1
+	ratingMax     = 10
+	notesMaxRunes = 2000
+)
+
+// ratingOptions für die Auswahl in den Karten, höchste zuerst.
+var ratingOptions = func() []int {
+	options := make([]int, 0, ratingMax)
+	for n := ratingMax; n >= ratingMin; n-- {
+		options = append(options, n)
+	}
+	return options
+}()
+
+func validateRating(rating int) error {
+	if rating != 0 && (rating < ratingMin || rating > ratingMax) {
+		return fmt.Errorf("rating must be between %d and %d", ratingMin, ratingMax)
+	}
+	return nil
+}
+
+// normalizeNotes vereinheitlicht Zeilenumbrüche und begrenzt die Länge.
+func normalizeNotes(notes string) (string, error) {
+	notes = strings.TrimSpace(strings.ReplaceAll(notes, "\r\n", "\n"))
+	if utf8.RuneCountInString(notes) > notesMaxRunes {
+		return "", fmt.Errorf("notes must not exceed %d characters", notesMaxRunes)
+	}
+	return notes, nil
+}
+
+// SeriesFilter schränkt die Liste auf Favoriten, eine Mindestbewertung, einen
+// Tag oder eine eigene Liste ein.
+type SeriesFilter struct {
+	FavoritesOnly bool
+	MinRating     int
+	Tag           string
+	ListID        int
+
+	list *CustomList // von loadList gesetzt
+}
+
+// parseSeriesFilter liest ?favorite=1, ?min_rating=N, ?tag=... und ?list=N.
+// Ungültige Werte werden ignoriert.
+func parseSeriesFilter(q url.Values) SeriesFilter {
+	var f SeriesFilter
+	switch q.Get("favorite") {
+	case "1", "true", "on":
+		f.FavoritesOnly = true
+	}
+	if n, err := strconv.Atoi(q.Get("min_rating")); err == nil && n >= ratingMin && n <= ratingMax {
+		f.MinRating = n
+	}
+	if tags, err := normalizeTags([]string{q.Get("tag")}); err == nil && len(tags) == 1 {
+		f.Tag = tags[0]
+	}
+	if n, err := strconv.Atoi(q.Get("list")); err == nil && n > 0 {
+		f.ListID = n
+	}
+	return f
+}
+
+// loadList lädt die in ListID gewählte Liste des Nutzers.
+func (f *SeriesFilter) loadList(username string) error {
+	if f.ListID == 0 {
+		return nil
+	}
+	lists, err := loadLists(username)
+	if err != nil {
+		return err
+	}
+	i := findList(lists, f.ListID)
+	if i < 0 {
+		return errListNotFound
+	}
+	f.list = &lists[i]
+	return nil
+}
+
+// List liefert die gewählte Liste, sofern loadList sie gefunden hat.
+func (f SeriesFilter) List() *CustomList {
+	return f.list
+}
+
+func (f SeriesFilter) Active() bool {
+	return f.FavoritesOnly || f.MinRating > 0 || f.Tag != "" || f.ListID > 0
+}
+
+// Query hängt die Filter an Sortier-Links an, z. B. "&favorite=1".
+func (f SeriesFilter) Query() template.URL {
+	q := url.Values{}
+	if f.FavoritesOnly {
+		q.Set("favorite", "1")
+	}
+	if f.MinRating > 0 {
+		q.Set("min_rating", strconv.Itoa(f.MinRating))
+	}
+	if f.Tag != "" {
+		q.Set("tag", f.Tag)
+	}
+	if f.ListID > 0 {
+		q.Set("list", strconv.Itoa(f.ListID))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return template.URL("&" + q.Encode())
+}
+
+func filterSeries(series []Series, f SeriesFilter) []Series {
+	if !f.Active() {
+		return series
+	}
+	filtered := []Series{}
+	for _, s := range series {
+		if f.FavoritesOnly && !s.Favorite {
+			continue
+		}
+		if f.MinRating > 0 && s.Rating < f.MinRating {
+			continue
+		}
+		if f.Tag != "" && !s.HasTag(f.Tag) {
+			continue
+		}
+		if f.list != nil && !f.list.Contains(s.IMDBID) {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
+
+// safeReturnPath lässt nur Rücksprünge auf die eigenen Listen zu.
+func safeReturnPath(target string) string {
+	if target == "/" || strings.HasPrefix(target, "/mylist") {
+		return target
+	}
+	return "/"
+}
+
+// --- HANDLER ---
+
+// ratingHandler speichert Bewertung, Notizen und Favorit aus einer Karte.
+func ratingHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	rating := 0
+	if v := r.FormValue("rating"); v != "" {
+		if rating, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid rating", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := validateRating(rating); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	notes, err := normalizeNotes(r.FormValue("notes"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	favorite := r.FormValue("favorite") != ""
+
+	err = updateOneSeries(user, id, sourceWeb, func(s *Series) error {
+		s.Rating = rating
+		s.Notes = notes
+		s.Favorite = favorite
+		return nil
+	})
+	if err != nil && err != errSeriesNotFound {
+		log.Printf("failed to update series %d for %s: %v", id, user, err)
+		http.Error(w, "failed to save changes", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, safeReturnPath(r.FormValue("return")), http.StatusSeeOther)
+}
+
+// ratingLine fasst Bewertung und Favorit für das PDF zusammen.
+func ratingLine(s Series) string {
+	var parts []string
+	if s.Rating > 0 {
+		parts = append(parts, fmt.Sprintf("Bewertung: %d/%d", s.Rating, ratingMax))
+	}
+	if s.Favorite {
+		parts = append(parts, "Favorit")
+	}
+	return strings.Join(parts, " – ")
+}
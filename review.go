@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// --- JAHRESRÜCKBLICK ---
+
+// Der Rückblick wertet den Verlauf eines Kalenderjahres aus: Sehzeit, die
+// meistgesehenen Serien, in diesem Jahr abgeschlossene Serien, der stärkste
+// Monat sowie die erste und letzte Episode. Jahre vor Einführung des
+// Verlaufs bleiben leer.
+
+const reviewTopSeries = 5
+
+var germanMonthNames = [...]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"}
+
+// ReviewSeries ist eine Serie mit den im Jahr gesehenen Episoden.
+type ReviewSeries struct {
+	ID       int
+	Title    string
+	Year     string
+	Episodes int
+	Minutes  int
+	Percent  int // Balkenlänge relativ zur meistgesehenen Serie
+}
+
+func (s ReviewSeries) Hours() string { return germanDecimal(float64(s.Minutes) / 60) }
+
+type YearReview struct {
+	Year           int
+	Years          []int // Jahre mit Verlauf, neueste zuerst
+	Episodes       int
+	Minutes        int
+	UnknownRuntime int
+	SeriesCount    int
+	ActiveDays     int
+	TopSeries      []ReviewSeries
+	Completed      []ReviewSeries
+	Months         []PeriodStat
+	BusiestMonth   *PeriodStat
+	LongestStreak  Streak
+	First          *HistoryEntry
+	Last           *HistoryEntry
+}
+
+func (y YearReview) Hours() string { return germanDecimal(float64(y.Minutes) / 60) }
+
+// MonthName liefert z. B. "März" für den stärksten Monat.
+func (y YearReview) MonthName() string {
+	if y.BusiestMonth == nil {
+		return ""
+	}
+	return germanMonthNames[y.BusiestMonth.Start.Month()-1]
+}
+
+// computeYearReview wertet Liste und Verlauf für ein Kalenderjahr aus.
+func computeYearReview(series []Series, events []WatchEvent, year int) YearReview {
+	review := YearReview{Year: year}
+	runtimes := episodeRuntimes(series)
+	byIMDB := map[string]Series{}
+	for _, s := range series {
+		byIMDB[s.IMDBID] = s
+	}
+
+	months := make([]PeriodStat, 12)
+	for i := range months {
+		start := time.Date(year, time.Month(i+1), 1, 0, 0, 0, 0, time.Local)
+		months[i] = PeriodStat{Label: germanMonths[i], Start: start}
+	}
+
+	watched := watchedEvents(events)
+	years := map[int]bool{time.Now().Year(): true}
+	lastWatched := map[string]time.Time{}
+	perSeries := map[string]*ReviewSeries{}
+	var inYear []HistoryEntry
+	// watchedEvents liefert die neuesten Einträge zuerst.
+	for i := range watched {
+		e := watched[i]
+		at := e.WatchedAt.In(time.Local)
+		years[at.Year()] = true
+		if _, ok := lastWatched[e.IMDBID]; !ok {
+			lastWatched[e.IMDBID] = at
+		}
+		if at.Year() != year {
+			continue
+		}
+		inYear = append(inYear, e)
+		if review.Last == nil {
+			review.Last = &watched[i]
+		}
+		review.First = &watched[i]
+
+		minutes := runtimes.lookup(e)
+		if minutes == 0 {
+			review.UnknownRuntime++
+		}
+		review.Episodes++
+		review.Minutes += minutes
+		months[at.Month()-1].Episodes++
+		months[at.Month()-1].Minutes += minutes
+
+		rs, ok := perSeries[e.IMDBID]
+		if !ok {
+			rs = &ReviewSeries{Title: e.Title}
+			if s, found := byIMDB[e.IMDBID]; found {
+				rs.ID, rs.Title, rs.Year = s.ID, s.Title, s.Year
+			}
+			perSeries[e.IMDBID] = rs
+		}
+		rs.Episodes++
+		rs.Minutes += minutes
+	}
+
+	for y := range years {
+		review.Years = append(review.Years, y)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(review.Years)))
+
+	review.SeriesCount = len(perSeries)
+	for _, rs := range perSeries {
+		review.TopSeries = append(review.TopSeries, *rs)
+	}
+	sort.Slice(review.TopSeries, func(i, j int) bool {
+		a, b := review.TopSeries[i], review.TopSeries[j]
+		if a.Episodes != b.Episodes {
+			return a.Episodes > b.Episodes
+		}
+		if a.Minutes != b.Minutes {
+			return a.Minutes > b.Minutes
+		}
+		return a.Title < b.Title
+	})
+	if len(review.TopSeries) > reviewTopSeries {
+		review.TopSeries = review.TopSeries[:reviewTopSeries]
+	}
+	for i := range review.TopSeries {
+		review.TopSeries[i].Percent = percent(review.TopSeries[i].Episodes, review.TopSeries[0].Episodes)
+	}
+
+	// Als in diesem Jahr abgeschlossen gilt eine Serie, deren letzte
+	// gesehene Episode in das Jahr fällt.
+	for _, s := range series {
+		at, ok := lastWatched[s.IMDBID]
+		if s.Status != statusCompleted || !ok || at.Year() != year {
+			continue
+		}
+		rs := ReviewSeries{ID: s.ID, Title: s.Title, Year: s.Year}
+		if p, ok := perSeries[s.IMDBID]; ok {
+			rs.Episodes, rs.Minutes = p.Episodes, p.Minutes
+		}
+		review.Completed = append(review.Completed, rs)
+	}
+	sort.Slice(review.Completed, func(i, j int) bool {
+		return review.Completed[i].Title < review.Completed[j].Title
+	})
+
+	scalePeriods(months)
+	review.Months = months
+	for i := range months {
+		if months[i].Episodes > 0 && (review.BusiestMonth == nil || months[i].Episodes > review.BusiestMonth.Episodes) {
+			review.BusiestMonth = &months[i]
+		}
+	}
+
+	days := map[time.Time]bool{}
+	for _, e := range inYear {
+		days[startOfDay(e.WatchedAt)] = true
+	}
+	review.ActiveDays = len(days)
+	review.LongestStreak, _ = watchStreaks(inYear, time.Now())
+	return review
+}
+
+// loadYearReview lädt Liste und Verlauf und wertet das Jahr aus.
+func loadYearReview(username string, year int) (YearReview, error) {
+	series, err := store.LoadSeries(username)
+	if err != nil {
+		return YearReview{}, err
+	}
+	events, err := loadHistory(username)
+	if err != nil {
+		return YearReview{}, err
+	}
+	return computeYearReview(series, events, year), nil
+}
+
+// reviewYear liest ?year=, ohne gültige Angabe gilt das laufende Jahr.
+func reviewYear(r *http.Request) int {
+	now := time.Now().Year()
+	if y, err := strconv.Atoi(r.URL.Query().Get("year")); err == nil && y >= 1900 && y <= now {
+		return y
+	}
+	return now
+}
+
+// --- HANDLER ---
+
+func reviewHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+	review, err := loadYearReview(user, reviewYear(r))
+	if err != nil {
+		log.Printf("review: failed to compute year in review for %s: %v", user, err)
+		data.ErrorMessage = "failed to load year in review"
+	}
+	data.Review = &review
+	templates.ExecuteTemplate(w, "review.html", data)
+}
+
+func reviewPDFHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	review, err := loadYearReview(user, reviewYear(r))
+	if err != nil {
+		log.Printf("review: failed to compute year in review for %s: %v", user, err)
+		http.Error(w, "failed to load year in review", http.StatusInternalServerError)
+		return
+	}
+	name := user
+	if u, ok := getUser(user); ok && u.DisplayName != "" {
+		name = u.DisplayName
+	}
+	pdf := reviewPDF(review, name)
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=jahresrueckblick-%d.pdf", review.Year))
+	if err := pdf.Output(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// --- PDF ---
+
+// Farben des Rückblicks, angelehnt an das Netflix-Theme.
+var (
+	reviewAccent = [3]int{229, 9, 20}
+	reviewDark   = [3]int{20, 20, 20}
+	reviewMuted  = [3]int{120, 120, 120}
+	reviewLight  = [3]int{242, 242, 242}
+)
+
+func reviewPDF(review YearReview, name string) *gofpdf.Fpdf {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	utf8 := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle(utf8(fmt.Sprintf("Jahresrückblick %d", review.Year)), false)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+
+	// Kopfbereich über die ganze Breite.
+	pdf.SetFillColor(reviewDark[0], reviewDark[1], reviewDark[2])
+	pdf.Rect(0, 0, 210, 48, "F")
+	pdf.SetFillColor(reviewAccent[0], reviewAccent[1], reviewAccent[2])
+	pdf.Rect(0, 48, 210, 2, "F")
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetXY(15, 12)
+	pdf.SetFont("Helvetica", "B", 28)
+	pdf.CellFormat(0, 12, utf8(fmt.Sprintf("Jahresrückblick %d", review.Year)), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 13)
+	pdf.CellFormat(0, 8, utf8("Serien Tracker – "+name), "", 2, "L", false, 0, "")
+	pdf.SetY(58)
+
+	if review.Episodes == 0 {
+		pdf.SetTextColor(reviewDark[0], reviewDark[1], reviewDark[2])
+		pdf.SetFont("Helvetica", "", 12)
+		pdf.SetX(15)
+		pdf.MultiCell(180, 6, utf8(fmt.Sprintf("Für %d sind im Verlauf keine gesehenen Episoden erfasst.", review.Year)), "", "L", false)
+		return pdf
+	}
+
+	// Kennzahlen als Kacheln.
+	tiles := []struct{ value, label string }{
+		{review.Hours() + " h", "Sehzeit"},
+		{strconv.Itoa(review.Episodes), "Episoden"},
+		{strconv.Itoa(review.SeriesCount), "Serien"},
+		{strconv.Itoa(review.ActiveDays), "Tage mit Serien"},
+	}
+	tileW, gap := 42.0, 4.0
+	y := pdf.GetY()
+	for i, t := range tiles {
+		x := 15 + float64(i)*(tileW+gap)
+		pdf.SetFillColor(reviewLight[0], reviewLight[1], reviewLight[2])
+		pdf.Rect(x, y, tileW, 24, "F")
+		pdf.SetXY(x, y+4)
+		pdf.SetTextColor(reviewAccent[0], reviewAccent[1], reviewAccent[2])
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(tileW, 8, utf8(t.value), "", 2, "C", false, 0, "")
+		pdf.SetTextColor(reviewMuted[0], reviewMuted[1], reviewMuted[2])
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(tileW, 6, utf8(t.label), "", 0, "C", false, 0, "")
+	}
+	pdf.SetY(y + 32)
+
+	var highlights []string
+	if review.BusiestMonth != nil {
+		highlights = append(highlights, fmt.Sprintf("Stärkster Monat: %s mit %d Episoden", review.MonthName(), review.BusiestMonth.Episodes))
+	}
+	if review.LongestStreak.Days > 1 {
+		highlights = append(highlights, fmt.Sprintf("Längste Streak: %d Tage am Stück (%s–%s)",
+			review.LongestStreak.Days, review.LongestStreak.Start.Format("02.01."), review.LongestStreak.End.Format("02.01.")))
+	}
+	if review.First != nil {
+		highlights = append(highlights, fmt.Sprintf("Erste Episode: %s %s am %s",
+			review.First.Title, review.First.Code(), review.First.WatchedAt.In(time.Local).Format("02.01.")))
+	}
+	if review.Last != nil {
+		highlights = append(highlights, fmt.Sprintf("Letzte Episode: %s %s am %s",
+			review.Last.Title, review.Last.Code(), review.Last.WatchedAt.In(time.Local).Format("02.01.")))
+	}
+	reviewHeading(pdf, utf8, "Highlights")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.SetTextColor(reviewDark[0], reviewDark[1], reviewDark[2])
+	for _, h := range highlights {
+		pdf.SetX(15)
+		pdf.MultiCell(180, 6, utf8("• "+h), "", "L", false)
+	}
+	pdf.Ln(4)
+
+	reviewHeading(pdf, utf8, "Meistgesehene Serien")
+	for i, s := range review.TopSeries {
+		y := pdf.GetY()
+		pdf.SetXY(15, y)
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.SetTextColor(reviewDark[0], reviewDark[1], reviewDark[2])
+		pdf.CellFormat(8, 7, strconv.Itoa(i+1)+".", "", 0, "L", false, 0, "")
+		pdf.CellFormat(82, 7, utf8(s.Title), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.SetTextColor(reviewMuted[0], reviewMuted[1], reviewMuted[2])
+		pdf.CellFormat(40, 7, utf8(fmt.Sprintf("%d Ep. · %s h", s.Episodes, s.Hours())), "", 0, "L", false, 0, "")
+		pdf.SetFillColor(reviewAccent[0], reviewAccent[1], reviewAccent[2])
+		pdf.Rect(145, y+2, 50*float64(s.Percent)/100, 3, "F")
+		pdf.SetY(y + 8)
+	}
+	pdf.Ln(4)
+
+	reviewHeading(pdf, utf8, "Episoden pro Monat")
+	chartTop, chartH := pdf.GetY()+2, 40.0
+	barW := 180.0 / 12
+	for i, m := range review.Months {
+		x := 15 + float64(i)*barW
+		h := chartH * float64(m.Percent) / 100
+		if m.Episodes > 0 {
+			if review.BusiestMonth != nil && m.Start.Equal(review.BusiestMonth.Start) {
+				pdf.SetFillColor(reviewAccent[0], reviewAccent[1], reviewAccent[2])
+			} else {
+				pdf.SetFillColor(reviewMuted[0], reviewMuted[1], reviewMuted[2])
+			}
+			pdf.Rect(x+2, chartTop+chartH-h, barW-4, h, "F")
+			pdf.SetXY(x, chartTop+chartH-h-5)
+			pdf.SetFont("Helvetica", "", 8)
+			pdf.SetTextColor(reviewDark[0], reviewDark[1], reviewDark[2])
+			pdf.CellFormat(barW, 5, strconv.Itoa(m.Episodes), "", 0, "C", false, 0, "")
+		}
+		pdf.SetXY(x, chartTop+chartH+1)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(reviewMuted[0], reviewMuted[1], reviewMuted[2])
+		pdf.CellFormat(barW, 5, utf8(m.Label), "", 0, "C", false, 0, "")
+	}
+	pdf.SetY(chartTop + chartH + 12)
+
+	reviewHeading(pdf, utf8, "Abgeschlossen")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.SetTextColor(reviewDark[0], reviewDark[1], reviewDark[2])
+	if len(review.Completed) == 0 {
+		pdf.SetX(15)
+		pdf.MultiCell(180, 6, utf8("In diesem Jahr wurde keine Serie abgeschlossen."), "", "L", false)
+	}
+	for _, s := range review.Completed {
+		pdf.SetX(15)
+		pdf.MultiCell(180, 6, utf8(fmt.Sprintf("• %s (%s)", s.Title, s.Year)), "", "L", false)
+	}
+
+	if review.UnknownRuntime > 0 {
+		pdf.Ln(4)
+		pdf.SetX(15)
+		pdf.SetFont("Helvetica", "I", 9)
+		pdf.SetTextColor(reviewMuted[0], reviewMuted[1], reviewMuted[2])
+		pdf.MultiCell(180, 5, utf8(fmt.Sprintf("Für %d Episoden ist keine Laufzeit bekannt; sie fehlen in der Sehzeit.", review.UnknownRuntime)), "", "L", false)
+	}
+	return pdf
+}
+
+// reviewHeading setzt eine Zwischenüberschrift mit Akzentstrich.
+func reviewHeading(pdf *gofpdf.Fpdf, utf8 func(string) string, title string) {
+	y := pdf.GetY()
+	pdf.SetFillColor(reviewAccent[0], reviewAccent[1], reviewAccent[2])
+	pdf.Rect(15, y+1, 1.5, 6, "F")
+	pdf.SetXY(19, y)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.SetTextColor(reviewDark[0], reviewDark[1], reviewDark[2])
+	pdf.CellFormat(0, 8, utf8(title), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- SITZUNGEN ---
+
+// Session ist eine angemeldete Browser-Sitzung. Der Cookie enthält nur eine
+// zufällige ID; gespeichert wird deren SHA-256, damit eine kopierte
+// sessions.json keine gültigen Cookies verrät.
+type Session struct {
+	Username   string    `json:"username"`
+	Created    time.Time `json:"created"`
+	LastSeen   time.Time `json:"last_seen"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CSRFToken  string    `json:"csrf_token,omitempty"`
+}
+
+// SessionEntry ist eine Sitzung samt Schlüssel für die Admin-Übersicht.
+type SessionEntry struct {
+	ID      string
+	Current bool
+	Session
+}
+
+const (
+	sessionCookie = "session"
+	// LastSeen wird höchstens so oft gespeichert, sonst schriebe jeder
+	// Seitenaufruf die Sitzungsdatei neu.
+	sessionTouchInterval = time.Minute
+)
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[string]Session{}
+
+	sessionIdleTimeout = envDuration("SESSION_IDLE_TIMEOUT", 7*24*time.Hour)
+	sessionMaxAge      = envDuration("SESSION_MAX_AGE", 30*24*time.Hour)
+)
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️  warning: invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("⚠️  warning: invalid %s %q, using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// randomToken liefert 32 zufällige Bytes, URL-sicher kodiert.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashSessionID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s Session) expired(now time.Time) bool {
+	return now.Sub(s.LastSeen) > sessionIdleTimeout || now.Sub(s.Created) > sessionMaxAge
+}
+
+// loadSessions übernimmt die gespeicherten Sitzungen beim Start und
+// verwirft dabei abgelaufene.
+func loadSessions() error {
+	loaded, err := store.LoadSessions()
+	if err != nil {
+		return err
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	sessions = loaded
+	return purgeExpiredSessionsLocked()
+}
+
+// saveSessionsLocked schreibt alle Sitzungen; sessionsMu muss gehalten werden.
+func saveSessionsLocked() error {
+	snapshot := make(map[string]Session, len(sessions))
+	for k, v := range sessions {
+		snapshot[k] = v
+	}
+	return store.SaveSessions(snapshot)
+}
+
+func purgeExpiredSessionsLocked() error {
+	now := time.Now()
+	removed := 0
+	for id, s := range sessions {
+		if s.expired(now) {
+			delete(sessions, id)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	log.Printf("sessions: removed %d expired sessions", removed)
+	return saveSessionsLocked()
+}
+
+// purgeExpiredSessions läuft regelmäßig im Hintergrund.
+func purgeExpiredSessions(interval time.Duration) {
+	for range time.Tick(interval) {
+		sessionsMu.Lock()
+		if err := purgeExpiredSessionsLocked(); err != nil {
+			log.Printf("sessions: failed to save after cleanup: %v", err)
+		}
+		sessionsMu.Unlock()
+	}
+}
+
+// createSession legt eine neue Sitzung an und setzt den Cookie.
+func createSession(w http.ResponseWriter, r *http.Request, username string) error {
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	sessionsMu.Lock()
+	sessions[hashSessionID(id)] = Session{
+		Username:   username,
+		Created:    now,
+		LastSeen:   now,
+		RemoteAddr: clientIP(r),
+		UserAgent:  r.UserAgent(),
+		CSRFToken:  token,
+	}
+	err = saveSessionsLocked()
+	sessionsMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// sessionFromRequest liefert Schlüssel und Sitzung zum Cookie der Anfrage.
+// Abgelaufene Sitzungen werden dabei entfernt, gültige aufgefrischt.
+func sessionFromRequest(r *http.Request) (string, Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return "", Session{}, false
+	}
+	id := hashSessionID(cookie.Value)
+	now := time.Now()
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[id]
+	if !ok {
+		return "", Session{}, false
+	}
+	if s.expired(now) {
+		delete(sessions, id)
+		if err := saveSessionsLocked(); err != nil {
+			log.Printf("sessions: failed to remove expired session: %v", err)
+		}
+		return "", Session{}, false
+	}
+	if now.Sub(s.LastSeen) > sessionTouchInterval {
+		s.LastSeen = now
+		s.RemoteAddr = clientIP(r)
+		sessions[id] = s
+		if err := saveSessionsLocked(); err != nil {
+			log.Printf("sessions: failed to update last seen: %v", err)
+		}
+	}
+	return id, s, true
+}
+
+// revokeSession beendet eine Sitzung anhand ihres Schlüssels.
+func revokeSession(id string) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if _, ok := sessions[id]; !ok {
+		return nil
+	}
+	delete(sessions, id)
+	return saveSessionsLocked()
+}
+
+// revokeUserSessions beendet alle Sitzungen eines Nutzers außer except
+// (z. B. der eigenen nach einer Passwortänderung).
+func revokeUserSessions(username, except string) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	removed := 0
+	for id, s := range sessions {
+		if s.Username == username && id != except {
+			delete(sessions, id)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	log.Printf("sessions: revoked %d sessions of %s", removed, username)
+	return saveSessionsLocked()
+}
+
+// listSessions liefert alle gültigen Sitzungen, zuletzt aktive zuerst.
+func listSessions(current string) []SessionEntry {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	now := time.Now()
+	list := make([]SessionEntry, 0, len(sessions))
+	for id, s := range sessions {
+		if s.expired(now) {
+			continue
+		}
+		list = append(list, SessionEntry{ID: id, Current: id == current, Session: s})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeen.After(list[j].LastSeen)
+	})
+	return list
+}
+
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// isSecureRequest erkennt HTTPS auch hinter einem Reverse Proxy.
+// COOKIE_SECURE=true erzwingt das Secure-Flag.
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil ||
+		strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") ||
+		os.Getenv("COOKIE_SECURE") == "true"
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// --- HANDLER ---
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id, s, ok := sessionFromRequest(r); ok {
+		if err := revokeSession(id); err != nil {
+			log.Printf("sessions: logout failed for %s: %v", s.Username, err)
+		}
+	}
+	clearSessionCookie(w, r)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
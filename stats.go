@@ -0,0 +1,440 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// --- STATISTIK ---
+
+// Die Sehzeit ergibt sich aus dem aktuellen Gesehen-Stand und den Laufzeiten
+// der Episoden (ersatzweise der üblichen Länge der Serie). Wochen, Monate und
+// Streaks kommen aus dem Verlauf, da nur dort steht, wann etwas gesehen wurde.
+
+const (
+	statsWeeks    = 12
+	statsMonths   = 12
+	statsTopRated = 10
+)
+
+var germanMonths = [...]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"}
+
+type StatusStat struct {
+	Status          string `json:"status"`
+	Series          int    `json:"series"`
+	EpisodesWatched int    `json:"episodes_watched"`
+	TotalEpisodes   int    `json:"total_episodes"`
+	Completion      int    `json:"completion"` // Prozent der Episoden
+}
+
+// PeriodStat ist eine Woche oder ein Monat im Verlauf.
+type PeriodStat struct {
+	Label    string    `json:"label"`
+	Start    time.Time `json:"start"`
+	Episodes int       `json:"episodes"`
+	Minutes  int       `json:"minutes"`
+	Percent  int       `json:"-"` // Balkenlänge relativ zum stärksten Zeitraum
+}
+
+type GenreStat struct {
+	Genre   string `json:"genre"`
+	Series  int    `json:"series"`
+	Minutes int    `json:"minutes"`
+	Percent int    `json:"-"`
+}
+
+func (p PeriodStat) Hours() string { return germanDecimal(float64(p.Minutes) / 60) }
+
+func (g GenreStat) Hours() string { return germanDecimal(float64(g.Minutes) / 60) }
+
+// Streak ist eine Folge von Tagen mit mindestens einer gesehenen Episode.
+type Streak struct {
+	Days  int        `json:"days"`
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+type RatedSeries struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	Year     string `json:"year"`
+	Rating   int    `json:"rating"`
+	Favorite bool   `json:"favorite,omitempty"`
+}
+
+type Stats struct {
+	TotalSeries     int `json:"total_series"`
+	CompletedSeries int `json:"completed_series"`
+	EpisodesWatched int `json:"episodes_watched"`
+	TotalEpisodes   int `json:"total_episodes"`
+	MinutesWatched  int `json:"minutes_watched"`
+	// Gesehene Episoden ohne bekannte Laufzeit, sie fehlen in MinutesWatched.
+	UnknownRuntime int `json:"unknown_runtime"`
+
+	ByStatus      []StatusStat  `json:"by_status"`
+	Weekly        []PeriodStat  `json:"weekly"`
+	Monthly       []PeriodStat  `json:"monthly"`
+	Genres        []GenreStat   `json:"genres"`
+	LongestStreak Streak        `json:"longest_streak"`
+	CurrentStreak Streak        `json:"current_streak"`
+	TopRated      []RatedSeries `json:"top_rated"`
+}
+
+// Hours liefert die Sehzeit in Stunden für die Anzeige, z. B. "12,5".
+func (s Stats) Hours() string {
+	return germanDecimal(float64(s.MinutesWatched) / 60)
+}
+
+// Days liefert die Sehzeit in Tagen, z. B. "1,5".
+func (s Stats) Days() string {
+	return germanDecimal(float64(s.MinutesWatched) / 60 / 24)
+}
+
+func germanDecimal(v float64) string {
+	text := fmt.Sprintf("%.1f", v)
+	return text[:len(text)-2] + "," + text[len(text)-1:]
+}
+
+// percent rechnet in ganzen Prozent, höchstens 100.
+func percent(part, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	if part >= total {
+		return 100
+	}
+	return part * 100 / total
+}
+
+// episodeRuntime liefert die Länge einer Episode oder die übliche der Serie.
+func episodeRuntime(s Series, e Episode) int {
+	if e.Runtime > 0 {
+		return e.Runtime
+	}
+	return s.Runtime
+}
+
+// watchedMinutes summiert die Laufzeit aller gesehenen Episoden einer Serie
+// und zählt die, deren Länge unbekannt ist.
+func watchedMinutes(s Series) (minutes, unknown int) {
+	if len(s.Seasons) == 0 {
+		if s.Runtime == 0 {
+			return 0, s.EpisodesWatched
+		}
+		return s.EpisodesWatched * s.Runtime, 0
+	}
+	for _, season := range s.Seasons {
+		for _, e := range season.Episodes {
+			if !e.Watched {
+				continue
+			}
+			if runtime := episodeRuntime(s, e); runtime > 0 {
+				minutes += runtime
+			} else {
+				unknown++
+			}
+		}
+	}
+	return minutes, unknown
+}
+
+// computeStats wertet Liste und Verlauf eines Nutzers aus. now bestimmt,
+// welche Wochen und Monate gezeigt werden.
+func computeStats(series []Series, events []WatchEvent, now time.Time) Stats {
+	stats := Stats{TotalSeries: len(series)}
+
+	byStatus := map[string]*StatusStat{}
+	for _, status := range validStatuses {
+		byStatus[status] = &StatusStat{Status: status}
+	}
+	genres := map[string]*GenreStat{}
+	for _, s := range series {
+		stats.EpisodesWatched += s.EpisodesWatched
+		stats.TotalEpisodes += s.TotalEpisodes
+		if s.Status == statusCompleted {
+			stats.CompletedSeries++
+		}
+		minutes, unknown := watchedMinutes(s)
+		stats.MinutesWatched += minutes
+		stats.UnknownRuntime += unknown
+
+		if st, ok := byStatus[s.Status]; ok {
+			st.Series++
+			st.EpisodesWatched += s.EpisodesWatched
+			st.TotalEpisodes += s.TotalEpisodes
+		}
+		for _, g := range s.Genres {
+			gs, ok := genres[g]
+			if !ok {
+				gs = &GenreStat{Genre: g}
+				genres[g] = gs
+			}
+			gs.Series++
+			gs.Minutes += minutes
+		}
+		if s.Rating > 0 {
+			stats.TopRated = append(stats.TopRated, RatedSeries{ID: s.ID, Title: s.Title, Year: s.Year, Rating: s.Rating, Favorite: s.Favorite})
+		}
+	}
+
+	for _, status := range validStatuses {
+		st := byStatus[status]
+		st.Completion = percent(st.EpisodesWatched, st.TotalEpisodes)
+		stats.ByStatus = append(stats.ByStatus, *st)
+	}
+	for _, gs := range genres {
+		stats.Genres = append(stats.Genres, *gs)
+	}
+	sort.Slice(stats.Genres, func(i, j int) bool {
+		if stats.Genres[i].Minutes != stats.Genres[j].Minutes {
+			return stats.Genres[i].Minutes > stats.Genres[j].Minutes
+		}
+		if stats.Genres[i].Series != stats.Genres[j].Series {
+			return stats.Genres[i].Series > stats.Genres[j].Series
+		}
+		return stats.Genres[i].Genre < stats.Genres[j].Genre
+	})
+	sort.SliceStable(stats.TopRated, func(i, j int) bool {
+		if stats.TopRated[i].Rating != stats.TopRated[j].Rating {
+			return stats.TopRated[i].Rating > stats.TopRated[j].Rating
+		}
+		return stats.TopRated[i].Title < stats.TopRated[j].Title
+	})
+	// Ohne bekannte Laufzeiten bemessen sich die Balken an der Zahl der Serien.
+	for i := range stats.Genres {
+		if top := stats.Genres[0]; top.Minutes > 0 {
+			stats.Genres[i].Percent = percent(stats.Genres[i].Minutes, top.Minutes)
+		} else {
+			stats.Genres[i].Percent = percent(stats.Genres[i].Series, top.Series)
+		}
+	}
+	if len(stats.TopRated) > statsTopRated {
+		stats.TopRated = stats.TopRated[:statsTopRated]
+	}
+
+	watched := watchedEvents(events)
+	stats.Weekly, stats.Monthly = watchPeriods(series, watched, now)
+	stats.LongestStreak, stats.CurrentStreak = watchStreaks(watched, now)
+	return stats
+}
+
+// watchedEvents liefert die gültigen "gesehen"-Einträge des Verlaufs, die
+// neuesten zuerst. Jede Episode zählt höchstens einmal: In der Reihenfolge
+// der Aufzeichnung hebt "nicht gesehen" das vorherige "gesehen" auf, und
+// ein weiteres "gesehen" derselben Episode (erneutes Abhaken, Import über
+// vorhandene Markierungen) wird übersprungen.
+func watchedEvents(events []WatchEvent) []HistoryEntry {
+	entries := resolveHistory(events)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Recorded.Before(entries[j].Recorded)
+	})
+	type episodeKey struct {
+		series          string
+		season, episode int
+	}
+	current := map[episodeKey]HistoryEntry{}
+	for _, e := range entries {
+		if e.Undone {
+			continue
+		}
+		key := episodeKey{e.IMDBID, e.Season, e.Episode}
+		if e.IMDBID == "" {
+			key.series = fmt.Sprintf("#%d", e.SeriesID)
+		}
+		switch e.Action {
+		case actionWatched:
+			if _, ok := current[key]; !ok {
+				current[key] = e
+			}
+		case actionUnwatched:
+			delete(current, key)
+		}
+	}
+	watched := make([]HistoryEntry, 0, len(current))
+	for _, e := range current {
+		watched = append(watched, e)
+	}
+	sort.Slice(watched, func(i, j int) bool {
+		if !watched[i].WatchedAt.Equal(watched[j].WatchedAt) {
+			return watched[i].WatchedAt.After(watched[j].WatchedAt)
+		}
+		return watched[i].ID < watched[j].ID
+	})
+	return watched
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// startOfWeek liefert den Montag der Woche.
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// watchPeriods zählt Episoden und Minuten der letzten Wochen und Monate.
+func watchPeriods(series []Series, watched []HistoryEntry, now time.Time) ([]PeriodStat, []PeriodStat) {
+	runtimes := episodeRuntimes(series)
+
+	weekly := make([]PeriodStat, statsWeeks)
+	first := startOfWeek(now).AddDate(0, 0, -7*(statsWeeks-1))
+	for i := range weekly {
+		start := first.AddDate(0, 0, 7*i)
+		_, week := start.ISOWeek()
+		weekly[i] = PeriodStat{Label: fmt.Sprintf("KW %d", week), Start: start}
+	}
+	monthly := make([]PeriodStat, statsMonths)
+	firstMonth := startOfMonth(now).AddDate(0, -(statsMonths - 1), 0)
+	for i := range monthly {
+		start := firstMonth.AddDate(0, i, 0)
+		monthly[i] = PeriodStat{Label: fmt.Sprintf("%s %d", germanMonths[start.Month()-1], start.Year()), Start: start}
+	}
+
+	for _, e := range watched {
+		minutes := runtimes.lookup(e)
+		// Gerundet, da Wochen mit Zeitumstellung nicht genau 168 Stunden haben.
+		if w := int(math.Round(startOfWeek(e.WatchedAt).Sub(first).Hours() / 24 / 7)); !e.WatchedAt.Before(first) && w < len(weekly) {
+			weekly[w].Episodes++
+			weekly[w].Minutes += minutes
+		}
+		at := e.WatchedAt.In(time.Local)
+		if m := (at.Year()-firstMonth.Year())*12 + int(at.Month()) - int(firstMonth.Month()); m >= 0 && m < len(monthly) {
+			monthly[m].Episodes++
+			monthly[m].Minutes += minutes
+		}
+	}
+	scalePeriods(weekly)
+	scalePeriods(monthly)
+	return weekly, monthly
+}
+
+func scalePeriods(periods []PeriodStat) {
+	max := 0
+	for _, p := range periods {
+		if p.Episodes > max {
+			max = p.Episodes
+		}
+	}
+	for i := range periods {
+		periods[i].Percent = percent(periods[i].Episodes, max)
+	}
+}
+
+// runtimeIndex findet die Laufzeit zu einem Verlaufseintrag.
+type runtimeIndex struct {
+	episodes map[string]map[[2]int]int
+	series   map[string]int
+}
+
+func episodeRuntimes(series []Series) runtimeIndex {
+	idx := runtimeIndex{episodes: map[string]map[[2]int]int{}, series: map[string]int{}}
+	for _, s := range series {
+		idx.series[s.IMDBID] = s.Runtime
+		eps := map[[2]int]int{}
+		for _, season := range s.Seasons {
+			for _, e := range season.Episodes {
+				eps[[2]int{season.Number, e.Number}] = episodeRuntime(s, e)
+			}
+		}
+		idx.episodes[s.IMDBID] = eps
+	}
+	return idx
+}
+
+func (idx runtimeIndex) lookup(e HistoryEntry) int {
+	if runtime := idx.episodes[e.IMDBID][[2]int{e.Season, e.Episode}]; runtime > 0 {
+		return runtime
+	}
+	return idx.series[e.IMDBID]
+}
+
+// watchStreaks liefert die längste und die aktuelle Serie von Tagen mit
+// gesehenen Episoden. Die aktuelle zählt noch, wenn heute nichts gesehen
+// wurde, gestern aber schon.
+func watchStreaks(watched []HistoryEntry, now time.Time) (longest, current Streak) {
+	days := map[time.Time]bool{}
+	for _, e := range watched {
+		days[startOfDay(e.WatchedAt)] = true
+	}
+	sorted := make([]time.Time, 0, len(days))
+	for d := range days {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	var runStart, runEnd time.Time
+	runDays := 0
+	for _, d := range sorted {
+		if runDays > 0 && runEnd.AddDate(0, 0, 1).Equal(d) {
+			runDays++
+		} else {
+			runDays, runStart = 1, d
+		}
+		runEnd = d
+		if runDays > longest.Days {
+			longest = newStreak(runDays, runStart, runEnd)
+		}
+	}
+	todayStart := startOfDay(now)
+	if runDays > 0 && (runEnd.Equal(todayStart) || runEnd.Equal(todayStart.AddDate(0, 0, -1))) {
+		current = newStreak(runDays, runStart, runEnd)
+	}
+	return longest, current
+}
+
+func newStreak(days int, start, end time.Time) Streak {
+	return Streak{Days: days, Start: &start, End: &end}
+}
+
+// loadStats lädt Liste und Verlauf und wertet sie aus.
+func loadStats(username string) (Stats, error) {
+	series, err := store.LoadSeries(username)
+	if err != nil {
+		return Stats{}, err
+	}
+	events, err := loadHistory(username)
+	if err != nil {
+		return Stats{}, err
+	}
+	return computeStats(series, events, time.Now()), nil
+}
+
+// --- HANDLER ---
+
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+	stats, err := loadStats(user)
+	if err != nil {
+		log.Printf("stats: failed to compute statistics for %s: %v", user, err)
+		data.ErrorMessage = "failed to load statistics"
+	}
+	data.Stats = &stats
+	templates.ExecuteTemplate(w, "stats.html", data)
+}
+
+func apiStats(w http.ResponseWriter, r *http.Request, user string) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	stats, err := loadStats(user)
+	if err != nil {
+		log.Printf("api: failed to compute statistics for %s: %v", user, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to load statistics")
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
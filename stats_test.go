@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// statsEvent baut ein Verlaufsereignis, aufgezeichnet zum Zeitpunkt at.
+func statsEvent(id, action, imdbID string, episode int, at time.Time) WatchEvent {
+	return WatchEvent{ID: id, Action: action, IMDBID: imdbID, Season: 1, Episode: episode, WatchedAt: at, Recorded: at}
+}
+
+func TestWatchedEventsCountsEachEpisodeOnce(t *testing.T) {
+	day := time.Date(2024, 3, 1, 20, 0, 0, 0, time.Local)
+	events := []WatchEvent{
+		statsEvent("a", actionWatched, "tt5753856", 1, day),
+		// Erneut abgehakt oder importiert: zählt nicht noch einmal.
+		statsEvent("b", actionWatched, "tt5753856", 1, day.Add(24*time.Hour)),
+		// Abgewählt und später neu gesehen: zählt mit dem neuen Zeitpunkt.
+		statsEvent("c", actionWatched, "tt5753856", 2, day),
+		statsEvent("d", actionUnwatched, "tt5753856", 2, day.Add(time.Hour)),
+		statsEvent("e", actionWatched, "tt5753856", 2, day.Add(48*time.Hour)),
+		// Rückgängig gemacht: zählt gar nicht.
+		statsEvent("f", actionWatched, "tt2802850", 1, day),
+		{ID: "g", Action: actionUndo, Ref: "f", Recorded: day.Add(time.Hour)},
+		// Dieselbe Episode einer anderen Serie ist eine eigene.
+		statsEvent("h", actionWatched, "tt0411008", 1, day),
+		// Alte Einträge ohne IMDb-ID unterscheiden sich über die Serien-ID.
+		{ID: "i", Action: actionWatched, SeriesID: 7, Episode: 1, WatchedAt: day, Recorded: day},
+		{ID: "j", Action: actionWatched, SeriesID: 8, Episode: 1, WatchedAt: day, Recorded: day},
+	}
+	watched := watchedEvents(events)
+	var ids []string
+	for _, e := range watched {
+		ids = append(ids, e.ID)
+	}
+	want := []string{"e", "a", "h", "i", "j"}
+	if len(ids) != len(want) {
+		t.Fatalf("watched = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("watched = %v, want %v", ids, want)
+		}
+	}
+}
+
+func TestWatchedEventsUsesRecordedOrder(t *testing.T) {
+	// Ein zurückdatiertes "gesehen" nach "nicht gesehen" zählt trotzdem.
+	day := time.Date(2024, 3, 1, 20, 0, 0, 0, time.Local)
+	events := []WatchEvent{
+		statsEvent("a", actionWatched, "tt5753856", 1, day),
+		statsEvent("b", actionUnwatched, "tt5753856", 1, day.Add(time.Hour)),
+		{ID: "c", Action: actionWatched, IMDBID: "tt5753856", Season: 1, Episode: 1, WatchedAt: day.Add(-time.Hour), Recorded: day.Add(2 * time.Hour)},
+	}
+	watched := watchedEvents(events)
+	if len(watched) != 1 || watched[0].ID != "c" {
+		t.Errorf("watched = %+v, want only c", watched)
+	}
+}
+
+func TestWatchStreaks(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	at := func(daysAgo int) HistoryEntry {
+		return HistoryEntry{WatchEvent: WatchEvent{WatchedAt: now.AddDate(0, 0, -daysAgo)}}
+	}
+	// Drei Tage am Stück, Pause, zwei Tage bis gestern, zweimal am selben Tag.
+	watched := []HistoryEntry{at(1), at(2), at(2), at(5), at(6), at(7)}
+	longest, current := watchStreaks(watched, now)
+	if longest.Days != 3 || !longest.Start.Equal(startOfDay(now.AddDate(0, 0, -7))) || !longest.End.Equal(startOfDay(now.AddDate(0, 0, -5))) {
+		t.Errorf("longest = %d days from %v to %v, want 3 days ending 5 days ago", longest.Days, longest.Start, longest.End)
+	}
+	if current.Days != 2 {
+		t.Errorf("current = %d days, want 2 ending yesterday", current.Days)
+	}
+
+	if _, current := watchStreaks([]HistoryEntry{at(2), at(3)}, now); current.Days != 0 {
+		t.Errorf("current = %d days, want 0 after a day without episodes", current.Days)
+	}
+	if longest, current := watchStreaks(nil, now); longest.Days != 0 || current.Days != 0 {
+		t.Errorf("empty history: longest %d, current %d, want 0", longest.Days, current.Days)
+	}
+}
+
+func TestWatchPeriodsCountsDeduplicatedEpisodes(t *testing.T) {
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.Local) // Mittwoch
+	series := []Series{{IMDBID: "tt5753856", Runtime: 50, Seasons: []Season{{Number: 1, Episodes: []Episode{{Number: 1, Runtime: 60}, {Number: 2}}}}}}
+	events := []WatchEvent{
+		statsEvent("a", actionWatched, "tt5753856", 1, now.Add(-time.Hour)),
+		statsEvent("b", actionWatched, "tt5753856", 1, now.Add(-30*time.Minute)),
+		statsEvent("c", actionWatched, "tt5753856", 2, now.AddDate(0, 0, -7)),
+	}
+	weekly, monthly := watchPeriods(series, watchedEvents(events), now)
+	if len(weekly) != statsWeeks || len(monthly) != statsMonths {
+		t.Fatalf("got %d weeks and %d months", len(weekly), len(monthly))
+	}
+	if w := weekly[statsWeeks-1]; w.Episodes != 1 || w.Minutes != 60 {
+		t.Errorf("this week = %+v, want 1 episode with 60 minutes", w)
+	}
+	if w := weekly[statsWeeks-2]; w.Episodes != 1 || w.Minutes != 50 {
+		t.Errorf("last week = %+v, want 1 episode with the series runtime", w)
+	}
+	if m := monthly[statsMonths-1]; m.Episodes != 2 || m.Minutes != 110 || m.Percent != 100 {
+		t.Errorf("this month = %+v, want 2 episodes with 110 minutes", m)
+	}
+}
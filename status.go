@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- FORTSCHRITT & STATUS ---
+
+const (
+	statusPlanToWatch = "Plan to Watch"
+	statusWatching    = "Watching"
+	statusOnHold      = "On Hold"
+	statusDropped     = "Dropped"
+	statusCompleted   = "Completed"
+)
+
+// validStatuses in der Reihenfolge, in der sie in der Auswahl erscheinen.
+var validStatuses = []string{statusPlanToWatch, statusWatching, statusOnHold, statusDropped, statusCompleted}
+
+func isValidStatus(status string) bool {
+	for _, s := range validStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// statusClass macht aus einem Status einen CSS-Klassennamen ("On Hold" -> "OnHold").
+func statusClass(status string) string {
+	return strings.ReplaceAll(status, " ", "")
+}
+
+// updateProgress berechnet Progress neu und leitet den Status ab.
+// previousWatched ist der Zählerstand vor der Änderung: Wer bei einer
+// pausierten oder abgebrochenen Serie weiterschaut, setzt damit die
+// manuelle Wahl zurück.
+//
+//	alle Episoden gesehen      -> Completed
+//	manuell gesetzter Status   -> bleibt
+//	mindestens eine gesehen    -> Watching
+//	sonst                      -> Plan to Watch
+func updateProgress(s *Series, previousWatched int) {
+	s.Progress = 0
+	if s.TotalEpisodes > 0 {
+		s.Progress = s.EpisodesWatched * 100 / s.TotalEpisodes
+		if s.Progress > 100 {
+			s.Progress = 100
+		}
+	}
+
+	if s.StatusManual && s.EpisodesWatched > previousWatched && s.Status != statusCompleted {
+		s.StatusManual = false
+	}
+
+	switch {
+	case s.TotalEpisodes > 0 && s.EpisodesWatched >= s.TotalEpisodes:
+		s.Status = statusCompleted
+		s.StatusManual = false
+	case s.StatusManual:
+	case s.EpisodesWatched > 0:
+		s.Status = statusWatching
+	default:
+		s.Status = statusPlanToWatch
+	}
+}
+
+// setStatus setzt den Status von Hand. "auto" übergibt ihn wieder an
+// updateProgress.
+func setStatus(s *Series, status string) error {
+	if status == "auto" {
+		s.StatusManual = false
+		updateProgress(s, s.EpisodesWatched)
+		return nil
+	}
+	if !isValidStatus(status) {
+		return fmt.Errorf("invalid status %q", status)
+	}
+	s.Status = status
+	s.StatusManual = true
+	return nil
+}
+
+// --- HANDLER ---
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := getCurrentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	status := r.FormValue("status")
+	if status != "auto" && !isValidStatus(status) {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+
+	err = updateOneSeries(user, id, sourceWeb, func(s *Series) error {
+		return setStatus(s, status)
+	})
+	redirectToSeries(w, r, id, err)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --- SPEICHER-SCHICHT ---
+
+// Store kapselt die Persistenz von Nutzern, Serienlisten und Einstellungen.
+// Welche Implementierung genutzt wird, entscheidet STORAGE_BACKEND beim Start.
+type Store interface {
+	LoadUsers() (map[string]User, error)
+	SaveUsers(users map[string]User) error
+
+	LoadSeries(username string) ([]Series, error)
+	SaveSeries(username string, series []Series) error
+	// UpdateSeries lädt die Liste, wendet fn an und speichert das Ergebnis
+	// als eine Einheit. Gibt fn einen Fehler zurück, wird nichts gespeichert.
+	UpdateSeries(username string, fn func([]Series) ([]Series, error)) error
+	DeleteSeries(username string) error
+
+	// Sitzungen werden nach dem SHA-256 des Cookie-Werts abgelegt, nicht
+	// nach dem Cookie selbst.
+	LoadSessions() (map[string]Session, error)
+	SaveSessions(sessions map[string]Session) error
+
+	LoadSettings() (map[string]string, error)
+	GetSetting(key string) (string, bool, error)
+	SetSetting(key, value string) error
+
+	Close() error
+}
+
+const dataDir = "data"
+
+// openStore wählt das Backend anhand der Umgebungsvariablen STORAGE_BACKEND
+// ("json" oder "sqlite", Standard ist "json").
+func openStore() (Store, error) {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND")))
+	switch backend {
+	case "", "json":
+		log.Println("storage: using json files in", dataDir)
+		return newJSONStore(dataDir)
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = filepath.Join(dataDir, "serien-tracker.db")
+		}
+		log.Println("storage: using sqlite database", path)
+		s, err := newSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.migrate(); err != nil {
+			s.Close()
+			return nil, err
+		}
+		if err := importJSONIntoStore(s, dataDir); err != nil {
+			s.Close()
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// importJSONIntoStore übernimmt beim ersten Start eines neuen Backends die
+// vorhandenen JSON-Dateien, damit beim Umstieg keine Daten verloren gehen.
+func importJSONIntoStore(dst Store, dir string) error {
+	if done, _, err := dst.GetSetting("json_imported"); err != nil {
+		return err
+	} else if done == "true" {
+		return nil
+	}
+
+	src, err := newJSONStore(dir)
+	if err != nil {
+		return err
+	}
+	loaded, err := src.LoadUsers()
+	if err != nil {
+		return fmt.Errorf("import users: %v", err)
+	}
+	if len(loaded) > 0 {
+		if err := dst.SaveUsers(loaded); err != nil {
+			return fmt.Errorf("import users: %v", err)
+		}
+	}
+	for name := range loaded {
+		series, err := src.LoadSeries(name)
+		if err != nil {
+			return fmt.Errorf("import series for %s: %v", name, err)
+		}
+		if len(series) == 0 {
+			continue
+		}
+		if err := dst.SaveSeries(name, series); err != nil {
+			return fmt.Errorf("import series for %s: %v", name, err)
+		}
+		log.Printf("storage: imported %d series for %s", len(series), name)
+	}
+	return dst.SetSetting("json_imported", "true")
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// jsonStore legt jede Serienliste als data/<nutzer>.json ab,
+// Nutzer in data/users.json und Einstellungen in data/settings.json.
+// Jede Datei hat ein eigenes Lock, geschrieben wird atomar per Umbenennen.
+type jsonStore struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newJSONStore(dir string) (*jsonStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %v", err)
+	}
+	return &jsonStore{dir: dir, locks: map[string]*sync.Mutex{}}, nil
+}
+
+// lock liefert das Lock für eine Datei und legt es bei Bedarf an.
+func (s *jsonStore) lock(file string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.locks[file]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[file] = l
+	}
+	return l
+}
+
+func (s *jsonStore) usersFile() string {
+	return filepath.Join(s.dir, "users.json")
+}
+
+func (s *jsonStore) seriesFile(username string) string {
+	return filepath.Join(s.dir, username+".json")
+}
+
+func (s *jsonStore) sessionsFile() string {
+	return filepath.Join(s.dir, "sessions.json")
+}
+
+func (s *jsonStore) settingsFile() string {
+	return filepath.Join(s.dir, "settings.json")
+}
+
+// readJSON liest eine Datei in v. Fehlende oder leere Dateien sind kein Fehler.
+func (s *jsonStore) readJSON(file string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	if len(data) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, &corruptFileError{file: file, err: err}
+	}
+	return true, nil
+}
+
+// readVersioned liest eine Datei mit Schema-Umschlag und entpackt den
+// Inhalt unter payloadKey in v. Veraltete Dateien werden nicht gelesen,
+// sie müssen vorher von runMigrations angehoben werden.
+func (s *jsonStore) readVersioned(file, payloadKey string, v interface{}) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	version, payload, err := decodeVersioned(data, payloadKey)
+	if err != nil {
+		return &corruptFileError{file: file, err: err}
+	}
+	if version != currentSchemaVersion {
+		return &schemaError{file: file, version: version}
+	}
+	if len(payload) == 0 || string(payload) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return &corruptFileError{file: file, err: err}
+	}
+	return nil
+}
+
+// writeJSON schreibt zunächst in eine temporäre Datei im selben Verzeichnis
+// und benennt sie danach um. Ein Absturz hinterlässt so entweder die alte
+// oder die neue Version, aber nie eine halb geschriebene Datei.
+// Eine vorhandene Datei, die sich nicht parsen lässt, wird nicht überschrieben.
+func (s *jsonStore) writeJSON(file string, v interface{}) error {
+	if data, err := os.ReadFile(file); err == nil && len(data) > 0 && !json.Valid(data) {
+		return &corruptFileError{file: file}
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", file, err)
+	}
+	return writeFileAtomic(file, data)
+}
+
+// writeFileAtomic schreibt data über eine temporäre Datei und ersetzt file
+// erst, wenn alles auf der Platte ist.
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for %s: %v", file, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", file, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %v", file, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", file, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", file, err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", file, err)
+	}
+	return nil
+}
+
+func (s *jsonStore) LoadUsers() (map[string]User, error) {
+	l := s.lock(s.usersFile())
+	l.Lock()
+	defer l.Unlock()
+
+	loaded := map[string]User{}
+	if err := s.readVersioned(s.usersFile(), "users", &loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+func (s *jsonStore) SaveUsers(users map[string]User) error {
+	l := s.lock(s.usersFile())
+	l.Lock()
+	defer l.Unlock()
+	return s.writeJSON(s.usersFile(), usersFile{SchemaVersion: currentSchemaVersion, Users: users})
+}
+
+func (s *jsonStore) LoadSeries(username string) ([]Series, error) {
+	l := s.lock(s.seriesFile(username))
+	l.Lock()
+	defer l.Unlock()
+	return s.loadSeries(username)
+}
+
+func (s *jsonStore) loadSeries(username string) ([]Series, error) {
+	series := []Series{}
+	if err := s.readVersioned(s.seriesFile(username), "series", &series); err != nil {
+		return []Series{}, err
+	}
+	return series, nil
+}
+
+func (s *jsonStore) SaveSeries(username string, series []Series) error {
+	l := s.lock(s.seriesFile(username))
+	l.Lock()
+	defer l.Unlock()
+	return s.writeJSON(s.seriesFile(username), seriesFile{SchemaVersion: currentSchemaVersion, Series: series})
+}
+
+// UpdateSeries hält das Lock des Nutzers über Laden, Ändern und Speichern,
+// damit parallele Anfragen (z. B. zwei Tabs) keine Änderungen verlieren.
+func (s *jsonStore) UpdateSeries(username string, fn func([]Series) ([]Series, error)) error {
+	l := s.lock(s.seriesFile(username))
+	l.Lock()
+	defer l.Unlock()
+
+	series, err := s.loadSeries(username)
+	if err != nil {
+		return err
+	}
+	series, err = fn(series)
+	if err != nil {
+		return err
+	}
+	return s.writeJSON(s.seriesFile(username), seriesFile{SchemaVersion: currentSchemaVersion, Series: series})
+}
+
+func (s *jsonStore) DeleteSeries(username string) error {
+	l := s.lock(s.seriesFile(username))
+	l.Lock()
+	defer l.Unlock()
+	if err := os.Remove(s.seriesFile(username)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *jsonStore) LoadSessions() (map[string]Session, error) {
+	l := s.lock(s.sessionsFile())
+	l.Lock()
+	defer l.Unlock()
+
+	sessions := map[string]Session{}
+	if _, err := s.readJSON(s.sessionsFile(), &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *jsonStore) SaveSessions(sessions map[string]Session) error {
+	l := s.lock(s.sessionsFile())
+	l.Lock()
+	defer l.Unlock()
+	return s.writeJSON(s.sessionsFile(), sessions)
+}
+
+func (s *jsonStore) loadSettings() (map[string]string, error) {
+	settings := map[string]string{}
+	if _, err := s.readJSON(s.settingsFile(), &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s *jsonStore) LoadSettings() (map[string]string, error) {
+	l := s.lock(s.settingsFile())
+	l.Lock()
+	defer l.Unlock()
+	return s.loadSettings()
+}
+
+func (s *jsonStore) GetSetting(key string) (string, bool, error) {
+	l := s.lock(s.settingsFile())
+	l.Lock()
+	defer l.Unlock()
+	settings, err := s.loadSettings()
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := settings[key]
+	return value, ok, nil
+}
+
+func (s *jsonStore) SetSetting(key, value string) error {
+	l := s.lock(s.settingsFile())
+	l.Lock()
+	defer l.Unlock()
+	settings, err := s.loadSettings()
+	if err != nil {
+		return err
+	}
+	settings[key] = value
+	return s.writeJSON(s.settingsFile(), settings)
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
+
+// corruptFileError meldet eine Datei, die sich nicht parsen lässt. Solche
+// Dateien werden weder als leer behandelt noch überschrieben, damit die
+// Daten von Hand gerettet werden können.
+type corruptFileError struct {
+	file string
+	err  error
+}
+
+func (e *corruptFileError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s is corrupt and will not be overwritten: %v", e.file, e.err)
+	}
+	return fmt.Sprintf("%s is corrupt and will not be overwritten", e.file)
+}
+
+func (e *corruptFileError) Unwrap() error {
+	return e.err
+}
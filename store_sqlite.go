@@ -0,0 +1,443 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore speichert alles in einer eingebetteten SQLite-Datenbank.
+// Serien liegen zeilenweise vor, damit beim Speichern nur geänderte
+// Einträge geschrieben werden müssen.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS users (
+	username TEXT PRIMARY KEY,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS series (
+	username TEXT    NOT NULL,
+	id       INTEGER NOT NULL,
+	data     TEXT    NOT NULL,
+	PRIMARY KEY (username, id)
+);
+CREATE TABLE IF NOT EXISTS sessions (
+	id   TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS settings (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database dir: %v", err)
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	// SQLite erlaubt nur einen Schreiber; eine Verbindung vermeidet "database is locked".
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %v", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) LoadUsers() (map[string]User, error) {
+	rows, err := s.db.Query(`SELECT username, data FROM users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := map[string]User{}
+	for rows.Next() {
+		var name, data string
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, err
+		}
+		var u User
+		if err := json.Unmarshal([]byte(data), &u); err != nil {
+			return nil, fmt.Errorf("failed to parse user %s: %v", name, err)
+		}
+		loaded[name] = u
+	}
+	return loaded, rows.Err()
+}
+
+func (s *sqliteStore) SaveUsers(users map[string]User) error {
+	docs := map[string]interface{}{}
+	for name, u := range users {
+		docs[name] = u
+	}
+	return s.syncDocs("users", "username", docs)
+}
+
+func (s *sqliteStore) LoadSessions() (map[string]Session, error) {
+	blobs, err := queryBlobs(s.db, `SELECT id, data FROM sessions`)
+	if err != nil {
+		return nil, err
+	}
+	sessions := map[string]Session{}
+	for id, data := range blobs {
+		var sess Session
+		if err := json.Unmarshal([]byte(data), &sess); err != nil {
+			return nil, fmt.Errorf("failed to parse session %s: %v", id, err)
+		}
+		sessions[id] = sess
+	}
+	return sessions, nil
+}
+
+func (s *sqliteStore) SaveSessions(sessions map[string]Session) error {
+	docs := map[string]interface{}{}
+	for id, sess := range sessions {
+		docs[id] = sess
+	}
+	return s.syncDocs("sessions", "id", docs)
+}
+
+// syncDocs gleicht eine Tabelle (key, data) mit docs ab: Nur geänderte
+// Zeilen werden geschrieben, fehlende gelöscht.
+func (s *sqliteStore) syncDocs(table, keyColumn string, docs map[string]interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing, err := queryBlobs(tx, fmt.Sprintf(`SELECT %s, data FROM %s`, keyColumn, table))
+	if err != nil {
+		return err
+	}
+	for key, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s: %v", table, key, err)
+		}
+		if existing[key] == string(data) {
+			delete(existing, key)
+			continue
+		}
+		delete(existing, key)
+		if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (%s, data) VALUES (?, ?)
+			ON CONFLICT(%s) DO UPDATE SET data = excluded.data`, table, keyColumn, keyColumn), key, string(data)); err != nil {
+			return err
+		}
+	}
+	for key := range existing {
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, table, keyColumn), key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) LoadSeries(username string) ([]Series, error) {
+	return loadSeriesRows(s.db, username)
+}
+
+// querier deckt *sql.DB und *sql.Tx ab.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func loadSeriesRows(q querier, username string) ([]Series, error) {
+	rows, err := q.Query(`SELECT data FROM series WHERE username = ? ORDER BY id`, username)
+	if err != nil {
+		return []Series{}, err
+	}
+	defer rows.Close()
+
+	series := []Series{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return []Series{}, err
+		}
+		var item Series
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			return []Series{}, fmt.Errorf("failed to parse series of %s: %v", username, err)
+		}
+		series = append(series, item)
+	}
+	return series, rows.Err()
+}
+
+// SaveSeries gleicht die gespeicherten Zeilen mit der übergebenen Liste ab
+// und schreibt nur neue, geänderte oder entfernte Serien.
+func (s *sqliteStore) SaveSeries(username string, series []Series) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveSeriesRows(tx, username, series); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateSeries führt Laden, Ändern und Speichern in einer Transaktion aus.
+func (s *sqliteStore) UpdateSeries(username string, fn func([]Series) ([]Series, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	series, err := loadSeriesRows(tx, username)
+	if err != nil {
+		return err
+	}
+	series, err = fn(series)
+	if err != nil {
+		return err
+	}
+	if err := saveSeriesRows(tx, username, series); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func saveSeriesRows(tx *sql.Tx, username string, series []Series) error {
+	existing, err := queryBlobs(tx, `SELECT id, data FROM series WHERE username = ?`, username)
+	if err != nil {
+		return err
+	}
+	for _, item := range series {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal series %d: %v", item.ID, err)
+		}
+		key := fmt.Sprint(item.ID)
+		if existing[key] == string(data) {
+			delete(existing, key)
+			continue
+		}
+		delete(existing, key)
+		if _, err := tx.Exec(`INSERT INTO series (username, id, data) VALUES (?, ?, ?)
+			ON CONFLICT(username, id) DO UPDATE SET data = excluded.data`, username, item.ID, string(data)); err != nil {
+			return err
+		}
+	}
+	for key := range existing {
+		if _, err := tx.Exec(`DELETE FROM series WHERE username = ? AND id = ?`, username, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) DeleteSeries(username string) error {
+	_, err := s.db.Exec(`DELETE FROM series WHERE username = ?`, username)
+	return err
+}
+
+func (s *sqliteStore) LoadSettings() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM settings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	settings := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+func (s *sqliteStore) GetSetting(key string) (string, bool, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (s *sqliteStore) SetSetting(key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+// migrate hebt die gespeicherten Datensätze auf currentSchemaVersion an.
+// Die Version steht in der Tabelle settings; vor der ersten Änderung wird
+// eine Kopie der Datenbank unter data/backups/migrations/ abgelegt.
+func (s *sqliteStore) migrate() error {
+	value, ok, err := s.GetSetting("schema_version")
+	if err != nil {
+		return err
+	}
+	version := 0
+	if ok {
+		if version, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid schema_version %q: %v", value, err)
+		}
+	}
+	if version > currentSchemaVersion {
+		return &schemaError{file: "sqlite database", version: version}
+	}
+	if version == currentSchemaVersion {
+		return nil
+	}
+
+	var rowCount int
+	if err := s.db.QueryRow(`SELECT (SELECT COUNT(*) FROM users) + (SELECT COUNT(*) FROM series)`).Scan(&rowCount); err != nil {
+		return err
+	}
+	if rowCount > 0 {
+		backupDir := filepath.Join(dataDir, "backups", "migrations", time.Now().Format("20060102-150405"))
+		if err := os.MkdirAll(backupDir, 0755); err != nil {
+			return fmt.Errorf("failed to create backup dir: %v", err)
+		}
+		backupFile := filepath.Join(backupDir, "serien-tracker.db")
+		if _, err := s.db.Exec(`VACUUM INTO ?`, backupFile); err != nil {
+			return fmt.Errorf("failed to back up database: %v", err)
+		}
+		log.Printf("migration: backed up database to %s", backupFile)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var step func(m migration)
+	if rowCount > 0 {
+		step = func(m migration) {
+			log.Printf("migration: sqlite v%d -> v%d: %s", m.version-1, m.version, m.description)
+		}
+	}
+
+	userBlobs, err := queryBlobs(tx, `SELECT username, data FROM users`)
+	if err != nil {
+		return err
+	}
+	userDocs := map[string]rawDoc{}
+	for name, data := range userBlobs {
+		var doc rawDoc
+		if err := json.Unmarshal([]byte(data), &doc); err != nil {
+			return fmt.Errorf("failed to parse user %s: %v", name, err)
+		}
+		userDocs[name] = doc
+	}
+	if err := migrateUserDocs(userDocs, version, step); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM users`); err != nil {
+		return err
+	}
+	for name, doc := range userDocs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO users (username, data) VALUES (?, ?)`, name, string(data)); err != nil {
+			return err
+		}
+	}
+
+	names, err := queryBlobs(tx, `SELECT DISTINCT username, username FROM series`)
+	if err != nil {
+		return err
+	}
+	for name := range names {
+		rows, err := tx.Query(`SELECT data FROM series WHERE username = ? ORDER BY id`, name)
+		if err != nil {
+			return err
+		}
+		var docs []rawDoc
+		for rows.Next() {
+			var data string
+			var doc rawDoc
+			if err := rows.Scan(&data); err == nil {
+				err = json.Unmarshal([]byte(data), &doc)
+			}
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to parse series of %s: %v", name, err)
+			}
+			docs = append(docs, doc)
+		}
+		rows.Close()
+
+		// Die Schritte werden nur einmal protokolliert, nicht pro Nutzer.
+		docs, err = migrateSeriesDocs(name, docs, version, nil)
+		if err != nil {
+			return fmt.Errorf("migration of series for %s failed: %v", name, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM series WHERE username = ?`, name); err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO series (username, id, data) VALUES (?, ?, ?)`, name, doc["id"], string(data)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO settings (key, value) VALUES ('schema_version', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, strconv.Itoa(currentSchemaVersion)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if rowCount > 0 {
+		log.Printf("migration: sqlite database now at schema version %d", currentSchemaVersion)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// queryBlobs liefert die Ergebnisse einer zweispaltigen Abfrage als Map.
+func queryBlobs(tx querier, query string, args ...interface{}) (map[string]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]string{}
+	for rows.Next() {
+		var key, data string
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, err
+		}
+		result[key] = data
+	}
+	return result, rows.Err()
+}
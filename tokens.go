@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- API-TOKENS ---
+
+// APIToken erlaubt Skripten den Zugriff auf die API per
+// "Authorization: Bearer <token>". Gespeichert wird nur der SHA-256 des
+// Tokens; der Klartext wird beim Anlegen einmalig angezeigt.
+type APIToken struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Scope    string    `json:"scope"` // "read" oder "write"
+	Hash     string    `json:"hash"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+
+	apiTokenPrefix = "st_"
+	maxAPITokens   = 20
+	// Wie bei den Sitzungen wird LastUsed nur gelegentlich gespeichert.
+	apiTokenTouchInterval = time.Minute
+)
+
+var (
+	errTokenNameEmpty = errors.New("token name must not be empty")
+	errTokenScope     = errors.New("scope must be read or write")
+	errTooManyTokens  = fmt.Errorf("at most %d tokens per user", maxAPITokens)
+	errTokenNotFound  = errors.New("token not found")
+)
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIToken legt ein Token an und liefert den Klartext zurück.
+func createAPIToken(username, name, scope string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errTokenNameEmpty
+	}
+	if scope != scopeRead && scope != scopeWrite {
+		return "", errTokenScope
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	idBytes := make([]byte, 4)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	token := apiTokenPrefix + secret
+
+	err = updateUsers(func(all map[string]User) error {
+		u, exists := all[username]
+		if !exists {
+			return errUserNotFound
+		}
+		if len(u.APITokens) >= maxAPITokens {
+			return errTooManyTokens
+		}
+		u.APITokens = append(append([]APIToken{}, u.APITokens...), APIToken{
+			ID:      hex.EncodeToString(idBytes),
+			Name:    name,
+			Scope:   scope,
+			Hash:    hashAPIToken(token),
+			Created: time.Now(),
+		})
+		all[username] = u
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func revokeAPIToken(username, id string) error {
+	return updateUsers(func(all map[string]User) error {
+		u, exists := all[username]
+		if !exists {
+			return errUserNotFound
+		}
+		kept := []APIToken{}
+		for _, t := range u.APITokens {
+			if t.ID != id {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == len(u.APITokens) {
+			return errTokenNotFound
+		}
+		u.APITokens = kept
+		all[username] = u
+		return nil
+	})
+}
+
+// lookupAPIToken sucht den Nutzer zu einem Token im Klartext.
+func lookupAPIToken(token string) (string, APIToken, bool) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return "", APIToken{}, false
+	}
+	hash := hashAPIToken(token)
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	for name, u := range users {
+		for _, t := range u.APITokens {
+			if t.Hash == hash {
+				return name, t, true
+			}
+		}
+	}
+	return "", APIToken{}, false
+}
+
+// touchAPIToken merkt sich den Zeitpunkt der letzten Nutzung.
+func touchAPIToken(username string, t APIToken) {
+	if time.Since(t.LastUsed) < apiTokenTouchInterval {
+		return
+	}
+	err := updateUsers(func(all map[string]User) error {
+		u, exists := all[username]
+		if !exists {
+			return errUserNotFound
+		}
+		tokens := append([]APIToken{}, u.APITokens...)
+		for i := range tokens {
+			if tokens[i].ID == t.ID {
+				tokens[i].LastUsed = time.Now()
+			}
+		}
+		u.APITokens = tokens
+		all[username] = u
+		return nil
+	})
+	if err != nil {
+		log.Printf("api: failed to update last use of token %s: %v", t.ID, err)
+	}
+}
+
+// bearerToken liefert das Token aus "Authorization: Bearer ...".
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// --- HANDLER ---
+
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+
+	if r.Method == "POST" {
+		var err error
+		switch r.FormValue("action") {
+		case "create":
+			var token string
+			token, err = createAPIToken(user, r.FormValue("name"), r.FormValue("scope"))
+			if err == nil {
+				log.Printf("api: %s created token %q", user, strings.TrimSpace(r.FormValue("name")))
+				data.NewToken = token
+				data.SuccessMessage = "Token angelegt. Kopiere es jetzt – es wird nur einmal angezeigt."
+			}
+		case "revoke":
+			err = revokeAPIToken(user, r.FormValue("id"))
+			if err == nil {
+				log.Printf("api: %s revoked token %s", user, r.FormValue("id"))
+				data.SuccessMessage = "Token widerrufen"
+			}
+		default:
+			err = errors.New("unknown action")
+		}
+		if err != nil {
+			data.ErrorMessage = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	u, _ := getUser(user)
+	data.APITokens = u.APITokens
+	templates.ExecuteTemplate(w, "tokens.html", data)
+}
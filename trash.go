@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// --- PAPIERKORB ---
+
+// Gelöschte Serien wandern samt Episoden, Bewertung, Notizen und Tags nach
+// data/trash/<nutzer>.json und lassen sich von dort zurückholen. Nach
+// TRASH_RETENTION_DAYS Tagen löscht ein Hintergrund-Job sie endgültig.
+// Eigene Listen verweisen über die IMDb-ID auf Serien und bleiben daher
+// beim Zurückholen vollständig.
+
+const (
+	trashSubdir        = "trash"
+	trashPurgeInterval = time.Hour
+	trashFlashParam    = "trashed"
+)
+
+var (
+	trashDir = filepath.Join(dataDir, trashSubdir)
+	// trashMu wird immer vor dem Speicher gesperrt, nie umgekehrt.
+	trashMu sync.Mutex
+
+	trashRetentionDays = envInt("TRASH_RETENTION_DAYS", 30)
+
+	errTrashNotFound = errors.New("series not found in trash")
+)
+
+// TrashedSeries ist eine gelöschte Serie. Die ID ist eigenständig, da
+// Serien-IDs nach dem Löschen neu vergeben werden können.
+type TrashedSeries struct {
+	ID        string    `json:"id"`
+	Series    Series    `json:"series"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// PurgeAt ist der Zeitpunkt, ab dem die Serie endgültig gelöscht wird.
+func (t TrashedSeries) PurgeAt() time.Time {
+	return t.DeletedAt.AddDate(0, 0, trashRetentionDays)
+}
+
+// DaysLeft liefert die Tage bis zum endgültigen Löschen, mindestens 0.
+func (t TrashedSeries) DaysLeft() int {
+	days := int(math.Ceil(time.Until(t.PurgeAt()).Hours() / 24))
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+func trashFile(username string) string {
+	return filepath.Join(trashDir, username+".json")
+}
+
+// readTrash liest den Papierkorb des Nutzers. Aufrufer halten trashMu.
+func readTrash(username string) ([]TrashedSeries, error) {
+	data, err := os.ReadFile(trashFile(username))
+	if os.IsNotExist(err) {
+		return []TrashedSeries{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []TrashedSeries
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to read trash of %s: %v", username, err)
+	}
+	return entries, nil
+}
+
+// writeTrash schreibt den Papierkorb, ein leerer entfernt die Datei.
+// Aufrufer halten trashMu.
+func writeTrash(username string, entries []TrashedSeries) error {
+	if len(entries) == 0 {
+		err := os.Remove(trashFile(username))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(trashDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(trashFile(username), data)
+}
+
+// loadTrash liefert den Papierkorb, zuletzt gelöschte zuerst.
+func loadTrash(username string) ([]TrashedSeries, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries, err := readTrash(username)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+	return entries, nil
+}
+
+func findTrashed(entries []TrashedSeries, id string) int {
+	for i, e := range entries {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// trashSeries verschiebt eine Serie in den Papierkorb. Der Papierkorb wird
+// geschrieben, bevor die Serie aus der Liste verschwindet; schlägt das
+// Speichern der Liste fehl, wird der Eintrag wieder entfernt.
+func trashSeries(username string, id int) (TrashedSeries, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries, err := readTrash(username)
+	if err != nil {
+		return TrashedSeries{}, err
+	}
+	trashID, err := newEventID()
+	if err != nil {
+		return TrashedSeries{}, err
+	}
+
+	var trashed TrashedSeries
+	written := false
+	err = store.UpdateSeries(username, func(seriesDB []Series) ([]Series, error) {
+		remaining := []Series{}
+		for _, s := range seriesDB {
+			if s.ID == id {
+				trashed = TrashedSeries{ID: trashID, Series: s, DeletedAt: time.Now().UTC()}
+				continue
+			}
+			remaining = append(remaining, s)
+		}
+		if trashed.ID == "" {
+			return nil, errSeriesNotFound
+		}
+		if err := writeTrash(username, append(entries, trashed)); err != nil {
+			return nil, err
+		}
+		written = true
+		return remaining, nil
+	})
+	if err != nil && written {
+		if rollbackErr := writeTrash(username, entries); rollbackErr != nil {
+			log.Printf("trash: failed to roll back trash of %s: %v", username, rollbackErr)
+		}
+	}
+	return trashed, err
+}
+
+// restoreTrashed holt eine Serie zurück in die Liste. Ist ihre ID
+// inzwischen vergeben, bekommt sie die nächste freie.
+func restoreTrashed(username, trashID string) (Series, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries, err := readTrash(username)
+	if err != nil {
+		return Series{}, err
+	}
+	i := findTrashed(entries, trashID)
+	if i < 0 {
+		return Series{}, errTrashNotFound
+	}
+	restored := entries[i].Series
+
+	err = store.UpdateSeries(username, func(seriesDB []Series) ([]Series, error) {
+		nextID, taken := 1, false
+		for _, s := range seriesDB {
+			if restored.IMDBID != "" && s.IMDBID == restored.IMDBID {
+				return nil, errSeriesExists
+			}
+			if s.ID == restored.ID {
+				taken = true
+			}
+			if s.ID >= nextID {
+				nextID = s.ID + 1
+			}
+		}
+		if taken {
+			restored.ID = nextID
+		}
+		return append(seriesDB, restored), nil
+	})
+	if err != nil {
+		return Series{}, err
+	}
+	if err := writeTrash(username, append(entries[:i:i], entries[i+1:]...)); err != nil {
+		// Die Serie ist zurück, nur der Eintrag im Papierkorb bleibt stehen.
+		log.Printf("trash: failed to remove restored series from trash of %s: %v", username, err)
+	}
+	return restored, nil
+}
+
+// purgeTrashed löscht eine Serie endgültig aus dem Papierkorb.
+func purgeTrashed(username, trashID string) (TrashedSeries, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries, err := readTrash(username)
+	if err != nil {
+		return TrashedSeries{}, err
+	}
+	i := findTrashed(entries, trashID)
+	if i < 0 {
+		return TrashedSeries{}, errTrashNotFound
+	}
+	purged := entries[i]
+	return purged, writeTrash(username, append(entries[:i:i], entries[i+1:]...))
+}
+
+// emptyTrash löscht alle Serien im Papierkorb endgültig.
+func emptyTrash(username string) (int, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	entries, err := readTrash(username)
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), writeTrash(username, nil)
+}
+
+// purgeExpiredTrash löscht Einträge, die länger als TRASH_RETENTION_DAYS
+// im Papierkorb liegen.
+func purgeExpiredTrash() {
+	now := time.Now()
+	for _, entry := range listUsers() {
+		trashMu.Lock()
+		entries, err := readTrash(entry.Username)
+		if err != nil {
+			trashMu.Unlock()
+			log.Printf("trash: failed to read trash of %s: %v", entry.Username, err)
+			continue
+		}
+		kept := entries[:0:0]
+		for _, e := range entries {
+			if now.Before(e.PurgeAt()) {
+				kept = append(kept, e)
+			}
+		}
+		if removed := len(entries) - len(kept); removed > 0 {
+			if err := writeTrash(entry.Username, kept); err != nil {
+				log.Printf("trash: failed to purge trash of %s: %v", entry.Username, err)
+			} else {
+				log.Printf("trash: purged %d series of %s", removed, entry.Username)
+			}
+		}
+		trashMu.Unlock()
+	}
+}
+
+// runTrashPurger leert abgelaufene Einträge beim Start und danach stündlich.
+func runTrashPurger() {
+	for {
+		purgeExpiredTrash()
+		time.Sleep(trashPurgeInterval)
+	}
+}
+
+func renameTrash(oldName, newName string) error {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	err := os.Rename(trashFile(oldName), trashFile(newName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func deleteTrash(username string) error {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	return writeTrash(username, nil)
+}
+
+// readTrashFile liefert die Datei unverändert, z. B. für Sicherungen.
+func readTrashFile(username string) ([]byte, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	data, err := os.ReadFile(trashFile(username))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// replaceTrash ersetzt die Datei beim Wiederherstellen einer Sicherung.
+// Ohne Inhalt wird sie gelöscht.
+func replaceTrash(username string, data []byte) error {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	if len(data) == 0 {
+		return writeTrash(username, nil)
+	}
+	if err := os.MkdirAll(trashDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(trashFile(username), data)
+}
+
+// --- HANDLER ---
+
+// withTrashFlash setzt bzw. entfernt (id leer) den Parameter, über den
+// die Seite nach dem Löschen „Rückgängig“ anbietet.
+func withTrashFlash(target, id string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	q := u.Query()
+	if id == "" {
+		q.Del(trashFlashParam)
+	} else {
+		q.Set(trashFlashParam, id)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// trashFlash liefert die gerade gelöschte Serie für den Hinweis mit
+// „Rückgängig“, sofern sie noch im Papierkorb liegt.
+func trashFlash(r *http.Request, username string) *TrashedSeries {
+	id := r.URL.Query().Get(trashFlashParam)
+	if id == "" {
+		return nil
+	}
+	entries, err := loadTrash(username)
+	if err != nil {
+		return nil
+	}
+	if i := findTrashed(entries, id); i >= 0 {
+		return &entries[i]
+	}
+	return nil
+}
+
+// trashHandler zeigt /trash. Kommt "return" mit (Rückgängig aus der
+// Liste), geht es nach dem Zurückholen dorthin zurück.
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	data := newPageData(r, user)
+
+	if r.Method == "POST" {
+		id := r.FormValue("id")
+		var err error
+		switch r.FormValue("action") {
+		case "restore":
+			var restored Series
+			restored, err = restoreTrashed(user, id)
+			if err == nil {
+				if target := r.FormValue("return"); target != "" {
+					http.Redirect(w, r, withTrashFlash(safeReturnPath(target), ""), http.StatusSeeOther)
+					return
+				}
+				data.SuccessMessage = fmt.Sprintf("„%s“ wiederhergestellt", restored.Title)
+			}
+		case "purge":
+			var purged TrashedSeries
+			purged, err = purgeTrashed(user, id)
+			if err == nil {
+				data.SuccessMessage = fmt.Sprintf("„%s“ endgültig gelöscht", purged.Series.Title)
+			}
+		case "empty":
+			var removed int
+			removed, err = emptyTrash(user)
+			if err == nil {
+				data.SuccessMessage = fmt.Sprintf("Papierkorb geleert (%d Serien)", removed)
+			}
+		default:
+			err = errors.New("unknown action")
+		}
+		if err != nil {
+			log.Printf("trash: %s failed for %s: %v", r.FormValue("action"), user, err)
+			data.ErrorMessage = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+
+	entries, err := loadTrash(user)
+	if err != nil {
+		log.Printf("trash: failed to load trash of %s: %v", user, err)
+		data.ErrorMessage = "failed to load trash"
+	}
+	data.Trash = entries
+	data.TrashDays = trashRetentionDays
+	templates.ExecuteTemplate(w, "trash.html", data)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrashAndRestoreKeepsSeries(t *testing.T) {
+	useTestData(t)
+	dark := Series{ID: 1, IMDBID: "tt5753856", Title: "Dark", Rating: 8, Notes: "Zeitreisen", Seasons: testSeasons()}
+	if err := store.SaveSeries("anna", []Series{dark}); err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := trashSeries("anna", dark.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if series := loadSeriesForUser("anna"); len(series) != 0 {
+		t.Errorf("series = %+v, want none after trashing", series)
+	}
+	if _, err := trashSeries("anna", dark.ID); err != errSeriesNotFound {
+		t.Errorf("trashing twice: err = %v, want %v", err, errSeriesNotFound)
+	}
+
+	restored, err := restoreTrashed("anna", trashed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ID != dark.ID || restored.Rating != 8 || restored.Notes != dark.Notes || len(restored.Seasons) != 1 {
+		t.Errorf("restored = %+v, want Dark unchanged", restored)
+	}
+	if entries, err := loadTrash("anna"); err != nil || len(entries) != 0 {
+		t.Errorf("trash = %+v (%v), want empty", entries, err)
+	}
+	if _, err := restoreTrashed("anna", trashed.ID); err != errTrashNotFound {
+		t.Errorf("restoring twice: err = %v, want %v", err, errTrashNotFound)
+	}
+}
+
+func TestRestoreTrashedReassignsTakenID(t *testing.T) {
+	useTestData(t)
+	dark := Series{ID: 2, IMDBID: "tt5753856", Title: "Dark"}
+	if err := store.SaveSeries("anna", []Series{{ID: 1, IMDBID: "tt0411008", Title: "Lost"}, dark}); err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := trashSeries("anna", dark.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fargo, err := insertSeries("anna", &SeriesInfo{IMDBID: "tt2802850", Title: "Fargo"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fargo.ID != dark.ID {
+		t.Fatalf("fargo got ID %d, want the reused ID %d", fargo.ID, dark.ID)
+	}
+
+	restored, err := restoreTrashed("anna", trashed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ID != 3 {
+		t.Errorf("restored ID = %d, want the next free ID 3", restored.ID)
+	}
+	ids := map[int]string{}
+	for _, s := range loadSeriesForUser("anna") {
+		if other, ok := ids[s.ID]; ok {
+			t.Errorf("ID %d used by %s and %s", s.ID, other, s.Title)
+		}
+		ids[s.ID] = s.Title
+	}
+	if len(ids) != 3 || ids[2] != "Fargo" || ids[3] != "Dark" {
+		t.Errorf("series = %v, want Lost, Fargo and Dark", ids)
+	}
+}
+
+func TestRestoreTrashedRejectsDuplicate(t *testing.T) {
+	useTestData(t)
+	if err := store.SaveSeries("anna", []Series{{ID: 1, IMDBID: "tt5753856", Title: "Dark"}}); err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := trashSeries("anna", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := insertSeries("anna", &SeriesInfo{IMDBID: "tt5753856", Title: "Dark"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restoreTrashed("anna", trashed.ID); err != errSeriesExists {
+		t.Errorf("err = %v, want %v", err, errSeriesExists)
+	}
+	if entries, err := loadTrash("anna"); err != nil || len(entries) != 1 {
+		t.Errorf("trash = %+v (%v), want the entry kept", entries, err)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	useTestData(t)
+	err := updateUsers(func(all map[string]User) error {
+		all["anna"] = User{DisplayName: "Anna", IsAdmin: true}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := TrashedSeries{ID: "old", Series: Series{Title: "Lost"}, DeletedAt: time.Now().AddDate(0, 0, -trashRetentionDays-1)}
+	recent := TrashedSeries{ID: "recent", Series: Series{Title: "Dark"}, DeletedAt: time.Now()}
+	trashMu.Lock()
+	err = writeTrash("anna", []TrashedSeries{old, recent})
+	trashMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	purgeExpiredTrash()
+	if entries, err := loadTrash("anna"); err != nil || len(entries) != 1 || entries[0].ID != "recent" {
+		t.Errorf("trash = %+v (%v), want only the recent entry", entries, err)
+	}
+}
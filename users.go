@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// --- NUTZERVERWALTUNG ---
+
+// users ist eine Kopie von data/users.json. Änderungen laufen nur über
+// updateUsers, das die Datei schreibt und die Map danach austauscht.
+var (
+	usersMu sync.RWMutex
+	users   = map[string]User{}
+)
+
+// UserEntry ist ein Nutzer samt Login-Namen für Listen in Templates.
+type UserEntry struct {
+	Username string
+	User
+}
+
+var (
+	validUsername = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+	validThemes   = []string{"netflix", "apple", "android", "windows"}
+
+	errUserExists    = errors.New("user already exists")
+	errUserNotFound  = errors.New("user not found")
+	errLastAdmin     = errors.New("at least one admin is required")
+	errDeleteSelf    = errors.New("you cannot delete your own account")
+	errDemoteSelf    = errors.New("you cannot remove your own admin rights")
+	errInvalidName   = errors.New("username may only contain a-z, 0-9, '-' and '_' (max. 32 characters)")
+	errReservedName  = errors.New("username is reserved")
+	errEmptyNickname = errors.New("display name must not be empty")
+)
+
+// defaultUsers wird nur angelegt, wenn noch keine users.json existiert.
+func defaultUsers() map[string]User {
+	return map[string]User{
+		"user_a": {DisplayName: "Nutzer A", Theme: "netflix", Lang: "de", IsAdmin: true},
+		"user_b": {DisplayName: "Nutzer B", Theme: "netflix", Lang: "de", IsAdmin: false},
+		"user_c": {DisplayName: "Nutzer C", Theme: "netflix", Lang: "de", IsAdmin: false},
+		"user_d": {DisplayName: "Nutzer D", Theme: "netflix", Lang: "de", IsAdmin: false},
+	}
+}
+
+func loadUsers() error {
+	loadedUsers, err := store.LoadUsers()
+	if err != nil {
+		return err
+	}
+	if len(loadedUsers) == 0 {
+		log.Println("users: no users found, creating default users")
+		loadedUsers = defaultUsers()
+		if err := store.SaveUsers(loadedUsers); err != nil {
+			return err
+		}
+	}
+	usersMu.Lock()
+	users = loadedUsers
+	usersMu.Unlock()
+	return nil
+}
+
+func getUser(name string) (User, bool) {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	u, ok := users[name]
+	return u, ok
+}
+
+// listUsers liefert alle Nutzer, Admins zuerst, sonst nach Anzeigename.
+func listUsers() []UserEntry {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	list := make([]UserEntry, 0, len(users))
+	for name, u := range users {
+		list = append(list, UserEntry{Username: name, User: u})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].IsAdmin != list[j].IsAdmin {
+			return list[i].IsAdmin
+		}
+		return strings.ToLower(list[i].DisplayName) < strings.ToLower(list[j].DisplayName)
+	})
+	return list
+}
+
+// updateUsers wendet fn auf eine Kopie aller Nutzer an, speichert sie und
+// übernimmt sie erst danach. Schlägt fn oder das Speichern fehl, bleibt
+// alles beim Alten.
+func updateUsers(fn func(all map[string]User) error) error {
+	usersMu.Lock()
+	defer usersMu.Unlock()
+
+	updated := make(map[string]User, len(users))
+	for k, v := range users {
+		updated[k] = v
+	}
+	if err := fn(updated); err != nil {
+		return err
+	}
+	admins := 0
+	for _, u := range updated {
+		if u.IsAdmin {
+			admins++
+		}
+	}
+	if admins == 0 {
+		return errLastAdmin
+	}
+	if err := store.SaveUsers(updated); err != nil {
+		return err
+	}
+	users = updated
+	return nil
+}
+
+func isValidTheme(theme string) bool {
+	for _, t := range validThemes {
+		if t == theme {
+			return true
+		}
+	}
+	return false
+}
+
+func checkUsername(name string) error {
+	if !validUsername.MatchString(name) {
+		return errInvalidName
+	}
+	if reservedDataFiles[name+".json"] {
+		return errReservedName
+	}
+	return nil
+}
+
+func createUser(name string, u User) error {
+	if err := checkUsername(name); err != nil {
+		return err
+	}
+	if strings.TrimSpace(u.DisplayName) == "" {
+		return errEmptyNickname
+	}
+	return updateUsers(func(all map[string]User) error {
+		if _, exists := all[name]; exists {
+			return errUserExists
+		}
+		all[name] = u
+		return nil
+	})
+}
+
+// renameUser ändert den Login-Namen und zieht Serienliste, Verlauf, eigene
+// Listen und Papierkorb mit um.
+func renameUser(oldName, newName string) error {
+	if err := checkUsername(newName); err != nil {
+		return err
+	}
+	if _, exists := getUser(oldName); !exists {
+		return errUserNotFound
+	}
+	if _, exists := getUser(newName); exists {
+		return errUserExists
+	}
+
+	series, err := store.LoadSeries(oldName)
+	if err != nil {
+		return err
+	}
+	if err := store.SaveSeries(newName, series); err != nil {
+		return err
+	}
+	err = updateUsers(func(all map[string]User) error {
+		u, exists := all[oldName]
+		if !exists {
+			return errUserNotFound
+		}
+		if _, exists := all[newName]; exists {
+			return errUserExists
+		}
+		delete(all, oldName)
+		all[newName] = u
+		return nil
+	})
+	if err != nil {
+		store.DeleteSeries(newName)
+		return err
+	}
+	if err := store.DeleteSeries(oldName); err != nil {
+		log.Printf("failed to remove old series of %s: %v", oldName, err)
+	}
+	if err := renameHistory(oldName, newName); err != nil {
+		log.Printf("failed to move history of %s: %v", oldName, err)
+	}
+	if err := renameLists(oldName, newName); err != nil {
+		log.Printf("failed to move lists of %s: %v", oldName, err)
+	}
+	if err := renameTrash(oldName, newName); err != nil {
+		log.Printf("failed to move trash of %s: %v", oldName, err)
+	}
+	if err := revokeUserSessions(oldName, ""); err != nil {
+		log.Printf("failed to revoke sessions of %s: %v", oldName, err)
+	}
+	return nil
+}
+
+// deleteUser entfernt den Nutzer samt Serienliste, Verlauf, eigenen Listen
+// und Papierkorb.
+func deleteUser(name string) error {
+	err := updateUsers(func(all map[string]User) error {
+		if _, exists := all[name]; !exists {
+			return errUserNotFound
+		}
+		delete(all, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := revokeUserSessions(name, ""); err != nil {
+		log.Printf("failed to revoke sessions of %s: %v", name, err)
+	}
+	if err := store.DeleteSeries(name); err != nil {
+		return fmt.Errorf("user removed, but failed to delete series: %v", err)
+	}
+	if err := deleteHistory(name); err != nil {
+		return fmt.Errorf("user removed, but failed to delete history: %v", err)
+	}
+	if err := deleteLists(name); err != nil {
+		return fmt.Errorf("user removed, but failed to delete lists: %v", err)
+	}
+	if err := deleteTrash(name); err != nil {
+		return fmt.Errorf("user removed, but failed to delete trash: %v", err)
+	}
+	return nil
+}
+
+func cacheStatsForAdmin() *CacheStats {
+	stats := metadataCache.stats()
+	return &stats
+}
+
+// --- HANDLER ---
+
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := getCurrentUser(r)
+	current, _, _ := sessionFromRequest(r)
+	if r.Method == "POST" {
+		var err error
+		var message string
+		var preview *BackupPreview
+		target := strings.TrimSpace(r.FormValue("username"))
+
+		switch r.FormValue("action") {
+		case "create":
+			theme := r.FormValue("theme")
+			if !isValidTheme(theme) {
+				theme = "netflix"
+			}
+			err = createUser(target, User{
+				DisplayName: strings.TrimSpace(r.FormValue("display_name")),
+				Theme:       theme,
+				Lang:        "de",
+				IsAdmin:     r.FormValue("is_admin") == "1",
+			})
+			message = fmt.Sprintf("Nutzer %s angelegt", target)
+		case "update":
+			err = updateUsers(func(all map[string]User) error {
+				u, exists := all[target]
+				if !exists {
+					return errUserNotFound
+				}
+				if name := strings.TrimSpace(r.FormValue("display_name")); name != "" {
+					u.DisplayName = name
+				}
+				if theme := r.FormValue("theme"); isValidTheme(theme) {
+					u.Theme = theme
+				}
+				isAdmin := r.FormValue("is_admin") == "1"
+				if target == user && !isAdmin {
+					return errDemoteSelf
+				}
+				u.IsAdmin = isAdmin
+				all[target] = u
+				return nil
+			})
+			message = fmt.Sprintf("Nutzer %s gespeichert", target)
+		case "rename":
+			newName := strings.TrimSpace(r.FormValue("new_username"))
+			if target == user {
+				err = errors.New("you cannot rename your own account while logged in")
+			} else {
+				err = renameUser(target, newName)
+			}
+			message = fmt.Sprintf("Nutzer %s heißt jetzt %s", target, newName)
+		case "clear_data":
+			if _, exists := getUser(target); !exists {
+				err = errUserNotFound
+			} else {
+				err = store.DeleteSeries(target)
+			}
+			if err == nil {
+				err = deleteHistory(target)
+			}
+			if err == nil {
+				err = deleteLists(target)
+			}
+			if err == nil {
+				err = deleteTrash(target)
+			}
+			message = fmt.Sprintf("Serienliste von %s gelöscht", target)
+		case "set_password":
+			kind := r.FormValue("kind")
+			err = setCredential(target, kind, r.FormValue("new_secret"))
+			if err == nil {
+				// Wer das alte Passwort kannte, soll nicht angemeldet bleiben.
+				err = revokeUserSessions(target, current)
+			}
+			switch kind {
+			case "pin":
+				message = fmt.Sprintf("PIN von %s gesetzt", target)
+			case "none":
+				message = fmt.Sprintf("Anmeldedaten von %s entfernt", target)
+			default:
+				message = fmt.Sprintf("Passwort von %s zurückgesetzt", target)
+			}
+		case "revoke_session":
+			err = revokeSession(r.FormValue("session"))
+			message = "Sitzung beendet"
+		case "logout_user":
+			err = revokeUserSessions(target, current)
+			message = fmt.Sprintf("Alle Sitzungen von %s beendet", target)
+		case "cache_purge":
+			var removed int
+			if r.FormValue("scope") == "expired" {
+				removed, err = metadataCache.purgeExpired()
+			} else {
+				removed, err = metadataCache.purgeAll()
+			}
+			message = fmt.Sprintf("%d Cache-Einträge gelöscht", removed)
+		case "cache_invalidate":
+			var removed int
+			imdbID := strings.TrimSpace(r.FormValue("imdb_id"))
+			removed, err = metadataCache.invalidateIMDB(imdbID)
+			message = fmt.Sprintf("%d Cache-Einträge für %s gelöscht", removed, imdbID)
+		case "backup_create", "backup_delete", "restore_upload", "restore_preview", "restore":
+			message, preview, err = backupAction(r, user, current)
+		case "delete":
+			if target == user {
+				err = errDeleteSelf
+			} else {
+				err = deleteUser(target)
+			}
+			message = fmt.Sprintf("Nutzer %s gelöscht", target)
+		default:
+			err = errors.New("unknown action")
+		}
+
+		data := newPageData(r, user)
+		if err != nil {
+			log.Printf("admin: %s failed for %s: %v", r.FormValue("action"), target, err)
+			data.ErrorMessage = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			log.Printf("admin: %s by %s", message, user)
+			data.SuccessMessage = message
+		}
+		data.Users = listUsers()
+		data.Sessions = listSessions(current)
+		data.CacheStats = cacheStatsForAdmin()
+		data.Backups = backupOverview()
+		data.Backups.Preview = preview
+		templates.ExecuteTemplate(w, "admin.html", data)
+		return
+	}
+
+	data := newPageData(r, user)
+	data.Users = listUsers()
+	data.Sessions = listSessions(current)
+	data.CacheStats = cacheStatsForAdmin()
+	data.Backups = backupOverview()
+	templates.ExecuteTemplate(w, "admin.html", data)
+}